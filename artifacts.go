@@ -0,0 +1,284 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+)
+
+// artifactsCommandTimeout is the time limit of the commands that
+// collect the artifacts
+const artifactsCommandTimeout = 30 * time.Second
+
+// specNameRegexp matches the characters replaced in the artifact
+// directory names
+var specNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// specArtifacts are the containers and docker containers used by the
+// running spec, see TrackContainer and TrackDockerContainer
+var specArtifacts struct {
+	sync.Mutex
+	start            time.Time
+	containers       []*Container
+	dockerContainers []string
+}
+
+// StartSpecArtifacts forgets the containers tracked by the previous
+// spec, it should be called before each spec
+func StartSpecArtifacts() {
+	specArtifacts.Lock()
+	defer specArtifacts.Unlock()
+
+	specArtifacts.start = time.Now()
+	specArtifacts.containers = nil
+	specArtifacts.dockerContainers = nil
+}
+
+// TrackContainer adds c to the containers whose artifacts are collected
+// if the running spec fails
+func TrackContainer(c *Container) {
+	specArtifacts.Lock()
+	defer specArtifacts.Unlock()
+
+	specArtifacts.containers = append(specArtifacts.containers, c)
+}
+
+// TrackDockerContainer adds the docker container name to the containers
+// whose artifacts are collected if the running spec fails
+func TrackDockerContainer(name string) {
+	specArtifacts.Lock()
+	defer specArtifacts.Unlock()
+
+	specArtifacts.dockerContainers = append(specArtifacts.dockerContainers, name)
+}
+
+// ArtifactsFailHandler returns a fail handler that collects the artifacts
+// of the failing spec and adds their directory to the failure message
+// before calling fail
+func ArtifactsFailHandler(fail func(message string, callerSkip ...int)) func(message string, callerSkip ...int) {
+	return func(message string, callerSkip ...int) {
+		skip := 1
+		if len(callerSkip) > 0 {
+			skip += callerSkip[0]
+		}
+
+		dir, err := CollectArtifacts(ginkgo.CurrentGinkgoTestDescription().FullTestText)
+		if err != nil {
+			message = fmt.Sprintf("%s\ncould not collect the artifacts: %v", message, err)
+		} else {
+			message = fmt.Sprintf("%s\nartifacts saved in %s", message, dir)
+		}
+
+		message = fmt.Sprintf("%s\nrandom seed %d of node %d, rerun with -ginkgo.seed=%d to get the same IDs",
+			message, RandomSeed(), ParallelNode(), config.GinkgoConfig.RandomSeed)
+
+		fail(message, skip)
+	}
+}
+
+// CollectArtifacts saves in a new directory of ArtifactsDir, or of a
+// temporary directory if ArtifactsDir is empty, the information that
+// helps debugging a failure of the spec called name: the runtime logs,
+// the bundle configs, the docker containers information, the command
+// lines of the components, the journal and the kernel logs. It returns
+// the directory.
+func CollectArtifacts(name string) (string, error) {
+	specArtifacts.Lock()
+	defer specArtifacts.Unlock()
+
+	root := ArtifactsDir
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "artifacts")
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+
+	prefix := strings.Trim(specNameRegexp.ReplaceAllString(name, "_"), "_")
+	if len(prefix) > 100 {
+		prefix = prefix[:100]
+	}
+
+	dir, err := ioutil.TempDir(root, prefix+"-")
+	if err != nil {
+		return "", err
+	}
+
+	a := &artifactWriter{dir: dir}
+
+	for _, c := range specArtifacts.containers {
+		a.collectContainer(c)
+	}
+
+	for _, name := range specArtifacts.dockerContainers {
+		a.collectDockerContainer(name)
+	}
+
+	a.collectHost(specArtifacts.start)
+
+	if len(a.errs) > 0 {
+		a.write("errors.txt", []byte(strings.Join(a.errs, "\n")+"\n"))
+	}
+
+	return dir, nil
+}
+
+// artifactWriter writes the artifacts in dir, the failures are recorded
+// and collection goes on
+type artifactWriter struct {
+	dir  string
+	errs []string
+}
+
+func (a *artifactWriter) errorf(format string, args ...interface{}) {
+	a.errs = append(a.errs, fmt.Sprintf(format, args...))
+}
+
+func (a *artifactWriter) write(name string, content []byte) {
+	path := filepath.Join(a.dir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		a.errorf("%s: %v", name, err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		a.errorf("%s: %v", name, err)
+	}
+}
+
+func (a *artifactWriter) copy(name, path string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		a.errorf("%s: %v", name, err)
+		return
+	}
+
+	a.write(name, content)
+}
+
+// command saves the output of a command, it is not run through Command
+// to keep it out of the spec logs
+func (a *artifactWriter) command(name, path string, args ...string) {
+	var out bytes.Buffer
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Start(); err != nil {
+		a.errorf("%s: %v", name, err)
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			a.errorf("%s: %v", name, err)
+		}
+	case <-time.After(artifactsCommandTimeout):
+		cmd.Process.Kill()
+		<-done
+		a.errorf("%s: timeout reached after %s", name, artifactsCommandTimeout)
+	}
+
+	a.write(name, out.Bytes())
+}
+
+func (a *artifactWriter) collectContainer(c *Container) {
+	if c.ID == nil {
+		return
+	}
+
+	dir := filepath.Join("containers", *c.ID)
+
+	if c.LogFile != nil {
+		a.copy(filepath.Join(dir, "runtime.log"), *c.LogFile)
+	}
+
+	if c.Bundle != nil {
+		a.copy(filepath.Join(dir, "config.json"), filepath.Join(c.Bundle.Path, "config.json"))
+	}
+
+	a.command(filepath.Join(dir, "state.json"), Runtime, "state", *c.ID)
+	a.collectComponents(dir, *c.ID)
+}
+
+func (a *artifactWriter) collectDockerContainer(name string) {
+	dir := filepath.Join("docker", name)
+
+	a.command(filepath.Join(dir, "inspect.json"), Docker, "inspect", name)
+	a.command(filepath.Join(dir, "logs.txt"), Docker, "logs", name)
+
+	c, err := CurrentDockerBackend().Inspect(name)
+	if err != nil {
+		a.errorf("%s: %v", name, err)
+		return
+	}
+
+	a.collectComponents(dir, c.ID)
+}
+
+// collectComponents saves the command lines of the processes of the
+// components of containerID
+func (a *artifactWriter) collectComponents(dir, containerID string) {
+	components, err := FindComponents(containerID)
+	if err != nil {
+		a.errorf("%s components: %v", containerID, err)
+		return
+	}
+
+	var content bytes.Buffer
+	for _, p := range components.All() {
+		fmt.Fprintf(&content, "%s %d (parent %d): %s\n", p.Component, p.PID, p.PPID, strings.Join(p.Cmdline, " "))
+	}
+
+	a.write(filepath.Join(dir, "components.txt"), content.Bytes())
+}
+
+func (a *artifactWriter) collectHost(start time.Time) {
+	hypervisors, err := listHypervisors()
+	if err != nil {
+		a.errorf("hypervisors: %v", err)
+	}
+	a.write("hypervisors.txt", []byte(strings.Join(hypervisors, "\n")+"\n"))
+
+	since := fmt.Sprintf("--since=@%d", start.Unix())
+
+	journalArgs := []string{"--no-pager", "-o", "short-precise", since}
+	for _, id := range []string{filepath.Base(Runtime), ShimName, ProxyName} {
+		journalArgs = append(journalArgs, "-t", id)
+	}
+
+	a.command("journal.txt", "journalctl", journalArgs...)
+	a.command("journal-docker.txt", "journalctl", "--no-pager", "-o", "short-precise", since, "-u", "docker")
+	a.command("dmesg.txt", "dmesg")
+}
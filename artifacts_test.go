@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(dir, runtime string) {
+		ArtifactsDir = dir
+		Runtime = runtime
+	}(ArtifactsDir, Runtime)
+
+	ArtifactsDir = root
+	Runtime = "true"
+
+	bundle := filepath.Join(root, "bundle")
+	if err := os.Mkdir(bundle, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"config.json": `{"ociVersion": "1.0.0"}`,
+		"log":         "runtime debug log",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(bundle, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id := "artifacts-test"
+	logFile := filepath.Join(bundle, "log")
+
+	StartSpecArtifacts()
+	TrackContainer(&Container{
+		Bundle:  &Bundle{Path: bundle},
+		LogFile: &logFile,
+		ID:      &id,
+	})
+
+	dir, err := CollectArtifacts("container [run] should/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(dir) != root {
+		t.Errorf("artifacts directory %s is not in %s", dir, root)
+	}
+
+	if !strings.HasPrefix(filepath.Base(dir), "container_run_should_work-") {
+		t.Errorf("unexpected artifacts directory name %s", filepath.Base(dir))
+	}
+
+	assertContent(t, filepath.Join(dir, "containers", id, "runtime.log"), files["log"])
+	assertContent(t, filepath.Join(dir, "containers", id, "config.json"), files["config.json"])
+
+	for _, name := range []string{"hypervisors.txt", "dmesg.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	StartSpecArtifacts()
+}
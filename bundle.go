@@ -15,24 +15,16 @@
 package tests
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	spec "github.com/opencontainers/specs/specs-go"
 )
 
-const image = "busybox"
-
-const tmpDir = "/tmp"
-
-const configTemplate = "src/github.com/clearcontainers/tests/data/config.json"
-
 // Bundle represents the root directory where config.json and rootfs are
 type Bundle struct {
 	// Config represents the config.json
@@ -42,51 +34,55 @@ type Bundle struct {
 	Path string
 }
 
-// NewBundle creates a new bundle
-func NewBundle(workload []string) (*Bundle, error) {
-	path, err := ioutil.TempDir(tmpDir, "bundle")
+// NewBundle creates a new bundle whose rootfs is provided by rootfs,
+// if rootfs is nil DefaultRootfs() is used
+func NewBundle(workload []string, rootfs RootfsSource) (*Bundle, error) {
+	if rootfs == nil {
+		var err error
+		if rootfs, err = DefaultRootfs(); err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := ioutil.TempDir(TempRoot(), "bundle")
 	if err != nil {
 		return nil, err
 	}
 
-	if err := createRootfs(path); err != nil {
+	if err := createRootfs(path, rootfs); err != nil {
+		os.RemoveAll(path)
 		return nil, err
 	}
 
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" {
-		return nil, fmt.Errorf("GOPATH is not set")
+	bundle := &Bundle{
+		Path: path,
 	}
 
-	configTemplatePath := filepath.Join(gopath, configTemplate)
-	content, err := ioutil.ReadFile(configTemplatePath)
-	if err != nil {
+	if err := bundle.loadConfig(workload); err != nil {
+		bundle.Remove()
 		return nil, err
 	}
 
-	var config spec.Spec
-	err = json.Unmarshal(content, &config)
+	return bundle, nil
+}
+
+// loadConfig loads the bundles config, adjusted for the runtime under
+// test, and saves it with workload as the process arguments
+func (b *Bundle) loadConfig(workload []string) error {
+	config, err := LoadSpec()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	config.Process.Args = workload
+	CurrentRuntimeDriver().AdjustSpec(config)
+	b.Config = config
 
-	bundle := &Bundle{
-		Path:   path,
-		Config: &config,
-	}
-
-	err = bundle.Save()
-	if err != nil {
-		return nil, err
-	}
-
-	return bundle, nil
+	return b.Save()
 }
 
-// createRootfs creates a rootfs in the specific bundlePath
-func createRootfs(bundlePath string) error {
+// createRootfs creates a rootfs in the specific bundlePath from source
+func createRootfs(bundlePath string, source RootfsSource) error {
 	if bundlePath == "" {
 		return fmt.Errorf("bundle path should not be empty")
 	}
@@ -96,45 +92,257 @@ func createRootfs(bundlePath string) error {
 		return err
 	}
 
-	// create container
-	var container bytes.Buffer
-	createCmd := exec.Command("docker", "create", image)
-	createCmd.Stdout = &container
-	if err := createCmd.Run(); err != nil {
-		return err
+	if !UseRootfsCache {
+		return source.Extract(rootfsDir)
 	}
-	containerName := strings.TrimRight(container.String(), "\n")
 
-	// export container
-	tarFile, err := ioutil.TempFile(tmpDir, "tar")
+	cache, err := DefaultRootfsCache()
 	if err != nil {
 		return err
 	}
-	defer tarFile.Close()
 
-	exportCmd := exec.Command("docker", "export", "-o", tarFile.Name(), containerName)
-	if err := exportCmd.Run(); err != nil {
-		return err
+	return cache.View(source, rootfsDir)
+}
+
+// WithEnv sets environment variables of the process, variables already
+// defined are replaced
+func (b *Bundle) WithEnv(env ...string) *Bundle {
+	for _, e := range env {
+		key := strings.SplitN(e, "=", 2)[0] + "="
+		replaced := false
+
+		for i, current := range b.Config.Process.Env {
+			if strings.HasPrefix(current, key) {
+				b.Config.Process.Env[i] = e
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			b.Config.Process.Env = append(b.Config.Process.Env, e)
+		}
 	}
-	defer os.Remove(tarFile.Name())
 
-	// extract container
-	tarCmd := exec.Command("tar", "-C", rootfsDir, "-pxf", tarFile.Name())
-	if err := tarCmd.Run(); err != nil {
-		return err
+	return b
+}
+
+// WithCwd sets the working directory of the process
+func (b *Bundle) WithCwd(cwd string) *Bundle {
+	b.Config.Process.Cwd = cwd
+	return b
+}
+
+// WithUser sets the user and groups of the process
+func (b *Bundle) WithUser(uid, gid uint32, additionalGids ...uint32) *Bundle {
+	b.Config.Process.User = spec.User{
+		UID:            uid,
+		GID:            gid,
+		AdditionalGids: additionalGids,
 	}
+	return b
+}
 
-	// remove container
-	rmCmd := exec.Command("docker", "rm", "-f", containerName)
-	if err := rmCmd.Run(); err != nil {
-		return err
+// WithMount adds a mount, replacing any mount with the same destination
+func (b *Bundle) WithMount(mount spec.Mount) *Bundle {
+	for i, m := range b.Config.Mounts {
+		if m.Destination == mount.Destination {
+			b.Config.Mounts[i] = mount
+			return b
+		}
+	}
+
+	b.Config.Mounts = append(b.Config.Mounts, mount)
+	return b
+}
+
+// WithCapabilities sets the bounding, effective, inheritable and permitted
+// capabilities of the process
+func (b *Bundle) WithCapabilities(caps ...string) *Bundle {
+	b.Config.Process.Capabilities = &spec.LinuxCapabilities{
+		Bounding:    caps,
+		Effective:   caps,
+		Inheritable: caps,
+		Permitted:   caps,
+	}
+	return b
+}
+
+// WithRlimit sets a resource limit of the process, e.g. RLIMIT_NOFILE
+func (b *Bundle) WithRlimit(rlimit string, hard, soft uint64) *Bundle {
+	limit := spec.LinuxRlimit{
+		Type: rlimit,
+		Hard: hard,
+		Soft: soft,
+	}
+
+	for i, r := range b.Config.Process.Rlimits {
+		if r.Type == rlimit {
+			b.Config.Process.Rlimits[i] = limit
+			return b
+		}
+	}
+
+	b.Config.Process.Rlimits = append(b.Config.Process.Rlimits, limit)
+	return b
+}
+
+// WithHostname sets the hostname of the container
+func (b *Bundle) WithHostname(hostname string) *Bundle {
+	b.Config.Hostname = hostname
+	return b
+}
+
+// WithReadonlyRoot sets whether the rootfs is read-only
+func (b *Bundle) WithReadonlyRoot(readonly bool) *Bundle {
+	b.Config.Root.Readonly = readonly
+	return b
+}
+
+// WithNamespaces sets the namespaces of the container
+func (b *Bundle) WithNamespaces(namespaces ...spec.LinuxNamespace) *Bundle {
+	b.linux().Namespaces = namespaces
+	return b
+}
+
+// WithResources sets the resources of the container
+func (b *Bundle) WithResources(resources *spec.LinuxResources) *Bundle {
+	b.linux().Resources = resources
+	return b
+}
+
+// WithAnnotations adds annotations to the container
+func (b *Bundle) WithAnnotations(annotations map[string]string) *Bundle {
+	if b.Config.Annotations == nil {
+		b.Config.Annotations = make(map[string]string)
+	}
+
+	for k, v := range annotations {
+		b.Config.Annotations[k] = v
+	}
+
+	return b
+}
+
+func (b *Bundle) linux() *spec.Linux {
+	if b.Config.Linux == nil {
+		b.Config.Linux = &spec.Linux{}
+	}
+
+	return b.Config.Linux
+}
+
+// Validate checks the Config is a valid OCI spec
+func (b *Bundle) Validate() error {
+	if b.Config == nil {
+		return fmt.Errorf("bundle has no config")
+	}
+
+	c := b.Config
+	var errs []string
+
+	if c.Version == "" {
+		errs = append(errs, "ociVersion is empty")
+	}
+
+	if c.Root.Path == "" {
+		errs = append(errs, "root path is empty")
+	}
+
+	if !filepath.IsAbs(c.Process.Cwd) {
+		errs = append(errs, fmt.Sprintf("cwd '%s' is not an absolute path", c.Process.Cwd))
+	}
+
+	for _, e := range c.Process.Env {
+		if !strings.Contains(e, "=") || strings.HasPrefix(e, "=") {
+			errs = append(errs, fmt.Sprintf("env '%s' is not in the form KEY=value", e))
+		}
+	}
+
+	for _, m := range c.Mounts {
+		if !filepath.IsAbs(m.Destination) {
+			errs = append(errs, fmt.Sprintf("mount destination '%s' is not an absolute path", m.Destination))
+		}
+	}
+
+	rlimits := make(map[string]bool)
+	for _, r := range c.Process.Rlimits {
+		if !strings.HasPrefix(r.Type, "RLIMIT_") {
+			errs = append(errs, fmt.Sprintf("invalid rlimit '%s'", r.Type))
+		}
+
+		if rlimits[r.Type] {
+			errs = append(errs, fmt.Sprintf("duplicated rlimit '%s'", r.Type))
+		}
+		rlimits[r.Type] = true
+
+		if r.Soft > r.Hard {
+			errs = append(errs, fmt.Sprintf("soft limit of '%s' is greater than its hard limit", r.Type))
+		}
+	}
+
+	if caps := c.Process.Capabilities; caps != nil {
+		for _, set := range [][]string{caps.Bounding, caps.Effective, caps.Inheritable, caps.Permitted, caps.Ambient} {
+			for _, capability := range set {
+				if !strings.HasPrefix(capability, "CAP_") {
+					errs = append(errs, fmt.Sprintf("invalid capability '%s'", capability))
+				}
+			}
+		}
+	}
+
+	if c.Linux != nil {
+		errs = append(errs, validateNamespaces(c)...)
+
+		if r := c.Linux.Resources; r != nil {
+			if r.Memory != nil && r.Memory.Limit != nil && *r.Memory.Limit == 0 {
+				errs = append(errs, "memory limit is 0")
+			}
+
+			if r.CPU != nil && r.CPU.Quota != nil && *r.CPU.Quota > 0 && (r.CPU.Period == nil || *r.CPU.Period == 0) {
+				errs = append(errs, "cpu quota requires a cpu period")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, ", "))
 	}
 
 	return nil
 }
 
-// Save to disk the Config
+func validateNamespaces(c *spec.Spec) []string {
+	var errs []string
+
+	namespaces := make(map[spec.LinuxNamespaceType]bool)
+	for _, ns := range c.Linux.Namespaces {
+		switch ns.Type {
+		case spec.PIDNamespace, spec.NetworkNamespace, spec.MountNamespace,
+			spec.IPCNamespace, spec.UTSNamespace, spec.UserNamespace, spec.CgroupNamespace:
+		default:
+			errs = append(errs, fmt.Sprintf("invalid namespace '%s'", ns.Type))
+		}
+
+		if namespaces[ns.Type] {
+			errs = append(errs, fmt.Sprintf("duplicated namespace '%s'", ns.Type))
+		}
+		namespaces[ns.Type] = true
+	}
+
+	if c.Hostname != "" && !namespaces[spec.UTSNamespace] {
+		errs = append(errs, "hostname requires an uts namespace")
+	}
+
+	return errs
+}
+
+// Save validates and writes to disk the Config
 func (b *Bundle) Save() error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+
 	content, err := json.Marshal(b.Config)
 	if err != nil {
 		return err
@@ -151,5 +359,12 @@ func (b *Bundle) Save() error {
 
 // Remove the bundle files and directories
 func (b *Bundle) Remove() error {
+	// the views of a cache already cleaned up are released
+	if cache := currentRootfsCache(); cache != nil {
+		if err := cache.Release(filepath.Join(b.Path, "rootfs")); err != nil {
+			return err
+		}
+	}
+
 	return os.RemoveAll(b.Path)
 }
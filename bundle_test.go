@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/opencontainers/specs/specs-go"
+)
+
+func newTestBundle(t *testing.T) *Bundle {
+	path, err := ioutil.TempDir("", "bundle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Bundle{
+		Path: path,
+		Config: &spec.Spec{
+			Version: spec.Version,
+			Root:    spec.Root{Path: "rootfs"},
+			Process: spec.Process{
+				Args: []string{"sh"},
+				Cwd:  "/",
+				Env:  []string{"PATH=/bin", "TERM=xterm"},
+			},
+			Linux: &spec.Linux{
+				Namespaces: []spec.LinuxNamespace{{Type: spec.UTSNamespace}},
+			},
+		},
+	}
+}
+
+func TestBundleBuilder(t *testing.T) {
+	b := newTestBundle(t)
+	defer os.RemoveAll(b.Path)
+
+	err := b.WithEnv("TERM=vt100", "FOO=bar").
+		WithCwd("/tmp").
+		WithUser(1000, 1000, 10).
+		WithMount(spec.Mount{Destination: "/data", Type: "tmpfs", Source: "tmpfs"}).
+		WithCapabilities("CAP_NET_ADMIN").
+		WithRlimit("RLIMIT_NOFILE", 1024, 512).
+		WithHostname("builder").
+		WithReadonlyRoot(true).
+		WithAnnotations(map[string]string{"key": "value"}).
+		Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(b.Path, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config spec.Spec
+	if err := json.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	env := config.Process.Env
+	if len(env) != 3 || env[1] != "TERM=vt100" || env[2] != "FOO=bar" {
+		t.Errorf("unexpected env %v", env)
+	}
+
+	if config.Process.Cwd != "/tmp" || config.Process.User.UID != 1000 || len(config.Process.User.AdditionalGids) != 1 {
+		t.Errorf("unexpected process %+v", config.Process)
+	}
+
+	if len(config.Mounts) != 1 || config.Mounts[0].Destination != "/data" {
+		t.Errorf("unexpected mounts %+v", config.Mounts)
+	}
+
+	if config.Process.Capabilities == nil || config.Process.Capabilities.Effective[0] != "CAP_NET_ADMIN" {
+		t.Errorf("unexpected capabilities %+v", config.Process.Capabilities)
+	}
+
+	if config.Hostname != "builder" || !config.Root.Readonly || config.Annotations["key"] != "value" {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestBundleValidate(t *testing.T) {
+	invalid := []func(b *Bundle){
+		func(b *Bundle) { b.WithCwd("relative") },
+		func(b *Bundle) { b.WithEnv("NOVALUE") },
+		func(b *Bundle) { b.WithMount(spec.Mount{Destination: "relative"}) },
+		func(b *Bundle) { b.WithCapabilities("NET_ADMIN") },
+		func(b *Bundle) { b.WithRlimit("NOFILE", 1, 1) },
+		func(b *Bundle) { b.WithRlimit("RLIMIT_NOFILE", 1, 2) },
+		func(b *Bundle) { b.WithNamespaces(spec.LinuxNamespace{Type: "foo"}) },
+		func(b *Bundle) {
+			b.WithNamespaces(spec.LinuxNamespace{Type: spec.PIDNamespace}).WithHostname("no-uts")
+		},
+		func(b *Bundle) {
+			b.WithNamespaces(spec.LinuxNamespace{Type: spec.PIDNamespace}, spec.LinuxNamespace{Type: spec.PIDNamespace})
+		},
+	}
+
+	b := newTestBundle(t)
+	defer os.RemoveAll(b.Path)
+
+	if err := b.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, f := range invalid {
+		b := newTestBundle(t)
+		defer os.RemoveAll(b.Path)
+
+		f(b)
+
+		if err := b.Save(); err == nil {
+			t.Errorf("case %d: expected an invalid config", i)
+		}
+	}
+}
+
+func TestBundleRemoveAfterCacheCleanup(t *testing.T) {
+	if err := CleanupRootfsCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestBundle(t)
+	defer os.RemoveAll(b.Path)
+
+	if err := b.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if currentRootfsCache() != nil {
+		t.Error("removing a bundle should not create a rootfs cache")
+	}
+
+	assertNotExist(t, b.Path)
+}
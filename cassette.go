@@ -0,0 +1,330 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CassetteRecord is the mode of a cassette that records the commands
+	CassetteRecord = "record"
+
+	// CassetteReplay is the mode of a cassette that replays the commands
+	// instead of running them
+	CassetteReplay = "replay"
+)
+
+// DockerCassette is the cassette file where the docker commands are
+// recorded or replayed from, no cassette is used if empty
+var DockerCassette string
+
+// DockerCassetteMode is CassetteRecord or CassetteReplay
+var DockerCassetteMode string
+
+var (
+	cassette     *Cassette
+	cassetteLock sync.Mutex
+)
+
+// CassetteInteraction is a command recorded in a cassette
+type CassetteInteraction struct {
+	Args     []string `json:"args"`
+	Stdin    string   `json:"stdin,omitempty"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exit_code"`
+	TimedOut bool     `json:"timed_out,omitempty"`
+	Duration float64  `json:"duration"`
+}
+
+// Cassette records the commands run by the helpers, with their input
+// and their results, and replays them without running anything. The
+// file of a cassette has a JSON interaction per line.
+type Cassette struct {
+	// Path of the cassette file, the interactions are only kept in
+	// memory if empty
+	Path string
+
+	// Mode is CassetteRecord or CassetteReplay
+	Mode string
+
+	// Programs are the names of the commands handled by the cassette
+	Programs []string
+
+	lock         sync.Mutex
+	interactions []CassetteInteraction
+	played       []bool
+}
+
+// NewCassette returns a cassette handling the commands of programs,
+// a cassette to record truncates path, a cassette to replay reads it
+func NewCassette(path, mode string, programs ...string) (*Cassette, error) {
+	c := &Cassette{
+		Path:     path,
+		Mode:     mode,
+		Programs: programs,
+	}
+
+	if path == "" {
+		return c, nil
+	}
+
+	switch mode {
+	case CassetteRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return c, f.Close()
+	case CassetteReplay:
+		return c, c.load()
+	}
+
+	return nil, fmt.Errorf("unknown cassette mode '%s', expected %s or %s", mode, CassetteRecord, CassetteReplay)
+}
+
+func (c *Cassette) load() error {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var i CassetteInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return fmt.Errorf("invalid interaction in %s line %d: %v", c.Path, line, err)
+		}
+
+		c.interactions = append(c.interactions, i)
+		c.played = append(c.played, false)
+	}
+
+	return scanner.Err()
+}
+
+// Add appends i to the cassette, and to its file if any
+func (c *Cassette) Add(i CassetteInteraction) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.interactions = append(c.interactions, i)
+	c.played = append(c.played, false)
+
+	if c.Path == "" || c.Mode != CassetteRecord {
+		return nil
+	}
+
+	content, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Interactions returns the interactions of the cassette
+func (c *Cassette) Interactions() []CassetteInteraction {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]CassetteInteraction{}, c.interactions...)
+}
+
+// Unplayed returns the interactions not replayed yet
+func (c *Cassette) Unplayed() []CassetteInteraction {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var unplayed []CassetteInteraction
+	for i, played := range c.played {
+		if !played {
+			unplayed = append(unplayed, c.interactions[i])
+		}
+	}
+
+	return unplayed
+}
+
+// handles returns true if the command args is recorded or replayed
+func (c *Cassette) handles(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	for _, p := range c.Programs {
+		if filepath.Base(args[0]) == filepath.Base(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replay returns the result of the first interaction not replayed yet
+// with the same arguments and input, the interactions of a command run
+// several times are replayed in the order they were recorded. The values
+// of the volatileOptions are ignored.
+func (c *Cassette) replay(args []string, stdin string) Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for n, i := range c.interactions {
+		if c.played[n] || i.Stdin != stdin || !reflect.DeepEqual(cassetteArgs(i.Args), cassetteArgs(args)) {
+			continue
+		}
+
+		c.played[n] = true
+
+		return Result{
+			Stdout:   i.Stdout,
+			Stderr:   i.Stderr,
+			ExitCode: i.ExitCode,
+			TimedOut: i.TimedOut,
+			Duration: time.Duration(i.Duration * float64(time.Second)),
+		}
+	}
+
+	err := fmt.Errorf("no interaction left for %v in cassette %s", args, c.Path)
+
+	return Result{
+		Stderr:   err.Error(),
+		ExitCode: -1,
+		Err:      err,
+	}
+}
+
+// volatileOptions are the options whose values change on each run
+var volatileOptions = []string{"--since", "--until"}
+
+// cassetteTempPath replaces the paths under the temporary directory,
+// whose names are random, in the arguments matched by a cassette
+const cassetteTempPath = "$TMPDIR/*"
+
+// cassetteArgs returns args without the values of the volatileOptions
+// and with the paths under the temporary directory, TempRoot included,
+// replaced by cassetteTempPath
+func cassetteArgs(args []string) []string {
+	a := make([]string, 0, len(args))
+	tempPath := regexp.MustCompile(regexp.QuoteMeta(filepath.Clean(os.TempDir())) + `/[^\s:,=]*`)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		for _, option := range volatileOptions {
+			if arg == option && i+1 < len(args) {
+				// the value is the next argument
+				i++
+				arg = option + "=*"
+			} else if strings.HasPrefix(arg, option+"=") {
+				arg = option + "=*"
+			}
+		}
+
+		a = append(a, tempPath.ReplaceAllLiteralString(arg, cassetteTempPath))
+	}
+
+	return a
+}
+
+// record adds the result of the command args to the cassette
+func (c *Cassette) record(args []string, stdin string, result Result) {
+	err := c.Add(CassetteInteraction{
+		Args:     args,
+		Stdin:    stdin,
+		Stdout:   result.Stdout,
+		Stderr:   result.Stderr,
+		ExitCode: result.ExitCode,
+		TimedOut: result.TimedOut,
+		Duration: result.Duration.Seconds(),
+	})
+	if err != nil {
+		LogIfFail("could not record %v in cassette %s: %v\n", args, c.Path, err)
+	}
+}
+
+// UseCassette makes the commands handled by c recorded in, or replayed
+// from, c. A nil cassette runs the commands normally.
+func UseCassette(c *Cassette) {
+	cassetteLock.Lock()
+	defer cassetteLock.Unlock()
+
+	cassette = c
+}
+
+// CurrentCassette returns the cassette in use, nil if none
+func CurrentCassette() *Cassette {
+	cassetteLock.Lock()
+	defer cassetteLock.Unlock()
+
+	return cassette
+}
+
+// openDockerCassette uses the cassette given by DockerCassette for the
+// docker commands
+func openDockerCassette() error {
+	if DockerCassette == "" {
+		UseCassette(nil)
+		return nil
+	}
+
+	// the requests of the api backend do not run docker
+	if DockerCassetteMode == CassetteReplay && DockerBackendName == DockerAPIBackend {
+		return fmt.Errorf("the %s docker backend cannot be replayed from a cassette, use the %s backend",
+			DockerAPIBackend, DockerCLIBackend)
+	}
+
+	c, err := NewCassette(DockerCassette, DockerCassetteMode, Docker)
+	if err != nil {
+		return err
+	}
+
+	UseCassette(c)
+
+	return nil
+}
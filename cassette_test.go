@@ -0,0 +1,226 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cassettes", "sh.jsonl")
+	marker := filepath.Join(dir, "marker")
+	script := "touch " + marker + "; cat; echo error >&2; exit 3"
+
+	recorder, err := NewCassette(path, CassetteRecord, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UseCassette(recorder)
+	defer UseCassette(nil)
+
+	stdout, stderr, exitCode := NewCommand("sh", "-c", script).RunWithPipe(bytes.NewBufferString("input"))
+	if stdout != "input" || stderr != "error\n" || exitCode != 3 {
+		t.Fatalf("unexpected result '%s' '%s' %d", stdout, stderr, exitCode)
+	}
+
+	// only the commands of the cassette programs are recorded
+	NewCommand("true").Run()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 1 {
+		t.Fatalf("expected 1 interaction, got %v", lines)
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := NewCassette(path, CassetteReplay, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UseCassette(player)
+
+	var live bytes.Buffer
+	cmd := NewCommand("sh", "-c", script)
+	cmd.Stdout = &live
+
+	stdout, stderr, exitCode = cmd.RunWithPipe(bytes.NewBufferString("input"))
+	if stdout != "input" || stderr != "error\n" || exitCode != 3 {
+		t.Errorf("unexpected replayed result '%s' '%s' %d", stdout, stderr, exitCode)
+	}
+
+	if live.String() != "input" {
+		t.Errorf("the replayed output should be streamed, got '%s'", live.String())
+	}
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("a replayed command should not run")
+	}
+
+	if len(player.Unplayed()) != 0 {
+		t.Errorf("unexpected unplayed interactions %v", player.Unplayed())
+	}
+
+	// the interaction was consumed and the input must match
+	if _, _, exitCode := NewCommand("sh", "-c", script).RunWithPipe(bytes.NewBufferString("input")); exitCode != -1 {
+		t.Errorf("expected exit code -1 once the cassette is played, got %d", exitCode)
+	}
+}
+
+func TestNewCassetteMode(t *testing.T) {
+	if _, err := NewCassette("/nonexistent/cassette", CassetteReplay); err == nil {
+		t.Error("expected an error replaying a missing cassette")
+	}
+
+	if _, err := NewCassette("cassette", "rewind"); err == nil {
+		t.Error("expected an error with an unknown mode")
+	}
+}
+
+func TestDockerHelpersWithCassette(t *testing.T) {
+	inspect := []string{Docker, "inspect", "--type=container", "foo"}
+
+	c, err := NewCassette("", CassetteReplay, Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []CassetteInteraction{
+		{
+			Args:   []string{Docker, "ps", "--no-trunc", "--format", "{{json .}}", "-a", "-f", "name=foo"},
+			Stdout: `{"ID":"1234","Names":"foo","Image":"busybox","State":"exited","Status":"Exited (42) 2 seconds ago"}` + "\n",
+		},
+		{
+			Args:   inspect,
+			Stdout: `[{"Id":"1234","Name":"/foo","State":{"Status":"running","Running":true}}]`,
+		},
+		{
+			// the value of --since changes on each run
+			Args:   []string{Docker, "events", "--format", "{{json .}}", "--since=1500000000.000000000", "--filter", "container=foo"},
+			Stdout: `{"Type":"container","Action":"die","Actor":{"ID":"1234","Attributes":{"name":"foo","exitCode":"42"}}}` + "\n",
+		},
+		{
+			Args:   inspect,
+			Stdout: `[{"Id":"1234","Name":"/foo","State":{"Status":"exited","ExitCode":42}}]`,
+		},
+		{
+			Args:   inspect,
+			Stdout: `[{"Id":"1234","Name":"/foo","State":{"Status":"exited","ExitCode":42}}]`,
+		},
+	} {
+		if err := c.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	UseCassette(c)
+	defer UseCassette(nil)
+
+	SetDockerBackend(&dockerCLI{})
+	defer SetDockerBackend(nil)
+
+	if status := StatusDockerContainer("foo"); status != "Exited" {
+		t.Errorf("expected status Exited, got '%s'", status)
+	}
+
+	exitCode, err := ExitCodeDockerContainer("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 42 {
+		t.Errorf("expected exit code 42, got %d", exitCode)
+	}
+
+	if unplayed := c.Unplayed(); len(unplayed) != 0 {
+		t.Errorf("unexpected unplayed interactions %v", unplayed)
+	}
+
+	if StatusDockerContainer("bar") != "" {
+		t.Error("a container missing from the cassette should have no status")
+	}
+}
+
+func TestCassetteArgs(t *testing.T) {
+	temp := filepath.Join(os.TempDir(), "export123456.tar")
+
+	for _, test := range []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			args:     []string{Docker, "logs", "--since", "1500000000", "foo"},
+			expected: []string{Docker, "logs", "--since=*", "foo"},
+		},
+		{
+			args:     []string{Docker, "export", "--output", temp, "foo"},
+			expected: []string{Docker, "export", "--output", cassetteTempPath, "foo"},
+		},
+		{
+			args:     []string{Docker, "run", "-v", filepath.Join(TempRoot(), "dir123") + ":/root", "busybox"},
+			expected: []string{Docker, "run", "-v", cassetteTempPath + ":/root", "busybox"},
+		},
+		{
+			args:     []string{Docker, "save", "--output=" + temp, "busybox"},
+			expected: []string{Docker, "save", "--output=" + cassetteTempPath, "busybox"},
+		},
+	} {
+		if args := cassetteArgs(test.args); !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, args)
+		}
+	}
+}
+
+func TestCassetteReplayUnsupported(t *testing.T) {
+	c, err := NewCassette("", CassetteReplay, "sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UseCassette(c)
+	defer UseCassette(nil)
+
+	if _, err := StartSession("sh"); err == nil {
+		t.Error("a session should not be replayed")
+	}
+
+	defer func(cassette, mode, backend string) {
+		DockerCassette, DockerCassetteMode, DockerBackendName = cassette, mode, backend
+	}(DockerCassette, DockerCassetteMode, DockerBackendName)
+
+	DockerCassette, DockerCassetteMode, DockerBackendName = "/nonexistent/cassette", CassetteReplay, DockerAPIBackend
+	if err := openDockerCassette(); err == nil {
+		t.Error("the api backend should not be replayed")
+	}
+}
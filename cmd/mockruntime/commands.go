@@ -0,0 +1,737 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	spec "github.com/opencontainers/specs/specs-go"
+	"github.com/urfave/cli"
+)
+
+// startTimeout is how long start waits for the init process
+const startTimeout = 10 * time.Second
+
+// stopTimeout is how long delete waits for the killed processes
+const stopTimeout = 10 * time.Second
+
+// detachOutputGrace is how long exec forwards the output of a detached
+// process, like the shims of the runtimes running virtual machines
+const detachOutputGrace = 500 * time.Millisecond
+
+var createFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "bundle, b",
+		Value: ".",
+		Usage: "path to the bundle of the container",
+	},
+	cli.StringFlag{
+		Name:  "console",
+		Usage: "path to a pty slave for the container process",
+	},
+	cli.StringFlag{
+		Name:  "pid-file",
+		Usage: "file where the pid of the container process is written",
+	},
+}
+
+var createCommand = cli.Command{
+	Name:      "create",
+	Usage:     "create a container",
+	ArgsUsage: "<container-id>",
+	Flags:     createFlags,
+	Action: action("create", func(ctx *cli.Context) error {
+		_, _, err := create(ctx, true)
+		return err
+	}),
+}
+
+var startCommand = cli.Command{
+	Name:      "start",
+	Usage:     "start the process of a created container",
+	ArgsUsage: "<container-id>",
+	Action: action("start", func(ctx *cli.Context) error {
+		c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		return start(c)
+	}),
+}
+
+var runCommand = cli.Command{
+	Name:      "run",
+	Usage:     "create and start a container",
+	ArgsUsage: "<container-id>",
+	Flags: append([]cli.Flag{
+		cli.BoolFlag{
+			Name:  "detach, d",
+			Usage: "do not wait for the container process",
+		},
+	}, createFlags...),
+	Action: action("run", func(ctx *cli.Context) error {
+		detach := ctx.Bool("detach")
+
+		c, cmd, err := create(ctx, detach)
+		if err != nil {
+			return err
+		}
+
+		if err := start(c); err != nil {
+			return err
+		}
+
+		if detach {
+			return nil
+		}
+
+		code, err := exitCode(cmd.Wait())
+		if err != nil {
+			return err
+		}
+
+		// like the other runtimes, an attached container is deleted
+		// once its process exits
+		if err := c.destroy(); err != nil {
+			return err
+		}
+
+		if code != 0 {
+			return exitStatus(code)
+		}
+
+		return nil
+	}),
+}
+
+var stateCommand = cli.Command{
+	Name:      "state",
+	Usage:     "print the state of a container",
+	ArgsUsage: "<container-id>",
+	Action: action("state", func(ctx *cli.Context) error {
+		c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		return printJSON(os.Stdout, c.state())
+	}),
+}
+
+var killCommand = cli.Command{
+	Name:      "kill",
+	Usage:     "send a signal to the process of a container",
+	ArgsUsage: "<container-id> [signal]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "all, a",
+			Usage: "send the signal to all the processes of the container",
+		},
+	},
+	Action: action("kill", func(ctx *cli.Context) error {
+		c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		sig := syscall.SIGTERM
+		if s := ctx.Args().Get(1); s != "" {
+			if sig, err = parseSignal(s); err != nil {
+				return err
+			}
+		}
+
+		if c.status() == statusStopped {
+			return fmt.Errorf("container %s is not running", c.ID)
+		}
+
+		return c.signal(sig, ctx.Bool("all"))
+	}),
+}
+
+var deleteCommand = cli.Command{
+	Name:      "delete",
+	Usage:     "delete a container",
+	ArgsUsage: "<container-id>",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "kill the processes of a running container",
+		},
+	},
+	Action: action("delete", func(ctx *cli.Context) error {
+		c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		status := c.status()
+		if (status == statusRunning || status == statusPaused) && !ctx.Bool("force") {
+			return fmt.Errorf("cannot delete container %s in the %s state", c.ID, status)
+		}
+
+		// kill the processes left, e.g. the init process of a created
+		// container or the processes started with exec
+		if err := c.signal(syscall.SIGKILL, true); err != nil {
+			return err
+		}
+
+		if err := c.waitStopped(stopTimeout); err != nil {
+			return err
+		}
+
+		return c.destroy()
+	}),
+}
+
+// listEntry is an entry of the list command in json format
+type listEntry struct {
+	ID          string            `json:"id"`
+	Pid         int               `json:"pid"`
+	Status      string            `json:"status"`
+	Bundle      string            `json:"bundle"`
+	Rootfs      string            `json:"rootfs"`
+	Created     time.Time         `json:"created"`
+	Owner       string            `json:"owner"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+var listCommand = cli.Command{
+	Name:  "list",
+	Usage: "list the containers",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: "table or json",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "only print the container ids",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "accepted for compatibility, all the containers are always listed",
+		},
+	},
+	Action: action("list", func(ctx *cli.Context) error {
+		containers, err := listContainers(ctx.GlobalString("root"))
+		if err != nil {
+			return err
+		}
+
+		entries := []listEntry{}
+		for _, c := range containers {
+			s := c.state()
+			entries = append(entries, listEntry{
+				ID:          c.ID,
+				Pid:         s.Pid,
+				Status:      s.Status,
+				Bundle:      c.Bundle,
+				Rootfs:      c.Rootfs,
+				Created:     c.Created,
+				Owner:       c.Owner,
+				Annotations: c.Annotations,
+			})
+		}
+
+		if ctx.Bool("quiet") {
+			for _, e := range entries {
+				fmt.Println(e.ID)
+			}
+			return nil
+		}
+
+		switch ctx.String("format") {
+		case "json":
+			return printJSON(os.Stdout, entries)
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+			fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", e.ID, e.Pid, e.Status,
+					e.Bundle, e.Created.Format(time.RFC3339Nano), e.Owner)
+			}
+			return w.Flush()
+		}
+
+		return fmt.Errorf("invalid format '%s'", ctx.String("format"))
+	}),
+}
+
+var execCommand = cli.Command{
+	Name:      "exec",
+	Usage:     "run a new process in a container",
+	ArgsUsage: "<container-id> [command [args...]]",
+	// the options of the process must not be parsed as exec options
+	SkipArgReorder: true,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "console",
+			Usage: "path to a pty slave for the process",
+		},
+		cli.BoolFlag{
+			Name:  "tty, t",
+			Usage: "allocate a terminal",
+		},
+		cli.BoolFlag{
+			Name:  "detach, d",
+			Usage: "do not wait for the process",
+		},
+		cli.StringFlag{
+			Name:  "pid-file",
+			Usage: "file where the pid of the process is written",
+		},
+		cli.StringFlag{
+			Name:  "process, p",
+			Usage: "path to a json file with the specification of the process",
+		},
+		cli.StringFlag{
+			Name:  "cwd",
+			Usage: "working directory of the process",
+		},
+		cli.StringSliceFlag{
+			Name:  "env, e",
+			Usage: "environment variables of the process",
+		},
+	},
+	Action: action("exec", execProcess),
+}
+
+var psCommand = cli.Command{
+	Name:      "ps",
+	Usage:     "list the processes of a container",
+	ArgsUsage: "<container-id> [ps options]",
+	// the ps options are ignored, they must not be parsed as our options
+	SkipArgReorder: true,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: "table or json",
+		},
+	},
+	Action: action("ps", func(ctx *cli.Context) error {
+		c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		pids := descendants(c.pids())
+
+		switch ctx.String("format") {
+		case "json":
+			return printJSON(os.Stdout, pids)
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+			fmt.Fprint(w, "PID\tPPID\tCMD\n")
+			for _, pid := range pids {
+				ppid, err := parentPid(pid)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "%d\t%d\t%s\n", pid, ppid, processCmdline(pid))
+			}
+			return w.Flush()
+		}
+
+		return fmt.Errorf("invalid format '%s'", ctx.String("format"))
+	}),
+}
+
+var pauseCommand = cli.Command{
+	Name:      "pause",
+	Usage:     "suspend the processes of a container",
+	ArgsUsage: "<container-id>",
+	Action: action("pause", func(ctx *cli.Context) error {
+		return setPaused(ctx, true)
+	}),
+}
+
+var resumeCommand = cli.Command{
+	Name:      "resume",
+	Usage:     "resume the processes of a paused container",
+	ArgsUsage: "<container-id>",
+	Action: action("resume", func(ctx *cli.Context) error {
+		return setPaused(ctx, false)
+	}),
+}
+
+var initCommand = cli.Command{
+	Name:      "init",
+	Usage:     "internal command that waits for start and runs the container process",
+	ArgsUsage: "<container-id>",
+	Hidden:    true,
+	Action:    action("init", initProcess),
+}
+
+// create creates the container and its init process, the init process
+// is attached to the stdio of the runtime unless detach is true
+func create(ctx *cli.Context, detach bool) (*container, *exec.Cmd, error) {
+	root, err := filepath.Abs(ctx.GlobalString("root"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := newContainer(root, ctx.Args().First(), ctx.String("bundle"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd, err := startInit(ctx, c, detach)
+	if err != nil {
+		c.destroy()
+		return nil, nil, err
+	}
+
+	if err := writePidFile(ctx.String("pid-file"), c.Pid); err != nil {
+		cmd.Process.Kill()
+		c.destroy()
+		return nil, nil, err
+	}
+
+	return c, cmd, nil
+}
+
+// startInit starts the init process of the container
+func startInit(ctx *cli.Context, c *container, detach bool) (*exec.Cmd, error) {
+	if err := syscall.Mkfifo(c.fifo(), 0600); err != nil {
+		return nil, err
+	}
+
+	// the init process reads the bundle from the state
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+
+	args := []string{"--root", c.root}
+	if log := ctx.GlobalString("log"); log != "" {
+		args = append(args, "--log", log)
+	}
+	args = append(args, "init", c.ID)
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Args[0] = os.Args[0]
+
+	console, err := setStdio(cmd, ctx.String("console"), !detach)
+	if err != nil {
+		return nil, err
+	}
+
+	// the init process leads the process group of the container
+	cmd.SysProcAttr.Setsid = true
+
+	err = cmd.Start()
+	if console != nil {
+		console.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.Pid = cmd.Process.Pid
+	if err := c.save(); err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// start unblocks the init process waiting on the exec fifo
+func start(c *container) error {
+	if status := c.status(); status != statusCreated {
+		return fmt.Errorf("cannot start container %s in the %s state", c.ID, status)
+	}
+
+	f, err := os.OpenFile(c.fifo(), os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(startTimeout)
+	buf := make([]byte, 1)
+
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			break
+		}
+
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if !processAlive(c.Pid) {
+			return fmt.Errorf("init process of container %s exited", c.ID)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout starting container %s", c.ID)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := os.Remove(c.fifo()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// initProcess waits for the start command, then replaces itself
+// with the process of the container
+func initProcess(ctx *cli.Context) error {
+	c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	s, err := c.spec()
+	if err != nil {
+		return err
+	}
+
+	p := s.Process
+
+	path, err := lookPath(p.Args[0], p.Env)
+	if err != nil {
+		return err
+	}
+
+	// blocks until start opens the other end
+	f, err := os.OpenFile(c.fifo(), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write([]byte{0}); err != nil {
+		return err
+	}
+	f.Close()
+
+	// start removes the fifo too, but it may not have done it yet
+	// when the process runs
+	if err := os.Remove(c.fifo()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Chdir(workingDir(&p, c.Bundle)); err != nil {
+		return err
+	}
+
+	if cred := credential(&p); cred != nil {
+		if err := setCredential(cred); err != nil {
+			return err
+		}
+	}
+
+	logf("container %s starts %s", c.ID, strings.Join(p.Args, " "))
+
+	return syscall.Exec(path, p.Args, p.Env)
+}
+
+// setCredential changes the user of the process
+func setCredential(cred *syscall.Credential) error {
+	groups := make([]int, len(cred.Groups))
+	for i, g := range cred.Groups {
+		groups[i] = int(g)
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		return err
+	}
+
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return err
+	}
+
+	return syscall.Setuid(int(cred.Uid))
+}
+
+// execProcess runs a process in a running container
+func execProcess(ctx *cli.Context) error {
+	c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if status := c.status(); status != statusRunning {
+		return fmt.Errorf("cannot exec in container %s in the %s state", c.ID, status)
+	}
+
+	p, err := execProcessSpec(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := processCommand(p, c.Bundle)
+	if err != nil {
+		return err
+	}
+
+	detach := ctx.Bool("detach")
+
+	console, err := setStdio(cmd, ctx.String("console"), !detach)
+	if err != nil {
+		return err
+	}
+
+	// the output of a detached process is read from a pipe that the
+	// runtime stops reading when it exits
+	var output, input *os.File
+	if detach && console == nil {
+		if output, input, err = os.Pipe(); err != nil {
+			return err
+		}
+		defer output.Close()
+
+		cmd.Stdout = input
+		cmd.Stderr = input
+	}
+
+	err = cmd.Start()
+	if console != nil {
+		console.Close()
+	}
+	if input != nil {
+		input.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writePidFile(ctx.String("pid-file"), cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+
+	if detach {
+		c.Processes = append(c.Processes, cmd.Process.Pid)
+		if err := c.save(); err != nil {
+			return err
+		}
+
+		forwardOutput(output, detachOutputGrace)
+		return nil
+	}
+
+	code, err := exitCode(cmd.Wait())
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return exitStatus(code)
+	}
+
+	return nil
+}
+
+// execProcessSpec returns the process given with --process, or the
+// process of the container with the arguments and options of exec
+func execProcessSpec(ctx *cli.Context, c *container) (*spec.Process, error) {
+	if path := ctx.String("process"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var p spec.Process
+		if err := json.NewDecoder(f).Decode(&p); err != nil {
+			return nil, fmt.Errorf("invalid process %s: %v", path, err)
+		}
+
+		return &p, nil
+	}
+
+	s, err := c.spec()
+	if err != nil {
+		return nil, err
+	}
+
+	p := s.Process
+	p.Args = ctx.Args().Tail()
+	p.Terminal = ctx.Bool("tty")
+	p.Env = append(p.Env, ctx.StringSlice("env")...)
+
+	if cwd := ctx.String("cwd"); cwd != "" {
+		p.Cwd = cwd
+	}
+
+	return &p, nil
+}
+
+// setPaused stops or continues the processes of the container
+func setPaused(ctx *cli.Context, paused bool) error {
+	c, err := loadContainer(ctx.GlobalString("root"), ctx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	expected, sig := statusRunning, syscall.SIGSTOP
+	if !paused {
+		expected, sig = statusPaused, syscall.SIGCONT
+	}
+
+	if status := c.status(); status != expected {
+		return fmt.Errorf("container %s is %s, not %s", c.ID, status, expected)
+	}
+
+	if err := c.signal(sig, true); err != nil {
+		return err
+	}
+
+	c.Paused = paused
+
+	return c.save()
+}
+
+// printJSON writes v as json in w
+func printJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// forwardOutput copies r to the standard output until r is closed or
+// timeout is reached
+func forwardOutput(r *os.File, timeout time.Duration) {
+	if r == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, r)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	spec "github.com/opencontainers/specs/specs-go"
+)
+
+const (
+	// stateFile is the file of the container directory with its state
+	stateFile = "state.json"
+
+	// execFifo is the fifo on which the init process waits to be started
+	execFifo = "exec.fifo"
+)
+
+const (
+	statusCreated = "created"
+	statusRunning = "running"
+	statusPaused  = "paused"
+	statusStopped = "stopped"
+)
+
+// container is the state of a container stored in the root directory
+type container struct {
+	ID          string            `json:"id"`
+	Pid         int               `json:"pid"`
+	Bundle      string            `json:"bundle"`
+	Rootfs      string            `json:"rootfs"`
+	Created     time.Time         `json:"created"`
+	Owner       string            `json:"owner"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Paused      bool              `json:"paused"`
+
+	// Processes are the detached processes started with exec
+	Processes []int `json:"processes,omitempty"`
+
+	root string
+}
+
+// newContainer creates the directory of the container id in root for the
+// bundle, the state is not saved until save is called
+func newContainer(root, id, bundle string) (*container, error) {
+	if id == "" {
+		return nil, fmt.Errorf("container id cannot be empty")
+	}
+
+	if strings.ContainsAny(id, "/\x00") || id == "." || id == ".." {
+		return nil, fmt.Errorf("invalid container id '%s'", id)
+	}
+
+	bundle, err := filepath.Abs(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &container{
+		ID:      id,
+		Bundle:  bundle,
+		Created: time.Now().UTC(),
+		Owner:   "root",
+		root:    root,
+	}
+
+	s, err := c.spec()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Process.Args) == 0 {
+		return nil, fmt.Errorf("process args cannot be empty")
+	}
+
+	c.Rootfs = s.Root.Path
+	if !filepath.IsAbs(c.Rootfs) {
+		c.Rootfs = filepath.Join(bundle, c.Rootfs)
+	}
+	c.Annotations = s.Annotations
+
+	if u, err := user.Current(); err == nil {
+		c.Owner = u.Username
+	}
+
+	if err := os.MkdirAll(root, 0711); err != nil {
+		return nil, err
+	}
+
+	if err := os.Mkdir(c.dir(), 0700); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("container %s already exists", id)
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// loadContainer reads the state of the container id from root
+func loadContainer(root, id string) (*container, error) {
+	if id == "" {
+		return nil, fmt.Errorf("container id cannot be empty")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(root, id, stateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("container %s does not exist", id)
+		}
+		return nil, err
+	}
+
+	c := &container{root: root}
+	if err := json.Unmarshal(content, c); err != nil {
+		return nil, fmt.Errorf("invalid state of container %s: %v", id, err)
+	}
+
+	return c, nil
+}
+
+// listContainers returns the containers of root sorted by creation time
+func listContainers(root string) ([]*container, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var containers []*container
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		c, err := loadContainer(root, e.Name())
+		if err != nil {
+			// the container is being created or deleted
+			continue
+		}
+
+		containers = append(containers, c)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Created.Before(containers[j].Created)
+	})
+
+	return containers, nil
+}
+
+// dir returns the directory of the container
+func (c *container) dir() string {
+	return filepath.Join(c.root, c.ID)
+}
+
+// fifo returns the path of the exec fifo of the container
+func (c *container) fifo() string {
+	return filepath.Join(c.dir(), execFifo)
+}
+
+// spec reads the configuration of the bundle
+func (c *container) spec() (*spec.Spec, error) {
+	content, err := ioutil.ReadFile(filepath.Join(c.Bundle, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var s spec.Spec
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("invalid configuration in bundle %s: %v", c.Bundle, err)
+	}
+
+	return &s, nil
+}
+
+// save writes the state of the container
+func (c *container) save() error {
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(c.dir(), stateFile+".tmp")
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(c.dir(), stateFile))
+}
+
+// destroy removes the state of the container
+func (c *container) destroy() error {
+	return os.RemoveAll(c.dir())
+}
+
+// status returns the status of the container, it is computed from the
+// init process and the exec fifo, which is removed once started
+func (c *container) status() string {
+	if c.Pid == 0 || !processAlive(c.Pid) {
+		return statusStopped
+	}
+
+	if _, err := os.Stat(c.fifo()); err == nil {
+		return statusCreated
+	}
+
+	if c.Paused {
+		return statusPaused
+	}
+
+	return statusRunning
+}
+
+// state returns the OCI state of the container
+func (c *container) state() spec.State {
+	status := c.status()
+
+	pid := c.Pid
+	if status == statusStopped {
+		pid = 0
+	}
+
+	return spec.State{
+		Version:     spec.Version,
+		ID:          c.ID,
+		Status:      status,
+		Pid:         pid,
+		Bundle:      c.Bundle,
+		Annotations: c.Annotations,
+	}
+}
+
+// pids returns the alive processes started by the container
+func (c *container) pids() []int {
+	var pids []int
+
+	for _, pid := range append([]int{c.Pid}, c.Processes...) {
+		if pid != 0 && processAlive(pid) {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// signal sends sig to the init process, or to all the processes of
+// the container if all is true
+func (c *container) signal(sig syscall.Signal, all bool) error {
+	if !all {
+		return syscall.Kill(c.Pid, sig)
+	}
+
+	for _, pid := range c.pids() {
+		// the processes are session leaders, the signal is sent to
+		// their process group to reach their children
+		if err := syscall.Kill(-pid, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitStopped waits until all the processes of the container are gone
+func (c *container) waitStopped(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for len(c.pids()) > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for the processes of container %s", c.ID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBundle(t *testing.T, dir string) string {
+	bundle := filepath.Join(dir, "bundle")
+	if err := os.MkdirAll(filepath.Join(bundle, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := `{"ociVersion": "1.0.0-rc5", "process": {"args": ["sleep", "60"], "cwd": "/"},
+		"root": {"path": "rootfs"}, "annotations": {"key": "value"}}`
+	if err := ioutil.WriteFile(filepath.Join(bundle, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return bundle
+}
+
+func TestContainerState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockruntime-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	bundle := newTestBundle(t, dir)
+
+	c, err := newContainer(root, "foo", bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newContainer(root, "foo", bundle); err == nil {
+		t.Error("a container id should be unique")
+	}
+
+	if _, err := newContainer(root, "../foo", bundle); err == nil {
+		t.Error("a container id should not be a path")
+	}
+
+	if c.Rootfs != filepath.Join(bundle, "rootfs") || c.Annotations["key"] != "value" {
+		t.Errorf("unexpected container %+v", c)
+	}
+
+	if c.status() != statusStopped {
+		t.Errorf("a container without process should be stopped, got %s", c.status())
+	}
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	c.Pid = cmd.Process.Pid
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(c.fifo(), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadContainer(root, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.status() != statusCreated {
+		t.Errorf("expected a created container, got %s", loaded.status())
+	}
+
+	os.Remove(c.fifo())
+	if loaded.status() != statusRunning {
+		t.Errorf("expected a running container, got %s", loaded.status())
+	}
+
+	loaded.Paused = true
+	if state := loaded.state(); state.Status != statusPaused || state.Pid != c.Pid {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	if state := loaded.state(); state.Status != statusStopped || state.Pid != 0 {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	containers, err := listContainers(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 1 || containers[0].ID != "foo" {
+		t.Errorf("unexpected containers %v", containers)
+	}
+
+	if err := loaded.destroy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadContainer(root, "foo"); err == nil {
+		t.Error("a destroyed container should not be loaded")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli"
+)
+
+// faultsFile is the file of the root directory where faults can be
+// configured without changing the environment of the runtime
+const faultsFile = "faults"
+
+const (
+	// faultHang blocks the command until it is killed
+	faultHang = "hang"
+
+	// faultCrash kills the command before it does anything
+	faultCrash = "crash"
+
+	// faultExit runs the command and exits with a given code
+	faultExit = "exit"
+)
+
+// fault is a failure injected in a command
+type fault struct {
+	kind string
+	code int
+}
+
+func (f *fault) String() string {
+	if f.kind == faultExit {
+		return fmt.Sprintf("%s:%d", f.kind, f.code)
+	}
+
+	return f.kind
+}
+
+// inject runs fn with the fault, a nil fault just runs fn
+func (f *fault) inject(fn func() error) error {
+	if f == nil {
+		return fn()
+	}
+
+	switch f.kind {
+	case faultHang:
+		select {}
+	case faultCrash:
+		syscall.Kill(os.Getpid(), syscall.SIGKILL)
+		select {}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return exitStatus(f.code)
+}
+
+// parseFaults parses a list of command=fault separated by commas or
+// new lines, where fault is hang, crash or exit:<code>
+func parseFaults(s string) (map[string]*fault, error) {
+	faults := make(map[string]*fault)
+
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid fault '%s', expected command=fault", entry)
+		}
+
+		f, err := parseFault(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		faults[parts[0]] = f
+	}
+
+	return faults, nil
+}
+
+// parseFault parses hang, crash or exit:<code>
+func parseFault(s string) (*fault, error) {
+	switch {
+	case s == faultHang, s == faultCrash:
+		return &fault{kind: s}, nil
+	case strings.HasPrefix(s, faultExit+":"):
+		code, err := strconv.Atoi(strings.TrimPrefix(s, faultExit+":"))
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("invalid exit code in fault '%s'", s)
+		}
+		return &fault{kind: faultExit, code: code}, nil
+	}
+
+	return nil, fmt.Errorf("unknown fault '%s', expected hang, crash or exit:<code>", s)
+}
+
+// commandFault returns the fault configured for the command, the faults
+// given with --faults take precedence over the faults file of the root
+func commandFault(ctx *cli.Context, command string) (*fault, error) {
+	content, err := ioutil.ReadFile(filepath.Join(ctx.GlobalString("root"), faultsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	faults, err := parseFaults(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	flagFaults, err := parseFaults(ctx.GlobalString("faults"))
+	if err != nil {
+		return nil, err
+	}
+
+	for c, f := range flagFaults {
+		faults[c] = f
+	}
+
+	return faults[command], nil
+}
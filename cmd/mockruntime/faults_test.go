@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := parseFaults("create=hang, start=crash\n# comment\ndelete=exit:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for command, expected := range map[string]string{
+		"create": "hang",
+		"start":  "crash",
+		"delete": "exit:3",
+	} {
+		f, ok := faults[command]
+		if !ok {
+			t.Errorf("no fault for %s", command)
+			continue
+		}
+
+		if f.String() != expected {
+			t.Errorf("expected fault %s for %s, got %s", expected, command, f)
+		}
+	}
+
+	if len(faults) != 3 {
+		t.Errorf("expected 3 faults, got %v", faults)
+	}
+
+	for _, invalid := range []string{"create", "=hang", "create=sleep", "create=exit:x", "create=exit:256"} {
+		if _, err := parseFaults(invalid); err == nil {
+			t.Errorf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func TestFaultInject(t *testing.T) {
+	var f *fault
+	called := false
+
+	if err := f.inject(func() error { called = true; return nil }); err != nil || !called {
+		t.Errorf("a nil fault should only run the command, got %v", err)
+	}
+
+	f = &fault{kind: faultExit, code: 3}
+	called = false
+
+	err := f.inject(func() error { called = true; return nil })
+	if !called {
+		t.Error("the command should run before the exit fault")
+	}
+
+	if err == nil || err.(interface{ ExitCode() int }).ExitCode() != 3 {
+		t.Errorf("expected exit code 3, got %v", err)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for s, expected := range map[string]syscall.Signal{
+		"9":       syscall.SIGKILL,
+		"KILL":    syscall.SIGKILL,
+		"SIGTERM": syscall.SIGTERM,
+		"usr1":    syscall.SIGUSR1,
+	} {
+		sig, err := parseSignal(s)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", s, err)
+		} else if sig != expected {
+			t.Errorf("expected %d for %s, got %d", expected, s, sig)
+		}
+	}
+
+	for _, invalid := range []string{"0", "65", "FOO"} {
+		if _, err := parseSignal(invalid); err == nil {
+			t.Errorf("expected an error for '%s'", invalid)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// name is the name of the program.
+const name = "mockruntime"
+
+// usage is the usage of the program.
+const usage = name +
+	` is a fake OCI runtime that runs the container processes on the host.
+  It is used to test the tests library and the functional tests without virtual machines.`
+
+// defaultRoot is the directory where the state of the containers is stored.
+const defaultRoot = "/run/mockruntime"
+
+// logWriter is where the commands and their errors are logged.
+var logWriter io.Writer = ioutil.Discard
+
+// exitStatus returns the error of the commands that exit with the
+// status of a process, the cli exits with code without printing it
+func exitStatus(code int) error {
+	return cli.NewExitError("", code)
+}
+
+// mockruntime main entry point.
+func main() {
+	app := cli.NewApp()
+	app.Name = name
+	app.Usage = usage
+	app.Version = "0.1.0"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "root",
+			Value:  defaultRoot,
+			Usage:  "directory where the state of the containers is stored",
+			EnvVar: "MOCK_RUNTIME_ROOT",
+		},
+		cli.StringFlag{
+			Name:  "log",
+			Usage: "file where the commands are logged",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "format of the log, only text is supported",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "ignored, the commands are always logged",
+		},
+		cli.StringFlag{
+			Name:   "faults",
+			Usage:  "faults to inject in the commands, e.g. create=hang,start=crash,delete=exit:3",
+			EnvVar: "MOCK_RUNTIME_FAULTS",
+		},
+	}
+
+	app.Before = openLog
+
+	app.Commands = []cli.Command{
+		createCommand,
+		startCommand,
+		runCommand,
+		stateCommand,
+		killCommand,
+		deleteCommand,
+		listCommand,
+		execCommand,
+		psCommand,
+		pauseCommand,
+		resumeCommand,
+		initCommand,
+	}
+
+	// the cli prints the errors of the commands and exits with their
+	// code, only the usage errors are returned
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// openLog opens the file given with --log
+func openLog(ctx *cli.Context) error {
+	path := ctx.GlobalString("log")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	logWriter = f
+	logf("%s", strings.Join(os.Args, " "))
+
+	return nil
+}
+
+// logf writes a line in the log
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(logWriter, "%s pid=%d %s\n", time.Now().Format(time.RFC3339Nano),
+		os.Getpid(), fmt.Sprintf(format, args...))
+}
+
+// action returns the action of the command called name, the action
+// injects the fault configured for the command, if any, around fn
+func action(name string, fn func(ctx *cli.Context) error) func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		f, err := commandFault(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			logf("injecting fault %s in %s", f, name)
+		}
+
+		err = f.inject(func() error { return fn(ctx) })
+		if _, ok := err.(cli.ExitCoder); !ok && err != nil {
+			logf("%s failed: %v", name, err)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	spec "github.com/opencontainers/specs/specs-go"
+)
+
+// signals are the names of the signals accepted by the kill command
+var signals = map[string]syscall.Signal{
+	"ABRT":  syscall.SIGABRT,
+	"ALRM":  syscall.SIGALRM,
+	"CONT":  syscall.SIGCONT,
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"KILL":  syscall.SIGKILL,
+	"PIPE":  syscall.SIGPIPE,
+	"QUIT":  syscall.SIGQUIT,
+	"STOP":  syscall.SIGSTOP,
+	"TERM":  syscall.SIGTERM,
+	"TSTP":  syscall.SIGTSTP,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal parses a signal number or name, with or without the SIG prefix
+func parseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, fmt.Errorf("invalid signal %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal '%s'", s)
+	}
+
+	return sig, nil
+}
+
+// processAlive returns true if the process pid exists and is not a zombie
+func processAlive(pid int) bool {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// the command name is between parenthesis and may contain spaces
+	stat := string(content)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) == 0 {
+		return false
+	}
+
+	return fields[0] != "Z" && fields[0] != "X"
+}
+
+// parentPid returns the parent of the process pid
+func parentPid(pid int) (int, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	stat := string(content)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected stat of process %d", pid)
+	}
+
+	return strconv.Atoi(fields[1])
+}
+
+// processCmdline returns the command line of the process pid
+func processCmdline(pid int) string {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Replace(string(content), "\x00", " ", -1))
+}
+
+// descendants returns pids and all their descendants
+func descendants(pids []int) []int {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return pids
+	}
+
+	children := make(map[int][]int)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+
+		if ppid, err := parentPid(pid); err == nil {
+			children[ppid] = append(children[ppid], pid)
+		}
+	}
+
+	var result []int
+	queue := append([]int{}, pids...)
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		result = append(result, pid)
+		queue = append(queue, children[pid]...)
+	}
+
+	return result
+}
+
+// exitCode returns the exit code of a process, as a shell reports it
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, err
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, err
+	}
+
+	if status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+
+	return status.ExitStatus(), nil
+}
+
+// lookPath looks for the program in the PATH of the environment env
+func lookPath(program string, env []string) (string, error) {
+	if strings.Contains(program, "/") {
+		return program, nil
+	}
+
+	path := os.Getenv("PATH")
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			path = strings.TrimPrefix(e, "PATH=")
+		}
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		p := filepath.Join(dir, program)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("executable file '%s' not found in $PATH", program)
+}
+
+// workingDir returns the working directory of p, the processes run on
+// the host so the directory of the bundle is used if cwd does not exist
+func workingDir(p *spec.Process, bundle string) string {
+	if info, err := os.Stat(p.Cwd); err == nil && info.IsDir() {
+		return p.Cwd
+	}
+
+	return bundle
+}
+
+// credential returns the credential of the user of p, nil if the
+// runtime cannot change it
+func credential(p *spec.Process) *syscall.Credential {
+	if os.Getuid() != 0 {
+		return nil
+	}
+
+	return &syscall.Credential{
+		Uid:    p.User.UID,
+		Gid:    p.User.GID,
+		Groups: p.User.AdditionalGids,
+	}
+}
+
+// processCommand returns the command that runs p
+func processCommand(p *spec.Process, bundle string) (*exec.Cmd, error) {
+	if len(p.Args) == 0 {
+		return nil, fmt.Errorf("process args cannot be empty")
+	}
+
+	path, err := lookPath(p.Args[0], p.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, p.Args[1:]...)
+	cmd.Args[0] = p.Args[0]
+	cmd.Env = p.Env
+	cmd.Dir = workingDir(p, bundle)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: credential(p),
+	}
+
+	return cmd, nil
+}
+
+// setStdio attaches cmd to console if not empty, to the stdio of the
+// runtime if attached is true, else to /dev/null, it returns the
+// console to close once cmd is started
+func setStdio(cmd *exec.Cmd, console string, attached bool) (*os.File, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	if console != "" {
+		f, err := os.OpenFile(console, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		cmd.Stdin = f
+		cmd.Stdout = f
+		cmd.Stderr = f
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+
+		return f, nil
+	}
+
+	if attached {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return nil, nil
+	}
+
+	// a detached process must not keep the pipes of the caller open
+	cmd.SysProcAttr.Setsid = true
+
+	return nil, nil
+}
+
+// writePidFile writes pid in path, if not empty
+func writePidFile(path string, pid int) error {
+	if path == "" {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -16,10 +16,18 @@ package tests
 
 import (
 	"bytes"
-	"flag"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/onsi/ginkgo"
 )
 
 // Runtime is the path of Clear Containers Runtime
@@ -35,13 +43,60 @@ type Command struct {
 
 	// Timeout is the time limit of seconds of the command
 	Timeout time.Duration
+
+	// Stdout if not nil receives a live copy of the command stdout
+	Stdout io.Writer
+
+	// Stderr if not nil receives a live copy of the command stderr
+	Stderr io.Writer
+
+	// OnStdoutLine if not nil is called for each line written to stdout
+	// while the command is running
+	OnStdoutLine LineFunc
+
+	// OnStderrLine if not nil is called for each line written to stderr
+	// while the command is running
+	OnStderrLine LineFunc
+
+	// terminal if not nil is the input, the outputs and the controlling
+	// terminal of the command, whose output is then not captured
+	terminal *os.File
+
+	// started if not nil is called once the command is started
+	started func()
 }
 
-func init() {
-	flag.StringVar(&Runtime, "runtime", "cc-runtime", "Path of Clear Containers Runtime")
-	flag.IntVar(&Timeout, "timeout", 5, "Time limit in seconds for each test")
+// LineFunc is called with each line of output of a command, without the
+// trailing newline. Stdout and stderr callbacks can run concurrently.
+type LineFunc func(line string)
+
+// Result contains the outcome of a command
+type Result struct {
+	// Stdout is everything the command wrote to its standard output,
+	// including the output written before a timeout was reached
+	Stdout string
+
+	// Stderr is everything the command wrote to its standard error,
+	// including the output written before a timeout was reached
+	Stderr string
+
+	// ExitCode is the exit code of the command,
+	// -1 if the command could not be started or was terminated by a signal
+	ExitCode int
+
+	// Signal is the signal that terminated the command, 0 if none
+	Signal syscall.Signal
+
+	// Duration is the wall-clock time the command took
+	Duration time.Duration
+
+	// TimedOut is true if the command was killed because its
+	// timeout or the context deadline was reached, a cancelled
+	// context kills the command without setting it
+	TimedOut bool
 
-	flag.Parse()
+	// Err is the error returned starting or waiting for the command
+	Err error
 }
 
 // NewCommand returns a new instance of Command
@@ -53,51 +108,274 @@ func NewCommand(path string, args ...string) *Command {
 	return c
 }
 
+// Stream tees the command stdout and stderr live to w,
+// GinkgoWriter is used if w is nil
+func (c *Command) Stream(w io.Writer) *Command {
+	if w == nil {
+		w = ginkgo.GinkgoWriter
+	}
+
+	c.Stdout = w
+	c.Stderr = w
+
+	return c
+}
+
 // Run runs a command returning its stdout, stderr and exit code
 func (c *Command) Run() (string, string, int) {
 	return c.RunWithPipe(nil)
 }
 
-// Run runs a command with stdin as an input and returning its stdout, stderr and exit code
+// RunWithPipe runs a command with stdin as an input and returning its stdout, stderr and exit code
 func (c *Command) RunWithPipe(stdin *bytes.Buffer) (string, string, int) {
+	if stdin != nil {
+		c.cmd.Stdin = stdin
+	}
+
+	r := c.RunContext(context.Background())
+
+	return r.Stdout, r.Stderr, r.ExitCode
+}
+
+// RunContext runs a command until it finishes, its timeout is reached
+// or ctx is done. The command runs in its own process group, which is
+// killed as a whole when the command has to be terminated, so that any
+// children it spawned (shims, proxies, hypervisors) do not outlive it.
+func (c *Command) RunContext(ctx context.Context) Result {
 	LogIfFail("Running command '%s %s'\n", c.cmd.Path, c.cmd.Args)
 
+	// the input is kept to be recorded or matched by the cassette
+	cassette := CurrentCassette()
+	if cassette != nil && !cassette.handles(c.cmd.Args) {
+		cassette = nil
+	}
+
+	// the output of a command attached to a terminal is not captured, it
+	// is not recorded and cannot be replayed
+	if cassette != nil && c.terminal != nil {
+		if cassette.Mode == CassetteReplay {
+			err := fmt.Errorf("%v is attached to a terminal and cannot be replayed from cassette %s",
+				c.cmd.Args, cassette.Path)
+			return Result{Stderr: err.Error(), ExitCode: -1, Err: err}
+		}
+
+		cassette = nil
+	}
+
+	var stdin string
+	if cassette != nil && c.cmd.Stdin != nil {
+		content, err := ioutil.ReadAll(c.cmd.Stdin)
+		if err != nil {
+			return Result{ExitCode: -1, Err: err}
+		}
+		stdin = string(content)
+		c.cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout*time.Second)
+		defer cancel()
+	}
+
 	var stdout, stderr bytes.Buffer
-	c.cmd.Stdout = &stdout
-	c.cmd.Stderr = &stderr
+	stdoutLines := newLineWriter(c.OnStdoutLine)
+	stderrLines := newLineWriter(c.OnStderrLine)
+	if c.terminal != nil {
+		c.cmd.Stdin = c.terminal
+		c.cmd.Stdout = c.terminal
+		c.cmd.Stderr = c.terminal
+	} else {
+		// os/exec copies stdout and stderr from two goroutines, the live
+		// copies, often the same writer, must not be written concurrently
+		var lock sync.Mutex
+		c.cmd.Stdout = teeWriter(&stdout, lockedWriter(&lock, c.Stdout), stdoutLines)
+		c.cmd.Stderr = teeWriter(&stderr, lockedWriter(&lock, c.Stderr), stderrLines)
+	}
 
-	if stdin != nil {
-		c.cmd.Stdin  = stdin
+	if cassette != nil && cassette.Mode == CassetteReplay {
+		result := cassette.replay(c.cmd.Args, stdin)
+		io.WriteString(c.cmd.Stdout, result.Stdout)
+		io.WriteString(c.cmd.Stderr, result.Stderr)
+		stdoutLines.flush()
+		stderrLines.flush()
+
+		LogIfFail("Replayed %+v\nExit Code: %d\nStdout: %s\nStderr: %s\n",
+			c.cmd.Args, result.ExitCode, result.Stdout, result.Stderr)
+
+		recordCommand(c.cmd.Args, time.Now(), result)
+		return result
+	}
+
+	if c.cmd.SysProcAttr == nil {
+		c.cmd.SysProcAttr = &syscall.SysProcAttr{}
 	}
+	if c.terminal != nil {
+		// the new session is also a new process group
+		c.cmd.SysProcAttr.Setsid = true
+		c.cmd.SysProcAttr.Setctty = true
+	} else {
+		c.cmd.SysProcAttr.Setpgid = true
+	}
+
+	result := Result{ExitCode: -1}
+	start := time.Now()
 
 	if err := c.cmd.Start(); err != nil {
 		LogIfFail("could no start command: %v\n", err)
+		result.Err = err
+		recordCommand(c.cmd.Args, start, result)
+		return result
+	}
+
+	if c.started != nil {
+		c.started()
 	}
 
-	done := make(chan error)
+	done := make(chan error, 1)
 	go func() { done <- c.cmd.Wait() }()
 
-	var timeout <-chan time.Time
-	if c.Timeout > 0 {
-		timeout = time.After(c.Timeout * time.Second)
+	select {
+	case <-ctx.Done():
+		LogIfFail("Killing process group, %v\n", ctx.Err())
+		result.TimedOut = ctx.Err() == context.DeadlineExceeded
+		killProcessGroup(c.cmd.Process.Pid)
+		result.Err = <-done
+
+	case result.Err = <-done:
 	}
 
-	select {
-	case <-timeout:
-		LogIfFail("Killing process timeout reached '%d' seconds\n", c.Timeout)
-		_ = c.cmd.Process.Kill()
-		return "", "", -1
+	result.Duration = time.Since(start)
+	stdoutLines.flush()
+	stderrLines.flush()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
 
-	case err := <-done:
-		if err != nil {
-			LogIfFail("command failed error '%s'\n", err)
+	if result.Err != nil {
+		LogIfFail("command failed error '%s'\n", result.Err)
+	}
+
+	if status, ok := c.cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+		result.ExitCode = status.ExitStatus()
+		if status.Signaled() {
+			result.Signal = status.Signal()
+		}
+	}
+
+	LogIfFail("%+v\nTimeout: %d seconds\nTimed out: %t\nDuration: %s\nExit Code: %d\nSignal: %d\nStdout: %s\nStderr: %s\n",
+		c.cmd.Args, c.Timeout, result.TimedOut, result.Duration, result.ExitCode,
+		result.Signal, result.Stdout, result.Stderr)
+
+	if cassette != nil {
+		cassette.record(c.cmd.Args, stdin, result)
+	}
+
+	recordCommand(c.cmd.Args, start, result)
+
+	return result
+}
+
+// killProcessGroup sends SIGKILL to every process in the group of pid,
+// falling back to pid alone if the group cannot be signalled
+func killProcessGroup(pid int) {
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+// teeWriter returns a writer that duplicates its writes to every
+// non nil writer given
+func teeWriter(w io.Writer, writers ...io.Writer) io.Writer {
+	for _, t := range writers {
+		if t == nil {
+			continue
+		}
+
+		// avoid storing a typed nil *lineWriter in the interface
+		if l, ok := t.(*lineWriter); ok && l == nil {
+			continue
+		}
+
+		w = io.MultiWriter(w, t)
+	}
+
+	return w
+}
+
+// syncWriter serialises the writes to w with lock
+type syncWriter struct {
+	lock *sync.Mutex
+	w    io.Writer
+}
+
+// lockedWriter returns w guarded by lock, nil if w is nil
+func lockedWriter(lock *sync.Mutex, w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+
+	return &syncWriter{lock: lock, w: w}
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.w.Write(p)
+}
+
+// NotifyOnLine returns a LineFunc and a channel that is closed the first
+// time a line containing substr is written. It can be used to react to
+// a marker line of a command that is still running.
+func NotifyOnLine(substr string) (LineFunc, <-chan struct{}) {
+	ch := make(chan struct{})
+	var once sync.Once
+
+	f := func(line string) {
+		if strings.Contains(line, substr) {
+			once.Do(func() { close(ch) })
 		}
+	}
 
-		exitCode := c.cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	return f, ch
+}
 
-		LogIfFail("%+v\nTimeout: %d seconds\nExit Code: %d\nStdout: %s\nStderr: %s\n",
-			c.cmd.Args, c.Timeout, exitCode, stdout.String(), stderr.String())
+// lineWriter splits what is written to it in lines and calls fn for each
+type lineWriter struct {
+	fn      LineFunc
+	pending []byte
+}
 
-		return stdout.String(), stderr.String(), exitCode
+func newLineWriter(fn LineFunc) *lineWriter {
+	if fn == nil {
+		return nil
 	}
+
+	return &lineWriter{fn: fn}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.pending = append(l.pending, p...)
+
+	for {
+		i := bytes.IndexByte(l.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		l.fn(strings.TrimSuffix(string(l.pending[:i]), "\r"))
+		l.pending = l.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// flush calls fn with any remaining data not terminated by a newline
+func (l *lineWriter) flush() {
+	if l == nil || len(l.pending) == 0 {
+		return
+	}
+
+	l.fn(string(l.pending))
+	l.pending = nil
 }
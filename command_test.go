@@ -0,0 +1,214 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processGone returns true if pid does not exist or is a zombie
+func processGone(pid int) bool {
+	status, err := readProcStatus(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return true
+	}
+
+	return strings.HasPrefix(status["State"], "Z") || strings.HasPrefix(status["State"], "X")
+}
+
+func TestRunContext(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		cancel   bool
+		stdout   string
+		exitCode int
+		signal   syscall.Signal
+		timedOut bool
+	}{
+		{
+			name:     "exit code",
+			script:   "echo foo; exit 3",
+			stdout:   "foo\n",
+			exitCode: 3,
+		},
+		{
+			name:     "output kept after a timeout",
+			script:   "echo before; sleep 10; echo after",
+			timeout:  200 * time.Millisecond,
+			stdout:   "before\n",
+			exitCode: -1,
+			signal:   syscall.SIGKILL,
+			timedOut: true,
+		},
+		{
+			name:     "cancelled",
+			script:   "echo before; sleep 10",
+			cancel:   true,
+			stdout:   "before\n",
+			exitCode: -1,
+			signal:   syscall.SIGKILL,
+		},
+		{
+			name:     "signaled",
+			script:   "kill -TERM $$",
+			exitCode: -1,
+			signal:   syscall.SIGTERM,
+		},
+	} {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		if c.timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), c.timeout)
+		} else {
+			ctx, cancel = context.WithCancel(context.Background())
+		}
+
+		cmd := NewCommand("sh", "-c", c.script)
+		cmd.Timeout = 0
+
+		if c.cancel {
+			f, printed := NotifyOnLine("before")
+			cmd.OnStdoutLine = f
+			go func() {
+				<-printed
+				cancel()
+			}()
+		}
+
+		r := cmd.RunContext(ctx)
+		cancel()
+
+		if r.Stdout != c.stdout || r.ExitCode != c.exitCode || r.Signal != c.signal || r.TimedOut != c.timedOut {
+			t.Errorf("%s: unexpected result %+v", c.name, r)
+		}
+	}
+}
+
+func TestRunContextKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	cmd := NewCommand("sh", "-c", "sleep 10 & echo $!; wait")
+	cmd.Timeout = 0
+	r := cmd.RunContext(ctx)
+
+	// the output pipe is held open by the grandchild until it is killed
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("the command should be killed on timeout, took %v", elapsed)
+	}
+
+	if !r.TimedOut {
+		t.Errorf("the command should time out, got %+v", r)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(r.Stdout))
+	if err != nil {
+		t.Fatalf("unexpected output %q: %v", r.Stdout, err)
+	}
+
+	for i := 0; i < 50 && !processGone(pid); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !processGone(pid) {
+		t.Errorf("the grandchild %d should be killed with the process group", pid)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		writes []string
+		lines  []string
+	}{
+		{"partial lines", []string{"fo", "o\nb", "ar\n"}, []string{"foo", "bar"}},
+		{"CRLF", []string{"foo\r\nbar\r", "\n"}, []string{"foo", "bar"}},
+		{"final line without newline", []string{"foo\nbar"}, []string{"foo", "bar"}},
+		{"empty lines", []string{"\n\nfoo\n"}, []string{"", "", "foo"}},
+	} {
+		var lines []string
+		l := newLineWriter(func(line string) { lines = append(lines, line) })
+
+		for _, w := range c.writes {
+			if n, err := l.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("%s: write returned %d, %v", c.name, n, err)
+			}
+		}
+		l.flush()
+
+		if !reflect.DeepEqual(lines, c.lines) {
+			t.Errorf("%s: expected lines %q, got %q", c.name, c.lines, lines)
+		}
+	}
+
+	if l := newLineWriter(nil); l != nil {
+		t.Error("a line writer without callback should be nil")
+	}
+}
+
+func TestCommandLines(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		lines []string
+	)
+
+	marker, printed := NotifyOnLine("marker")
+
+	cmd := NewCommand("sh", "-c", "echo one; echo marker; printf 'two\\r\\nthree'; echo err >&2").Stream(&buf)
+	cmd.OnStdoutLine = func(line string) {
+		lines = append(lines, line)
+		marker(line)
+	}
+
+	var errLines []string
+	cmd.OnStderrLine = func(line string) { errLines = append(errLines, line) }
+
+	stdout, stderr, exitCode := cmd.Run()
+	if exitCode != 0 {
+		t.Fatalf("unexpected exit code %d", exitCode)
+	}
+
+	if expected := []string{"one", "marker", "two", "three"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected stdout lines %q, got %q", expected, lines)
+	}
+
+	if !reflect.DeepEqual(errLines, []string{"err"}) {
+		t.Errorf("unexpected stderr lines %q", errLines)
+	}
+
+	select {
+	case <-printed:
+	default:
+		t.Error("the marker line should be notified")
+	}
+
+	if buf.Len() != len(stdout)+len(stderr) || !strings.Contains(buf.String(), "three") {
+		t.Errorf("the output should be streamed, got %q", buf.String())
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RuntimeComponent is the component name of the runtime processes
+	RuntimeComponent = "runtime"
+
+	// ShimComponent is the component name of the shim processes
+	ShimComponent = "shim"
+
+	// ProxyComponent is the component name of the proxy processes
+	ProxyComponent = "proxy"
+
+	// HypervisorComponent is the component name of the hypervisor processes
+	HypervisorComponent = "hypervisor"
+)
+
+// ShimName is the name of the shim binary
+var ShimName = "cc-shim"
+
+// ProxyName is the name of the proxy binary
+var ProxyName = "cc-proxy"
+
+// DefaultProxyURI is the URI the proxy listens on and the shims connect
+// to when their command line does not specify one
+const DefaultProxyURI = "unix:///var/run/clear-containers/proxy.sock"
+
+// ComponentProcess is a process of a container component
+type ComponentProcess struct {
+	// Component is the name of the component, e.g. ShimComponent
+	Component string
+
+	// PID of the process
+	PID int
+
+	// PPID is the PID of the parent process
+	PPID int
+
+	// Cmdline is the command line of the process
+	Cmdline []string
+
+	// Threads is the number of threads of the process
+	Threads int
+
+	// FDs is the number of open file descriptors of the process
+	FDs int
+
+	// RSS is the resident set size of the process in bytes
+	RSS uint64
+
+	// PSS is the proportional set size of the process in bytes
+	PSS uint64
+}
+
+// ContainerComponents are the processes of the components of a container
+type ContainerComponents struct {
+	ContainerID string
+	Runtimes    []ComponentProcess
+	Shims       []ComponentProcess
+	Proxies     []ComponentProcess
+	Hypervisors []ComponentProcess
+}
+
+// All returns the processes of all the components
+func (c *ContainerComponents) All() []ComponentProcess {
+	var all []ComponentProcess
+
+	all = append(all, c.Runtimes...)
+	all = append(all, c.Shims...)
+	all = append(all, c.Proxies...)
+	all = append(all, c.Hypervisors...)
+
+	return all
+}
+
+// FindComponents looks in /proc for the runtime, shim, proxy and
+// hypervisor processes of containerID
+func FindComponents(containerID string) (*ContainerComponents, error) {
+	return findComponents(procPath, HypervisorMatchers(), containerID)
+}
+
+func findComponents(proc string, matchers []HypervisorMatcher, containerID string) (*ContainerComponents, error) {
+	if containerID == "" {
+		return nil, fmt.Errorf("missing container ID")
+	}
+
+	components := &ContainerComponents{ContainerID: containerID}
+
+	// the proxy is shared by the containers, it is found once the URIs
+	// the shims of the container connect to are known
+	var proxies []ComponentProcess
+
+	for _, p := range readProcesses(proc) {
+		component := processComponent(p.cmdline, matchers, containerID)
+		if component == "" {
+			continue
+		}
+
+		cp, err := readComponentProcess(proc, p, component)
+		if err != nil {
+			// the process exited while it was inspected
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		switch component {
+		case RuntimeComponent:
+			components.Runtimes = append(components.Runtimes, *cp)
+		case ShimComponent:
+			components.Shims = append(components.Shims, *cp)
+		case ProxyComponent:
+			proxies = append(proxies, *cp)
+		case HypervisorComponent:
+			components.Hypervisors = append(components.Hypervisors, *cp)
+		}
+	}
+
+	uris := map[string]bool{}
+	for _, shim := range components.Shims {
+		uris[proxyURI(shim.Cmdline, "-u")] = true
+	}
+
+	if len(uris) == 0 {
+		uris[DefaultProxyURI] = true
+	}
+
+	for _, p := range proxies {
+		uri := proxyURI(p.Cmdline, "-uri")
+		if uris[uri] || strings.Contains(uri, containerID) {
+			components.Proxies = append(components.Proxies, p)
+		}
+	}
+
+	return components, nil
+}
+
+// proxyURI returns the proxy URI given by option in cmdline,
+// DefaultProxyURI if it has none
+func proxyURI(cmdline []string, option string) string {
+	uri := optionValue(cmdline, option)
+	if uri == "" {
+		uri = optionValue(cmdline, "-"+option)
+	}
+
+	if uri == "" {
+		return DefaultProxyURI
+	}
+
+	return uri
+}
+
+// processComponent returns the component of containerID run by
+// cmdline, an empty string if cmdline is not one of its components.
+// Any proxy is returned, its command line does not name the containers
+// it serves.
+func processComponent(cmdline []string, matchers []HypervisorMatcher, containerID string) string {
+	for _, m := range matchers {
+		if m.Match(cmdline, containerID) {
+			return HypervisorComponent
+		}
+	}
+
+	if filepath.Base(cmdline[0]) == ProxyName {
+		return ProxyComponent
+	}
+
+	if !argsContain(cmdline[1:], containerID) {
+		return ""
+	}
+
+	switch filepath.Base(cmdline[0]) {
+	case filepath.Base(Runtime):
+		return RuntimeComponent
+	case ShimName:
+		return ShimComponent
+	}
+
+	return ""
+}
+
+func argsContain(args []string, s string) bool {
+	for _, arg := range args {
+		if strings.Contains(arg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readComponentProcess reads the parentage, threads, file descriptors
+// and memory usage of p
+func readComponentProcess(proc string, p procProcess, component string) (*ComponentProcess, error) {
+	dir := filepath.Join(proc, strconv.Itoa(p.pid))
+
+	cp := &ComponentProcess{
+		Component: component,
+		PID:       p.pid,
+		Cmdline:   p.cmdline,
+	}
+
+	status, err := readProcStatus(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	if cp.PPID, err = strconv.Atoi(status["PPid"]); err != nil {
+		return nil, fmt.Errorf("invalid PPid of process %d: %v", p.pid, err)
+	}
+
+	if cp.Threads, err = strconv.Atoi(status["Threads"]); err != nil {
+		return nil, fmt.Errorf("invalid Threads of process %d: %v", p.pid, err)
+	}
+
+	fds, err := ioutil.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+	cp.FDs = len(fds)
+
+	if cp.RSS, cp.PSS, err = readSmaps(dir); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// readProcStatus returns the fields of a /proc/<pid>/status file
+func readProcStatus(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		fields[parts[0]] = strings.TrimSpace(parts[1])
+	}
+
+	return fields, scanner.Err()
+}
+
+// readSmaps returns the RSS and PSS in bytes of the process whose /proc
+// directory is dir. smaps_rollup is used when the kernel provides it,
+// otherwise the mappings listed in smaps are summed.
+func readSmaps(dir string) (uint64, uint64, error) {
+	f, err := os.Open(filepath.Join(dir, "smaps_rollup"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(dir, "smaps"))
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var rss, pss uint64
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[2] != "kB" {
+			continue
+		}
+
+		var total *uint64
+		switch fields[0] {
+		case "Rss:":
+			total = &rss
+		case "Pss:":
+			total = &pss
+		default:
+			continue
+		}
+
+		size, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid size in %s: %v", f.Name(), err)
+		}
+
+		*total += size * 1024
+	}
+
+	return rss, pss, scanner.Err()
+}
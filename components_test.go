@@ -0,0 +1,127 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProcess creates the /proc entries of a process in proc
+func fakeProcess(t *testing.T, proc string, pid, ppid int, cmdline ...string) {
+	dir := filepath.Join(proc, fmt.Sprintf("%d", pid))
+
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fd := range []string{"0", "1", "2"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "fd", fd), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"cmdline":      strings.Join(cmdline, "\x00") + "\x00",
+		"status":       fmt.Sprintf("Name:\t%s\nPPid:\t%d\nThreads:\t4\n", filepath.Base(cmdline[0]), ppid),
+		"smaps_rollup": "00400000-ffffffff ---p 00000000 00:00 0 [rollup]\nRss:                2048 kB\nPss:                1024 kB\n",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFindComponents(t *testing.T) {
+	proc, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proc)
+
+	fakeProcess(t, proc, 1, 0, "/sbin/init")
+	fakeProcess(t, proc, 10, 1, testHypervisorCmdlines["qemu"]...)
+	fakeProcess(t, proc, 11, 1, "/usr/libexec/cc-proxy", "-uri", "unix:///run/vc/sbs/"+testVMID+"/proxy.sock")
+	fakeProcess(t, proc, 12, 1, "/usr/libexec/cc-shim", "-c", testVMID, "-t", "token")
+	fakeProcess(t, proc, 13, 1, "/usr/libexec/cc-shim", "-c", "fedcba9876543210", "-t", "token")
+
+	components, err := findComponents(proc, HypervisorMatchers(), testVMID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(components.Hypervisors) != 1 || components.Hypervisors[0].PID != 10 {
+		t.Errorf("unexpected hypervisors %+v", components.Hypervisors)
+	}
+
+	if len(components.Proxies) != 1 || components.Proxies[0].PID != 11 {
+		t.Errorf("unexpected proxies %+v", components.Proxies)
+	}
+
+	if len(components.Shims) != 1 {
+		t.Fatalf("unexpected shims %+v", components.Shims)
+	}
+
+	if len(components.Runtimes) != 0 {
+		t.Errorf("unexpected runtimes %+v", components.Runtimes)
+	}
+
+	shim := components.Shims[0]
+	if shim.PID != 12 || shim.PPID != 1 || shim.Threads != 4 || shim.FDs != 3 {
+		t.Errorf("unexpected shim %+v", shim)
+	}
+
+	if shim.RSS != 2048*1024 || shim.PSS != 1024*1024 {
+		t.Errorf("unexpected memory usage RSS %d PSS %d", shim.RSS, shim.PSS)
+	}
+
+	if len(components.All()) != 3 {
+		t.Errorf("expected 3 processes, got %d", len(components.All()))
+	}
+}
+
+func TestFindSharedProxy(t *testing.T) {
+	proc, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proc)
+
+	// the proxy started by systemd serves all the containers
+	fakeProcess(t, proc, 1, 0, "/sbin/init")
+	fakeProcess(t, proc, 11, 1, "/usr/libexec/clear-containers/cc-proxy", "-log", "debug")
+	fakeProcess(t, proc, 12, 1, "/usr/libexec/clear-containers/cc-shim", "-c", testVMID, "-t", "token",
+		"-u", "unix:///var/run/clear-containers/proxy.sock")
+	fakeProcess(t, proc, 13, 1, "/usr/libexec/clear-containers/cc-proxy", "-uri", "unix:///tmp/other-proxy.sock")
+
+	components, err := findComponents(proc, HypervisorMatchers(), testVMID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(components.Proxies) != 1 || components.Proxies[0].PID != 11 {
+		t.Errorf("unexpected proxies %+v", components.Proxies)
+	}
+
+	if len(components.Shims) != 1 || components.Shims[0].PID != 12 {
+		t.Errorf("unexpected shims %+v", components.Shims)
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configEnv is the environment variable that can specify the
+// configuration file of the tests
+const configEnv = "TESTS_CONFIG"
+
+// operationTimeoutEnvPrefix is the prefix of the environment variables
+// that override the timeout of a runtime operation, e.g. TIMEOUT_CREATE
+const operationTimeoutEnvPrefix = "TIMEOUT_"
+
+// runtimeOperations are the runtime commands whose timeout can be set with
+// an operationTimeoutEnvPrefix variable, the other variables are ignored
+var runtimeOperations = map[string]bool{
+	"create": true,
+	"delete": true,
+	"events": true,
+	"exec":   true,
+	"kill":   true,
+	"list":   true,
+	"pause":  true,
+	"ps":     true,
+	"resume": true,
+	"run":    true,
+	"start":  true,
+	"state":  true,
+	"update": true,
+}
+
+// ConfigFile is the TOML configuration file of the tests,
+// TESTS_CONFIG is used if empty
+var ConfigFile string
+
+// ArtifactsDir is the directory where the tests save their artifacts
+var ArtifactsDir string
+
+// PullTimeout is the time limit in seconds to pull an image
+var PullTimeout int
+
+// operationTimeouts are the time limits in seconds of the runtime commands
+var operationTimeouts map[string]int
+
+var currentConfig *Config
+
+// Config is the configuration of the tests. It is read from a TOML file,
+// then overridden by the environment variables and by the command line
+// flags explicitly set.
+type Config struct {
+	// ArtifactsDir is the directory where the tests save their artifacts
+	ArtifactsDir string `toml:"artifacts_dir"`
+
+	// ReportsDir is the directory where the suites write their reports
+	ReportsDir string `toml:"reports_dir"`
+
+	// CheckLeaks enables the host resource leak detector
+	CheckLeaks bool `toml:"check_leaks"`
+
+	Runtime  RuntimeConfig  `toml:"runtime"`
+	Timeouts TimeoutsConfig `toml:"timeouts"`
+	Images   ImagesConfig   `toml:"images"`
+	Rootfs   RootfsConfig   `toml:"rootfs"`
+	OCI      OCIConfig      `toml:"oci"`
+	Docker   DockerConfig   `toml:"docker"`
+}
+
+// RuntimeConfig is the configuration of the runtime under test
+type RuntimeConfig struct {
+	// Path of the runtime binary
+	Path string `toml:"path"`
+
+	// Driver of the runtime, guessed from Path if empty
+	Driver string `toml:"driver"`
+}
+
+// TimeoutsConfig contains the time limits in seconds of the commands
+type TimeoutsConfig struct {
+	// Default is the time limit of the commands without a specific one
+	Default int `toml:"default"`
+
+	// Pull is the time limit to pull an image
+	Pull int `toml:"pull"`
+
+	// Operations are the time limits of the runtime commands,
+	// indexed by command name, e.g. "create"
+	Operations map[string]int `toml:"operations"`
+}
+
+// ImagesConfig contains the names of the images used by the tests
+type ImagesConfig struct {
+	Busybox  string `toml:"busybox"`
+	Alpine   string `toml:"alpine"`
+	Postgres string `toml:"postgres"`
+	Debian   string `toml:"debian"`
+	Fedora   string `toml:"fedora"`
+
+	// Manifest is the TOML file listing the images to provision with
+	// their digests and tarballs, the images above are used if empty
+	Manifest string `toml:"manifest"`
+
+	// CacheDir is the directory where the image tarballs are loaded from
+	CacheDir string `toml:"cache_dir"`
+
+	// Pull allows to pull the images missing from CacheDir
+	Pull bool `toml:"pull"`
+}
+
+// RootfsConfig is the configuration of the bundles rootfs
+type RootfsConfig struct {
+	// Path of the tarball, OCI image layout or directory used as the
+	// rootfs, exported from docker if empty
+	Path string `toml:"path"`
+
+	// Cache enables the rootfs cache
+	Cache bool `toml:"cache"`
+}
+
+// OCIConfig is the configuration of the bundles OCI config
+type OCIConfig struct {
+	// Version of the OCI spec of the default config
+	Version string `toml:"version"`
+
+	// ConfigFile is used instead of the default config if set
+	ConfigFile string `toml:"config_file"`
+}
+
+// DockerConfig is the configuration of the docker helpers
+type DockerConfig struct {
+	// Backend is DockerCLIBackend or DockerAPIBackend
+	Backend string `toml:"backend"`
+
+	// Socket is the path of the Docker Engine API socket
+	Socket string `toml:"socket"`
+
+	// Cassette is the file where the docker commands are recorded or
+	// replayed from, depending on CassetteMode
+	Cassette string `toml:"cassette"`
+
+	// CassetteMode is CassetteRecord or CassetteReplay
+	CassetteMode string `toml:"cassette_mode"`
+}
+
+// configFlags copy the value of each flag to the configuration
+var configFlags = map[string]func(c *Config){
+	"runtime":              func(c *Config) { c.Runtime.Path = Runtime },
+	"runtime-driver":       func(c *Config) { c.Runtime.Driver = RuntimeDriverName },
+	"timeout":              func(c *Config) { c.Timeouts.Default = Timeout },
+	"rootfs":               func(c *Config) { c.Rootfs.Path = RootfsPath },
+	"rootfs-cache":         func(c *Config) { c.Rootfs.Cache = UseRootfsCache },
+	"image-manifest":       func(c *Config) { c.Images.Manifest = ImageManifestFile },
+	"image-cache-dir":      func(c *Config) { c.Images.CacheDir = ImageCacheDir },
+	"image-pull":           func(c *Config) { c.Images.Pull = AllowImagePull },
+	"oci-version":          func(c *Config) { c.OCI.Version = OCIVersion },
+	"oci-config":           func(c *Config) { c.OCI.ConfigFile = OCIConfigFile },
+	"docker-backend":       func(c *Config) { c.Docker.Backend = DockerBackendName },
+	"docker-socket":        func(c *Config) { c.Docker.Socket = DockerSocket },
+	"docker-cassette":      func(c *Config) { c.Docker.Cassette = DockerCassette },
+	"docker-cassette-mode": func(c *Config) { c.Docker.CassetteMode = DockerCassetteMode },
+	"artifacts-dir":        func(c *Config) { c.ArtifactsDir = ArtifactsDir },
+	"reports-dir":          func(c *Config) { c.ReportsDir = ReportsDir },
+	"check-leaks":          func(c *Config) { c.CheckLeaks = CheckHostLeaks },
+}
+
+// configEnvs set the configuration from the environment variables
+var configEnvs = map[string]func(c *Config, value string) error{
+	"RUNTIME":              func(c *Config, v string) error { c.Runtime.Path = v; return nil },
+	"RUNTIME_DRIVER":       func(c *Config, v string) error { c.Runtime.Driver = v; return nil },
+	"TIMEOUT":              func(c *Config, v string) error { return parseEnvInt(v, &c.Timeouts.Default) },
+	"PULL_TIMEOUT":         func(c *Config, v string) error { return parseEnvInt(v, &c.Timeouts.Pull) },
+	"BUSYBOX_IMAGE":        func(c *Config, v string) error { c.Images.Busybox = v; return nil },
+	"ALPINE_IMAGE":         func(c *Config, v string) error { c.Images.Alpine = v; return nil },
+	"POSTGRES_IMAGE":       func(c *Config, v string) error { c.Images.Postgres = v; return nil },
+	"DEBIAN_IMAGE":         func(c *Config, v string) error { c.Images.Debian = v; return nil },
+	"FEDORA_IMAGE":         func(c *Config, v string) error { c.Images.Fedora = v; return nil },
+	"IMAGE_MANIFEST":       func(c *Config, v string) error { c.Images.Manifest = v; return nil },
+	"IMAGE_CACHE_DIR":      func(c *Config, v string) error { c.Images.CacheDir = v; return nil },
+	"IMAGE_PULL":           func(c *Config, v string) error { return parseEnvBool(v, &c.Images.Pull) },
+	"ROOTFS":               func(c *Config, v string) error { c.Rootfs.Path = v; return nil },
+	"ROOTFS_CACHE":         func(c *Config, v string) error { return parseEnvBool(v, &c.Rootfs.Cache) },
+	"OCI_VERSION":          func(c *Config, v string) error { c.OCI.Version = v; return nil },
+	ociConfigEnv:           func(c *Config, v string) error { c.OCI.ConfigFile = v; return nil },
+	"DOCKER_BACKEND":       func(c *Config, v string) error { c.Docker.Backend = v; return nil },
+	"DOCKER_SOCKET":        func(c *Config, v string) error { c.Docker.Socket = v; return nil },
+	"DOCKER_CASSETTE":      func(c *Config, v string) error { c.Docker.Cassette = v; return nil },
+	"DOCKER_CASSETTE_MODE": func(c *Config, v string) error { c.Docker.CassetteMode = v; return nil },
+	"ARTIFACTS_DIR":        func(c *Config, v string) error { c.ArtifactsDir = v; return nil },
+	"REPORTS_DIR":          func(c *Config, v string) error { c.ReportsDir = v; return nil },
+	"CHECK_LEAKS":          func(c *Config, v string) error { return parseEnvBool(v, &c.CheckLeaks) },
+}
+
+func init() {
+	c := DefaultConfig()
+
+	flag.StringVar(&ConfigFile, "config", "", "TOML configuration file of the tests, TESTS_CONFIG can also be used")
+	flag.StringVar(&Runtime, "runtime", c.Runtime.Path, "Path of Clear Containers Runtime")
+	flag.StringVar(&RuntimeDriverName, "runtime-driver", c.Runtime.Driver, "Driver of the runtime: cc-runtime, kata-runtime or runc, if empty it is guessed from the runtime name")
+	flag.IntVar(&Timeout, "timeout", c.Timeouts.Default, "Time limit in seconds for each test")
+	flag.StringVar(&ImageManifestFile, "image-manifest", c.Images.Manifest, "TOML manifest of the images to provision, with their digests and tarballs")
+	flag.StringVar(&ImageCacheDir, "image-cache-dir", c.Images.CacheDir, "Directory where the image tarballs are loaded from")
+	flag.BoolVar(&AllowImagePull, "image-pull", c.Images.Pull, "Pull the images missing from the image cache directory")
+	flag.StringVar(&RootfsPath, "rootfs", c.Rootfs.Path, "Tarball, OCI image layout or directory used as the bundles rootfs, if empty it is exported from docker")
+	flag.BoolVar(&UseRootfsCache, "rootfs-cache", c.Rootfs.Cache, "Extract the bundles rootfs once and give each bundle a copy-on-write view of it")
+	flag.StringVar(&OCIVersion, "oci-version", c.OCI.Version, "OCI spec version of the default bundles config")
+	flag.StringVar(&OCIConfigFile, "oci-config", c.OCI.ConfigFile, "OCI config file used by the bundles instead of the default one, OCI_CONFIG can also be used")
+	flag.StringVar(&DockerBackendName, "docker-backend", c.Docker.Backend, "Backend used by the docker helpers managing containers: cli or api")
+	flag.StringVar(&DockerSocket, "docker-socket", c.Docker.Socket, "Path of the Docker Engine API socket")
+	flag.StringVar(&DockerCassette, "docker-cassette", c.Docker.Cassette, "File where the docker commands are recorded or replayed from")
+	flag.StringVar(&DockerCassetteMode, "docker-cassette-mode", c.Docker.CassetteMode, "Mode of the docker cassette: record or replay")
+	flag.StringVar(&ArtifactsDir, "artifacts-dir", c.ArtifactsDir, "Directory where the tests save their artifacts")
+	flag.StringVar(&ReportsDir, "reports-dir", c.ReportsDir, "Directory where the suites write their JUnit and JSON reports")
+	flag.BoolVar(&CheckHostLeaks, "check-leaks", c.CheckLeaks, "Fail the specs that leave behind host resources")
+
+	c.apply()
+}
+
+// DefaultConfig returns the configuration used when neither a file,
+// the environment nor the flags change it
+func DefaultConfig() *Config {
+	return &Config{
+		Runtime: RuntimeConfig{
+			Path: "cc-runtime",
+		},
+		Timeouts: TimeoutsConfig{
+			Default:    5,
+			Pull:       600,
+			Operations: make(map[string]int),
+		},
+		Images: ImagesConfig{
+			Busybox:  "busybox",
+			Alpine:   "alpine",
+			Postgres: "postgres",
+			Debian:   "debian",
+			Fedora:   "fedora",
+			Pull:     true,
+		},
+		Rootfs: RootfsConfig{
+			Cache: true,
+		},
+		OCI: OCIConfig{
+			Version: DefaultOCIVersion,
+		},
+		Docker: DockerConfig{
+			Backend:      DockerCLIBackend,
+			Socket:       DefaultDockerSocket,
+			CassetteMode: CassetteReplay,
+		},
+	}
+}
+
+// LoadConfig loads the configuration of the tests: the defaults, then
+// the TOML file given by the -config flag or TESTS_CONFIG, then the
+// environment variables, then the flags explicitly set. The suites must
+// call it once the flags are parsed, before running the specs.
+func LoadConfig() error {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	path := ConfigFile
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+
+	c, err := readConfig(path, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		if set, ok := configFlags[f.Name]; ok {
+			set(c)
+		}
+	})
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	c.apply()
+	currentConfig = c
+
+	SeedNode()
+
+	return openDockerCassette()
+}
+
+// CurrentConfig returns the configuration of the tests, the default
+// one if LoadConfig was not called
+func CurrentConfig() *Config {
+	if currentConfig == nil {
+		return DefaultConfig()
+	}
+
+	return currentConfig
+}
+
+// OperationTimeout returns the time limit in seconds of the runtime
+// command op, Timeout if it has no specific time limit
+func OperationTimeout(op string) int {
+	if t, ok := operationTimeouts[op]; ok && t > 0 {
+		return t
+	}
+
+	return Timeout
+}
+
+// readConfig returns the default configuration overridden by the file
+// path, if not empty, and by the environment variables env
+func readConfig(path string, env []string) (*Config, error) {
+	c := DefaultConfig()
+
+	if path != "" {
+		if _, err := toml.DecodeFile(path, c); err != nil {
+			return nil, fmt.Errorf("could not load configuration %s: %v", path, err)
+		}
+	}
+
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+
+		name, value := parts[0], parts[1]
+
+		if set, ok := configEnvs[name]; ok {
+			if err := set(c, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(name, operationTimeoutEnvPrefix) {
+			op := strings.ToLower(strings.TrimPrefix(name, operationTimeoutEnvPrefix))
+			if !runtimeOperations[op] {
+				continue
+			}
+
+			var t int
+			if err := parseEnvInt(value, &t); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+
+			if c.Timeouts.Operations == nil {
+				c.Timeouts.Operations = make(map[string]int)
+			}
+			c.Timeouts.Operations[op] = t
+		}
+	}
+
+	return c, nil
+}
+
+// validate returns an error if a setting has an unknown value
+func (c *Config) validate() error {
+	// the driver is guessed from the runtime name only if not given
+	if c.Runtime.Driver != "" {
+		if _, err := GetRuntimeDriver(c.Runtime.Driver); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply sets the package variables used by the helpers
+func (c *Config) apply() {
+	Runtime = c.Runtime.Path
+	RuntimeDriverName = c.Runtime.Driver
+	Timeout = c.Timeouts.Default
+	PullTimeout = c.Timeouts.Pull
+	operationTimeouts = c.Timeouts.Operations
+	Image = c.Images.Busybox
+	AlpineImage = c.Images.Alpine
+	PostgresImage = c.Images.Postgres
+	DebianImage = c.Images.Debian
+	FedoraImage = c.Images.Fedora
+	ImageManifestFile = c.Images.Manifest
+	ImageCacheDir = c.Images.CacheDir
+	AllowImagePull = c.Images.Pull
+	RootfsPath = c.Rootfs.Path
+	UseRootfsCache = c.Rootfs.Cache
+	OCIVersion = c.OCI.Version
+	OCIConfigFile = c.OCI.ConfigFile
+	DockerBackendName = c.Docker.Backend
+	DockerSocket = c.Docker.Socket
+	DockerCassette = c.Docker.Cassette
+	DockerCassetteMode = c.Docker.CassetteMode
+	ArtifactsDir = c.ArtifactsDir
+	ReportsDir = c.ReportsDir
+	CheckHostLeaks = c.CheckLeaks
+}
+
+func parseEnvInt(value string, i *int) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	*i = v
+
+	return nil
+}
+
+func parseEnvBool(value string, b *bool) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+
+	*b = v
+
+	return nil
+}
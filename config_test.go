@@ -0,0 +1,145 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	content := `artifacts_dir = "/tmp/artifacts"
+
+[runtime]
+path = "/usr/bin/runc"
+
+[timeouts]
+default = 15
+
+[timeouts.operations]
+create = 30
+
+[images]
+busybox = "busybox:1.28"
+cache_dir = "/var/cache/images"
+
+[docker]
+backend = "api"
+cassette = "/tmp/docker.jsonl"
+`
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	env := []string{
+		"RUNTIME=/usr/bin/kata-runtime",
+		"TIMEOUT_DELETE=20",
+		"TIMEOUT_MINUTES=1h",
+		"CHECK_LEAKS=true",
+		"ROOTFS=",
+		"DOCKER_CASSETTE_MODE=record",
+		"IMAGE_PULL=false",
+	}
+
+	c, err := readConfig(f.Name(), env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Runtime.Path != "/usr/bin/kata-runtime" {
+		t.Errorf("environment should override the runtime path, got %s", c.Runtime.Path)
+	}
+
+	if c.Timeouts.Default != 15 || c.Timeouts.Pull != 600 {
+		t.Errorf("unexpected timeouts %+v", c.Timeouts)
+	}
+
+	if len(c.Timeouts.Operations) != 2 || c.Timeouts.Operations["create"] != 30 || c.Timeouts.Operations["delete"] != 20 {
+		t.Errorf("unexpected operation timeouts %v", c.Timeouts.Operations)
+	}
+
+	if c.Images.Busybox != "busybox:1.28" || c.Images.Alpine != "alpine" {
+		t.Errorf("unexpected images %+v", c.Images)
+	}
+
+	if c.Images.CacheDir != "/var/cache/images" || c.Images.Pull {
+		t.Errorf("unexpected image provisioning %+v", c.Images)
+	}
+
+	if c.Docker.Backend != DockerAPIBackend || c.Docker.Socket != DefaultDockerSocket {
+		t.Errorf("unexpected docker config %+v", c.Docker)
+	}
+
+	if c.Docker.Cassette != "/tmp/docker.jsonl" || c.Docker.CassetteMode != CassetteRecord {
+		t.Errorf("unexpected docker cassette %+v", c.Docker)
+	}
+
+	if c.ArtifactsDir != "/tmp/artifacts" || !c.CheckLeaks || !c.Rootfs.Cache {
+		t.Errorf("unexpected config %+v", c)
+	}
+}
+
+func TestReadConfigInvalid(t *testing.T) {
+	if _, err := readConfig("", []string{"TIMEOUT=foo"}); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+
+	if _, err := readConfig("", []string{"TIMEOUT_KILL=foo"}); err == nil {
+		t.Error("expected an error for an invalid operation timeout")
+	}
+
+	if _, err := readConfig("/nonexistent/config.toml", nil); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	c, err := readConfig("", []string{"RUNTIME_DRIVER=crun"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.validate(); err == nil {
+		t.Error("expected an error for an unknown runtime driver")
+	}
+
+	if err := DefaultConfig().validate(); err != nil {
+		t.Errorf("the default config should be valid: %v", err)
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	defer func(timeouts map[string]int, timeout int) {
+		operationTimeouts = timeouts
+		Timeout = timeout
+	}(operationTimeouts, Timeout)
+
+	Timeout = 5
+	operationTimeouts = map[string]int{"create": 30}
+
+	if timeout := OperationTimeout("create"); timeout != 30 {
+		t.Errorf("expected create timeout 30, got %d", timeout)
+	}
+
+	if timeout := OperationTimeout("start"); timeout != 5 {
+		t.Errorf("expected default timeout 5, got %d", timeout)
+	}
+}
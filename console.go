@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const ptmxPath = "/dev/ptmx"
+
+// Console is a pseudo terminal pair, the master side is kept by the
+// tests and the slave side is given to the process under test
+type Console struct {
+	master    *os.File
+	slavePath string
+}
+
+// winsize is the window size of a terminal, see TIOCSWINSZ
+type winsize struct {
+	rows   uint16
+	cols   uint16
+	xpixel uint16
+	ypixel uint16
+}
+
+// NewConsole allocates a new pseudo terminal pair
+func NewConsole() (*Console, error) {
+	master, err := os.OpenFile(ptmxPath, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saneTerminal(master); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	slavePath, err := ptsname(master)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	if err := unlockpt(master); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	return &Console{
+		master:    master,
+		slavePath: slavePath,
+	}, nil
+}
+
+// File returns the master side
+func (c *Console) File() *os.File {
+	return c.master
+}
+
+// Path returns the path of the slave side
+func (c *Console) Path() string {
+	return c.slavePath
+}
+
+// OpenSlave opens the slave side
+func (c *Console) OpenSlave() (*os.File, error) {
+	return os.OpenFile(c.slavePath, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+}
+
+// Read reads from the master side
+func (c *Console) Read(b []byte) (int, error) {
+	return c.master.Read(b)
+}
+
+// Write writes to the master side
+func (c *Console) Write(b []byte) (int, error) {
+	return c.master.Write(b)
+}
+
+// Resize sets the window size of the terminal, the foreground process
+// group of the terminal receives SIGWINCH
+func (c *Console) Resize(rows, cols uint16) error {
+	ws := winsize{rows: rows, cols: cols}
+	return ioctl(c.master.Fd(), unix.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// Close closes the master side
+func (c *Console) Close() error {
+	if m := c.master; m != nil {
+		return m.Close()
+	}
+
+	return nil
+}
+
+func ioctl(fd uintptr, flag, data uintptr) error {
+	if _, _, err := unix.Syscall(unix.SYS_IOCTL, fd, flag, data); err != 0 {
+		return err
+	}
+
+	return nil
+}
+
+// unlockpt unlocks the slave pseudo terminal of the master f,
+// it must be called before opening the slave side
+func unlockpt(f *os.File) error {
+	var u int32
+	return ioctl(f.Fd(), unix.TIOCSPTLCK, uintptr(unsafe.Pointer(&u)))
+}
+
+// ptsname returns the path of the slave pseudo terminal of the master f
+func ptsname(f *os.File) (string, error) {
+	var n int32
+	if err := ioctl(f.Fd(), unix.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+// saneTerminal disables the translation of NL to CR-NL done by default
+// by the unix98 ptys, so that the output can be matched without \r
+func saneTerminal(terminal *os.File) error {
+	var termios unix.Termios
+
+	if err := ioctl(terminal.Fd(), unix.TCGETS, uintptr(unsafe.Pointer(&termios))); err != nil {
+		return fmt.Errorf("ioctl(tty, tcgets): %s", err.Error())
+	}
+
+	termios.Oflag &^= unix.ONLCR
+
+	if err := ioctl(terminal.Fd(), unix.TCSETS, uintptr(unsafe.Pointer(&termios))); err != nil {
+		return fmt.Errorf("ioctl(tty, tcsets): %s", err.Error())
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -22,6 +23,9 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
+
+	spec "github.com/opencontainers/specs/specs-go"
 )
 
 // Container represents a clear container
@@ -57,11 +61,20 @@ type Process struct {
 	Tty         *string
 	Detach      bool
 	Workload    []string
+
+	// PidFile where the process id is written
+	// if nil then try to execute the process without --pid-file option
+	PidFile *string
+
+	// Spec is the full specification of the process, it is passed
+	// with the --process option and Workload is ignored
+	// if nil then the process is described by the other options
+	Spec *spec.Process
 }
 
 // NewContainer returns a new Container
 func NewContainer(workload []string, detach bool) (*Container, error) {
-	b, err := NewBundle(workload)
+	b, err := NewBundle(workload, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -70,52 +83,181 @@ func NewContainer(workload []string, detach bool) (*Container, error) {
 
 	pidFile := filepath.Join(b.Path, "pid")
 	logFile := filepath.Join(b.Path, "log")
-	id := RandID(20)
+	id := UniqueID(20)
 
-	return &Container{
+	c := &Container{
 		Bundle:  b,
 		Console: &console,
 		PidFile: &pidFile,
 		LogFile: &logFile,
 		Detach:  detach,
 		ID:      &id,
-	}, nil
+	}
+
+	TrackContainer(c)
+	Resources().AddContainer(c)
+
+	return c, nil
 }
 
 // Run the container
 // calls to run command returning its stdout, stderr and exit code
 func (c *Container) Run() (string, string, int) {
-	args := []string{}
+	args := []string{"run"}
+	args = append(args, c.createArgs()...)
 
-	if c.LogFile != nil {
-		args = append(args, fmt.Sprintf("--log=%s", *c.LogFile))
+	if c.Detach {
+		args = append(args, "--detach")
+	}
+
+	if c.ID != nil {
+		args = append(args, *c.ID)
+	}
+
+	return c.runtimeCommand(args...).Run()
+}
+
+// Create the container
+// calls to create command returning its stdout, stderr and exit code
+func (c *Container) Create() (string, string, int) {
+	args := []string{"create"}
+	args = append(args, c.createArgs()...)
+
+	if c.ID != nil {
+		args = append(args, *c.ID)
+	}
+
+	return c.runtimeCommand(args...).Run()
+}
+
+// Start the container
+// calls to start command returning its stdout, stderr and exit code
+func (c *Container) Start() (string, string, int) {
+	return c.runtimeCommand(c.withID("start")...).Run()
+}
+
+// State of the container
+// calls to state command returning the parsed state
+func (c *Container) State() (*spec.State, error) {
+	stdout, err := c.runtimeCommand(c.withID("state")...).runRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	var state spec.State
+	if err := json.Unmarshal([]byte(stdout), &state); err != nil {
+		return nil, fmt.Errorf("could not parse state '%s': %v", stdout, err)
+	}
+
+	return &state, nil
+}
+
+// Pause the container
+// calls to pause command returning its stdout, stderr and exit code
+func (c *Container) Pause() (string, string, int) {
+	return c.runtimeCommand(c.withID("pause")...).Run()
+}
+
+// Resume the container
+// calls to resume command returning its stdout, stderr and exit code
+func (c *Container) Resume() (string, string, int) {
+	return c.runtimeCommand(c.withID("resume")...).Run()
+}
+
+// Ps lists the processes running inside the container, psArgs are
+// passed to ps, "-ef" is used by the runtime if none is specified
+// calls to ps command returning the parsed processes
+func (c *Container) Ps(psArgs ...string) ([]ContainerProcess, error) {
+	args := c.withID("ps", "--format=table")
+	args = append(args, psArgs...)
+
+	stdout, err := c.runtimeCommand(args...).runRuntime()
+	if err != nil {
+		return nil, err
 	}
 
-	args = append(args, "run")
+	return parsePsTable(stdout)
+}
+
+// Events displays the container events, if stats is true
+// only the statistics are displayed once, otherwise the events are
+// displayed every interval until the command timeout is reached
+// calls to events command returning its stdout, stderr and exit code
+func (c *Container) Events(stats bool, interval time.Duration) (string, string, int) {
+	args := []string{"events"}
+
+	if stats {
+		args = append(args, "--stats")
+	}
+
+	if interval > 0 {
+		args = append(args, fmt.Sprintf("--interval=%s", interval))
+	}
+
+	return c.runtimeCommand(c.withID(args...)...).Run()
+}
+
+// Update the container resources
+// calls to update command returning its stdout, stderr and exit code
+func (c *Container) Update(resources *spec.LinuxResources) (string, string, int) {
+	args := []string{"update"}
+
+	if resources != nil {
+		path, err := writeTempJSON("resources", resources)
+		if err != nil {
+			return "", err.Error(), -1
+		}
+		defer os.Remove(path)
+
+		args = append(args, fmt.Sprintf("--resources=%s", path))
+	}
+
+	return c.runtimeCommand(c.withID(args...)...).Run()
+}
+
+// createArgs returns the options shared by the run and create commands
+func (c *Container) createArgs() []string {
+	args := []string{}
 
 	if c.Bundle != nil {
 		args = append(args, fmt.Sprintf("--bundle=%s", c.Bundle.Path))
 	}
 
 	if c.Console != nil {
-		args = append(args, fmt.Sprintf("--console=%s", *c.Console))
+		args = append(args, CurrentRuntimeDriver().ConsoleArgs(*c.Console)...)
 	}
 
 	if c.PidFile != nil {
 		args = append(args, fmt.Sprintf("--pid-file=%s", *c.PidFile))
 	}
 
-	if c.Detach {
-		args = append(args, "--detach")
-	}
+	return args
+}
 
+// withID appends the container ID, if any, to args
+func (c *Container) withID(args ...string) []string {
 	if c.ID != nil {
 		args = append(args, *c.ID)
 	}
 
-	cmd := NewCommand(Runtime, args...)
+	return args
+}
+
+// runtimeCommand returns a runtime command with the global options
+// of the container followed by args
+func (c *Container) runtimeCommand(args ...string) *Command {
+	a := []string{}
+
+	if c.LogFile != nil {
+		a = append(a, CurrentRuntimeDriver().LogArgs(*c.LogFile)...)
+	}
+
+	cmd := NewCommand(Runtime, append(a, args...)...)
+	if len(args) > 0 {
+		cmd.Timeout = time.Duration(OperationTimeout(args[0]))
+	}
 
-	return cmd.Run()
+	return cmd
 }
 
 // Delete the container
@@ -127,13 +269,7 @@ func (c *Container) Delete(force bool) (string, string, int) {
 		args = append(args, "--force")
 	}
 
-	if c.ID != nil {
-		args = append(args, *c.ID)
-	}
-
-	cmd := NewCommand(Runtime, args...)
-
-	return cmd.Run()
+	return c.runtimeCommand(c.withID(args...)...).Run()
 }
 
 // Kill the container
@@ -145,9 +281,7 @@ func (c *Container) Kill(all bool, signal interface{}) (string, string, int) {
 		args = append(args, "--all")
 	}
 
-	if c.ID != nil {
-		args = append(args, *c.ID)
-	}
+	args = c.withID(args...)
 
 	switch t := signal.(type) {
 	case syscall.Signal:
@@ -156,24 +290,16 @@ func (c *Container) Kill(all bool, signal interface{}) (string, string, int) {
 		args = append(args, t)
 	}
 
-	cmd := NewCommand(Runtime, args...)
-
-	return cmd.Run()
+	return c.runtimeCommand(args...).Run()
 }
 
 // Exec the container
 // calls into exec command returning its stdout, stderr and exit code
 func (c *Container) Exec(process Process) (string, string, int) {
-	args := []string{}
-
-	if c.LogFile != nil {
-		args = append(args, fmt.Sprintf("--log=%s", *c.LogFile))
-	}
-
-	args = append(args, "exec")
+	args := []string{"exec"}
 
 	if process.Console != nil {
-		args = append(args, fmt.Sprintf("--console=%s", *process.Console))
+		args = append(args, CurrentRuntimeDriver().ConsoleArgs(*process.Console)...)
 	}
 
 	if process.Tty != nil {
@@ -184,37 +310,111 @@ func (c *Container) Exec(process Process) (string, string, int) {
 		args = append(args, "--detach")
 	}
 
+	if process.PidFile != nil {
+		args = append(args, fmt.Sprintf("--pid-file=%s", *process.PidFile))
+	}
+
+	if process.Spec != nil {
+		path, err := writeTempJSON("process", process.Spec)
+		if err != nil {
+			return "", err.Error(), -1
+		}
+		defer os.Remove(path)
+
+		args = append(args, fmt.Sprintf("--process=%s", path))
+	}
+
 	if process.ContainerID != nil {
 		args = append(args, *process.ContainerID)
 	}
 
-	args = append(args, process.Workload...)
+	if process.Spec == nil {
+		args = append(args, process.Workload...)
+	}
+
+	return c.runtimeCommand(args...).Run()
+}
+
+// ProcessSpec returns the specification of a process running args,
+// it inherits the environment, working directory, user, capabilities
+// and rlimits of the container process
+func (c *Container) ProcessSpec(args ...string) *spec.Process {
+	p := &spec.Process{
+		Args: args,
+		Cwd:  "/",
+	}
+
+	if c.Bundle == nil || c.Bundle.Config == nil {
+		return p
+	}
+
+	config := c.Bundle.Config.Process
 
-	cmd := NewCommand(Runtime, args...)
+	p.Env = append([]string{}, config.Env...)
+	p.Cwd = config.Cwd
+	p.User = config.User
+	p.User.AdditionalGids = append([]uint32{}, config.User.AdditionalGids...)
+	p.Rlimits = append([]spec.LinuxRlimit{}, config.Rlimits...)
+	p.NoNewPrivileges = config.NoNewPrivileges
+	p.ApparmorProfile = config.ApparmorProfile
+	p.SelinuxLabel = config.SelinuxLabel
+
+	if config.Capabilities != nil {
+		caps := *config.Capabilities
+		p.Capabilities = &caps
+	}
 
-	return cmd.Run()
+	return p
 }
 
-// List the containers
-// calls to list command returning its stdout, stderr and exit code
-func (c *Container) List(format string, quiet bool, all bool) (string, string, int) {
-	args := []string{"list"}
+// writeTempJSON writes v as JSON in a new temporary file and returns
+// its path, the caller must remove it
+func writeTempJSON(prefix string, v interface{}) (string, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
 
-	if format != "" {
-		args = append(args, fmt.Sprintf("--format=%s", format))
+	f, err := ioutil.TempFile(TempRoot(), prefix)
+	if err != nil {
+		return "", err
 	}
+	defer f.Close()
 
-	if quiet {
-		args = append(args, "--quiet")
+	if _, err := f.Write(content); err != nil {
+		os.Remove(f.Name())
+		return "", err
 	}
 
+	return f.Name(), nil
+}
+
+// List the containers
+// calls to list command returning the parsed containers
+func (c *Container) List(all bool) ([]ContainerListEntry, error) {
+	args := []string{"list", "--format=json"}
+
 	if all {
 		args = append(args, "--all")
 	}
 
-	cmd := NewCommand(Runtime, args...)
+	stdout, err := NewCommand(Runtime, args...).runRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []ContainerListEntry
+
+	// an empty list can be printed as null or as nothing at all
+	if strings.TrimSpace(stdout) == "" {
+		return containers, nil
+	}
+
+	if err := json.Unmarshal([]byte(stdout), &containers); err != nil {
+		return nil, fmt.Errorf("could not parse list '%s': %v", stdout, err)
+	}
 
-	return cmd.Run()
+	return containers, nil
 }
 
 // SetWorkload sets a workload for the container
@@ -274,10 +474,14 @@ func (c *Container) Teardown() error {
 // Exist returns true if any of next cases is true:
 // - list command shows the container
 // - the process id specified in the pid file is running (cc-shim)
-// - the VM is running (qemu)
+// - the VM is running (qemu), if the runtime uses VMs
 // else false is returned
 func (c *Container) Exist() bool {
-	return c.isListed() || c.isWorkloadRunning() || IsVMRunning(*c.ID)
+	if c.isListed() || c.isWorkloadRunning() {
+		return true
+	}
+
+	return CurrentRuntimeDriver().Has(CapVM) && IsVMRunning(*c.ID)
 }
 
 func (c *Container) isListed() bool {
@@ -285,12 +489,18 @@ func (c *Container) isListed() bool {
 		return false
 	}
 
-	stdout, _, ret := c.List("", true, false)
-	if ret != 0 {
+	containers, err := c.List(false)
+	if err != nil {
 		return false
 	}
 
-	return strings.Contains(stdout, *c.ID)
+	for _, container := range containers {
+		if container.ID == *c.ID {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (c *Container) isWorkloadRunning() bool {
@@ -303,9 +513,11 @@ func (c *Container) isWorkloadRunning() bool {
 		return false
 	}
 
-	if _, err := os.Stat(fmt.Sprintf("/proc/%s/stat", string(content))); os.IsNotExist(err) {
+	status, err := readProcStatus(fmt.Sprintf("/proc/%s/status", strings.TrimSpace(string(content))))
+	if err != nil {
 		return false
 	}
 
-	return true
+	// a zombie is not running, it only waits for its parent
+	return !strings.HasPrefix(status["State"], "Z") && !strings.HasPrefix(status["State"], "X")
 }
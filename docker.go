@@ -16,16 +16,16 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	// Docker command
-	Docker = "docker"
+// Docker command
+const Docker = "docker"
 
+var (
 	// Image used to run containers
 	Image = "busybox"
 
@@ -64,14 +64,16 @@ func runDockerCommandWithPipe(stdin *bytes.Buffer, command string, args ...strin
 	return runDockerCommandWithTimeoutAndPipe(stdin, time.Duration(Timeout), command, args...)
 }
 
+// InspectDockerContainer returns the low-level information of a container
+func InspectDockerContainer(name string) (*DockerContainer, error) {
+	return CurrentDockerBackend().Inspect(name)
+}
+
 // LogsDockerContainer returns the container logs
 func LogsDockerContainer(name string) (string, error) {
-	args := []string{name}
-
-	stdout, _, exitCode := runDockerCommand("logs", args...)
-
-	if exitCode != 0 {
-		return "", fmt.Errorf("failed to run docker logs command")
+	stdout, _, err := CurrentDockerBackend().Logs(name)
+	if err != nil {
+		return "", err
 	}
 
 	return strings.TrimSpace(stdout), nil
@@ -79,123 +81,102 @@ func LogsDockerContainer(name string) (string, error) {
 
 // StatusDockerContainer returns the container status
 func StatusDockerContainer(name string) string {
-	args := []string{"-a", "-f", "name=" + name, "--format", "{{.Status}}"}
-
-	stdout, _, exitCode := runDockerCommand("ps", args...)
-
-	if exitCode != 0 || stdout == "" {
+	containers, err := CurrentDockerBackend().List(name, true)
+	if err != nil || len(containers) == 0 {
 		return ""
 	}
 
-	state := strings.Split(stdout, " ")
+	state := strings.Split(containers[0].Status, " ")
 	return state[0]
 }
 
 // hasExitedDockerContainer checks if the container has exited.
 func hasExitedDockerContainer(name string) (bool, error) {
-	args := []string{"--format={{.State.Status}}", name}
-
-	stdout, _, exitCode := runDockerCommand("inspect", args...)
-
-	if exitCode != 0 || stdout == "" {
-		return false, fmt.Errorf("failed to run docker inspect command")
-	}
-
-	status := strings.TrimSpace(stdout)
-
-	if status == "exited" {
-		return true, nil
+	c, err := InspectDockerContainer(name)
+	if err != nil {
+		return false, err
 	}
 
-	return false, nil
+	return c.State.Status == "exited", nil
 }
 
 // ExitCodeDockerContainer returns the container exit code
 func ExitCodeDockerContainer(name string, waitForExit bool) (int, error) {
 	// It makes no sense to try to retrieve the exit code of the container
-	// if it is still running. That's why this infinite loop takes care of
-	// waiting for the status to become "exited" before to ask for the exit
-	// code.
+	// if it is still running. That's why the status is checked each time
+	// the container stops until it becomes "exited", before to ask for
+	// the exit code.
 	// However, we might want to bypass this check on purpose, that's why
 	// we check waitForExit boolean.
 	if waitForExit {
-		errCh := make(chan error)
-		exitCh := make(chan bool)
-
-		go func() {
-			for {
-				exited, err := hasExitedDockerContainer(name)
-				if err != nil {
-					errCh <- err
-				}
-
-				if exited {
-					break
-				}
-
-				time.Sleep(time.Second)
-			}
-
-			close(exitCh)
-		}()
-
-		select {
-		case <-exitCh:
-			break
-		case err := <-errCh:
+		if err := waitForDockerContainer(name, func() (bool, error) {
+			return hasExitedDockerContainer(name)
+		}); err != nil {
 			return -1, err
-		case <-time.After(time.Duration(Timeout) * time.Second):
-			return -1, fmt.Errorf("Timeout reached after %ds", Timeout)
 		}
 	}
 
-	args := []string{"--format={{.State.ExitCode}}", name}
-
-	stdout, _, exitCode := runDockerCommand("inspect", args...)
-
-	if exitCode != 0 || stdout == "" {
-		return -1, fmt.Errorf("failed to run docker inspect command")
+	c, err := InspectDockerContainer(name)
+	if err != nil {
+		return -1, err
 	}
 
-	return strconv.Atoi(strings.TrimSpace(stdout))
+	return c.State.ExitCode, nil
 }
 
+// WaitForRunningDockerContainer waits until the container is running,
+// or not running if running is false
 func WaitForRunningDockerContainer(name string, running bool) error {
-	ch := make(chan bool)
-	go func() {
-		if IsRunningDockerContainer(name) == running {
-			close(ch)
-			return
-		}
+	return waitForDockerContainer(name, func() (bool, error) {
+		return IsRunningDockerContainer(name) == running, nil
+	})
+}
+
+// dockerStateEvents are the docker events that change the state of a container
+var dockerStateEvents = []string{"start", "die", "pause", "unpause", "destroy"}
+
+// waitForDockerContainer waits until done returns true, it is called
+// once then each time the state of the container changes
+func waitForDockerContainer(name string, done func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(Timeout)*time.Second)
+	defer cancel()
 
-		time.Sleep(time.Second)
-	}()
+	// the events are watched since before the first check, so that no
+	// change is missed while the watcher starts
+	since := time.Now()
 
-	select {
-	case <-ch:
-	case <-time.After(time.Duration(Timeout) * time.Second):
-		return fmt.Errorf("Timeout reached after %ds", Timeout)
+	if ok, err := done(); err != nil || ok {
+		return err
 	}
 
-	return nil
+	watcher := WatchDockerEvents(ctx, since, "container="+name)
+	defer watcher.Close()
+
+	for {
+		_, err := watcher.Wait(ctx, func(e Event) bool {
+			return hasString(dockerStateEvents, e.Action)
+		})
+		if err != nil {
+			return fmt.Errorf("Timeout reached after %ds: %v", Timeout, err)
+		}
+
+		if ok, err := done(); err != nil || ok {
+			return err
+		}
+	}
 }
 
 // IsRunningDockerContainer inspects a container
 // returns true if is running
 func IsRunningDockerContainer(name string) bool {
-	stdout, _, exitCode := runDockerCommand("inspect", "--format={{.State.Running}}", name)
-
-	if exitCode != 0 {
+	c, err := InspectDockerContainer(name)
+	if err != nil {
 		return false
 	}
 
-	output := strings.TrimSpace(stdout)
-	LogIfFail("container running: " + output)
-	if output == "false" {
-		return false
-	}
+	LogIfFail("container running: %t\n", c.State.Running)
 
-	return true
+	return c.State.Running
 }
 
 // ExistDockerContainer returns true if any of next cases is true:
@@ -213,50 +194,66 @@ func ExistDockerContainer(name string) bool {
 
 // RemoveDockerContainer removes a container using docker rm -f
 func RemoveDockerContainer(name string) bool {
-	_, _, exitCode := DockerRm("-f", name)
-	if exitCode != 0 {
-		return false
-	}
-
-	return true
+	return CurrentDockerBackend().Remove(name, true) == nil
 }
 
 // StopDockerContainer stops a container
 func StopDockerContainer(name string) bool {
-	_, _, exitCode := DockerStop(name)
-	if exitCode != 0 {
-		return false
-	}
-
-	return true
+	return CurrentDockerBackend().Stop(name) == nil
 }
 
 // KillDockerContainer kills a container
 func KillDockerContainer(name string) bool {
-	_, _, exitCode := DockerKill(name)
-	if exitCode != 0 {
-		return false
-	}
-
-	return true
+	return CurrentDockerBackend().Kill(name) == nil
 }
 
+// The helpers below take the arguments of a docker CLI command. DockerRun,
+// DockerCreate, DockerStart, DockerExec, DockerStop, DockerKill, DockerPause,
+// DockerUnpause and DockerRm run it through the current DockerBackend, the
+// others always run the docker CLI.
+
 // DockerRm removes a container
 func DockerRm(args ...string) (string, string, int) {
-	return runDockerCommand("rm", args...)
+	return CurrentDockerBackend().Command("rm", args...)
 }
 
 // DockerStop stops a container
 // returns true on success else false
 func DockerStop(args ...string) (string, string, int) {
 	// docker stop takes ~15 seconds
-	return runDockerCommand("stop", args...)
+	return CurrentDockerBackend().Command("stop", args...)
 }
 
 // DockerPull downloads the specific image
 func DockerPull(args ...string) (string, string, int) {
-	// 10 minutes should be enough to download a image
-	return runDockerCommandWithTimeout(600, "pull", args...)
+	a := append([]string{"pull"}, args...)
+
+	// pulling an image can take long, show its progress
+	cmd := NewCommand(Docker, a...).Stream(nil)
+
+	cmd.Timeout = time.Duration(PullTimeout)
+
+	return cmd.Run()
+}
+
+// DockerPush uploads an image to a registry
+func DockerPush(args ...string) (string, string, int) {
+	a := append([]string{"push"}, args...)
+
+	// pushing an image can take as long as pulling it
+	cmd := NewCommand(Docker, a...).Stream(nil)
+
+	cmd.Timeout = time.Duration(PullTimeout)
+
+	return cmd.Run()
+}
+
+// DockerTag creates a tag referring to an image, the tag is removed
+// with the resources of the spec
+func DockerTag(args ...string) (string, string, int) {
+	registerDockerResource("tag", args)
+
+	return runDockerCommand("tag", args...)
 }
 
 // DockerRun runs a container
@@ -268,7 +265,9 @@ func DockerRun(args ...string) (string, string, int) {
 		args[1] = Runtime
 	}
 
-	return runDockerCommand("run", args...)
+	trackDockerArgs(args)
+
+	return CurrentDockerBackend().Command("run", args...)
 }
 
 // DockerRunWithPipe runs a container with stdin
@@ -280,16 +279,20 @@ func DockerRunWithPipe(stdin *bytes.Buffer, args ...string) (string, string, int
 		args[1] = Runtime
 	}
 
+	trackDockerArgs(args)
+
 	return runDockerCommandWithPipe(stdin, "run", args...)
 }
 
 // DockerKill kills a container
 func DockerKill(args ...string) (string, string, int) {
-	return runDockerCommand("kill", args...)
+	return CurrentDockerBackend().Command("kill", args...)
 }
 
 // DockerVolume manages volumes
 func DockerVolume(args ...string) (string, string, int) {
+	registerDockerResource("volume", args)
+
 	return runDockerCommand("volume", args...)
 }
 
@@ -323,7 +326,7 @@ func DockerCp(args ...string) (string, string, int) {
 
 // DockerExec runs a command in a running container
 func DockerExec(args ...string) (string, string, int) {
-	return runDockerCommand("exec", args...)
+	return CurrentDockerBackend().Command("exec", args...)
 }
 
 // DockerPs list containers
@@ -338,7 +341,52 @@ func DockerSearch(args ...string) (string, string, int) {
 
 // DockerCreate creates a new container
 func DockerCreate(args ...string) (string, string, int) {
-	return runDockerCommand("create", args...)
+	trackDockerArgs(args)
+
+	return CurrentDockerBackend().Command("create", args...)
+}
+
+// trackDockerArgs tracks the artifacts of the container named by
+// the --name option of args, if any, and registers it
+func trackDockerArgs(args []string) {
+	if name := optionValue(args, "--name"); name != "" {
+		TrackDockerContainer(name)
+		Resources().AddDockerContainer(name)
+	}
+}
+
+// registerDockerResource registers the resource created by the docker
+// command with args, if any
+func registerDockerResource(command string, args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	switch command {
+	case "volume", "network":
+		if args[0] != "create" || len(args) < 2 {
+			return
+		}
+
+		name := args[len(args)-1]
+		if strings.HasPrefix(name, "-") {
+			return
+		}
+
+		if command == "volume" {
+			Resources().AddVolume(name)
+		} else {
+			Resources().AddNetwork(name)
+		}
+	case "build":
+		if tag := optionValue(args, "-t"); tag != "" {
+			Resources().AddImage(tag)
+		}
+	case "tag":
+		if len(args) == 2 {
+			Resources().AddImage(args[1])
+		}
+	}
 }
 
 // DockerDiff inspect changes to files or directories on a container’s filesystem
@@ -348,11 +396,15 @@ func DockerDiff(args ...string) (string, string, int) {
 
 // DockerBuild builds an image from a Dockerfile
 func DockerBuild(args ...string) (string, string, int) {
+	registerDockerResource("build", args)
+
 	return runDockerCommand("build", args...)
 }
 
 // DockerNetwork manages networks
 func DockerNetwork(args ...string) (string, string, int) {
+	registerDockerResource("network", args)
+
 	return runDockerCommand("network", args...)
 }
 
@@ -383,17 +435,17 @@ func DockerService(args ...string) (string, string, int) {
 
 // DockerStart starts one or more stopped containers
 func DockerStart(args ...string) (string, string, int) {
-	return runDockerCommand("start", args...)
+	return CurrentDockerBackend().Command("start", args...)
 }
 
 // DockerPause pauses all processes within one or more containers
 func DockerPause(args ...string) (string, string, int) {
-	return runDockerCommand("pause", args...)
+	return CurrentDockerBackend().Command("pause", args...)
 }
 
 // DockerUnpause unpauses all processes within one or more containers
 func DockerUnpause(args ...string) (string, string, int) {
-	return runDockerCommand("unpause", args...)
+	return CurrentDockerBackend().Command("unpause", args...)
 }
 
 // DockerTop displays the running processes of a container
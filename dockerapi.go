@@ -0,0 +1,536 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultDockerSocket is the default path of the Docker Engine API socket
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// dockerAPIHost is the host used in the requests, the connection is
+// always made to the unix socket
+const dockerAPIHost = "http://docker"
+
+// DockerAPIClient is the DockerBackend that talks to the Docker Engine API
+// over its unix socket
+type DockerAPIClient struct {
+	// Socket is the path of the Docker Engine API unix socket
+	Socket string
+
+	// Version of the API to use, e.g. "1.24",
+	// if empty the latest version supported by the daemon is used
+	Version string
+
+	client *http.Client
+}
+
+// DockerAPIError is returned when the Docker Engine API replies with an error
+type DockerAPIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+
+	// Message is the error message sent by the daemon
+	Message string
+}
+
+func (e *DockerAPIError) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// NewDockerAPIClient returns a new DockerAPIClient connected to socket,
+// DefaultDockerSocket is used if socket is empty
+func NewDockerAPIClient(socket string) *DockerAPIClient {
+	if socket == "" {
+		socket = DefaultDockerSocket
+	}
+
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+
+	return &DockerAPIClient{
+		Socket: socket,
+		client: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+		},
+	}
+}
+
+// Inspect returns the low-level information of a container
+func (d *DockerAPIClient) Inspect(name string) (*DockerContainer, error) {
+	var c DockerContainer
+
+	path := fmt.Sprintf("/containers/%s/json", url.PathEscape(name))
+	if err := d.getJSON(path, nil, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// List returns the containers whose name matches name,
+// all the containers if name is empty
+func (d *DockerAPIClient) List(name string, all bool) ([]DockerContainerSummary, error) {
+	query := url.Values{}
+
+	if all {
+		query.Set("all", "1")
+	}
+
+	if name != "" {
+		filters, err := json.Marshal(map[string][]string{"name": {name}})
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(filters))
+	}
+
+	var containers []DockerContainerSummary
+	if err := d.getJSON("/containers/json", query, &containers); err != nil {
+		return nil, err
+	}
+
+	// the API names start with a '/', unlike the names listed by the CLI
+	for _, c := range containers {
+		for i, n := range c.Names {
+			c.Names[i] = strings.TrimPrefix(n, "/")
+		}
+	}
+
+	return containers, nil
+}
+
+// Logs returns the stdout and stderr logs of a container
+func (d *DockerAPIClient) Logs(name string) (string, string, error) {
+	c, err := d.Inspect(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+
+	path := fmt.Sprintf("/containers/%s/logs", url.PathEscape(name))
+	body, err := d.do("GET", path, query)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the logs of a container with a tty are not multiplexed
+	if c.Config.Tty {
+		return string(body), "", nil
+	}
+
+	return demuxDockerStream(body)
+}
+
+// Remove removes a container
+func (d *DockerAPIClient) Remove(name string, force bool) error {
+	query := url.Values{}
+
+	if force {
+		query.Set("force", "1")
+	}
+
+	_, err := d.do("DELETE", "/containers/"+url.PathEscape(name), query)
+	return err
+}
+
+// Stop stops a container
+func (d *DockerAPIClient) Stop(name string) error {
+	_, err := d.do("POST", fmt.Sprintf("/containers/%s/stop", url.PathEscape(name)), nil)
+	return err
+}
+
+// Kill kills a container
+func (d *DockerAPIClient) Kill(name string) error {
+	_, err := d.do("POST", fmt.Sprintf("/containers/%s/kill", url.PathEscape(name)), nil)
+	return err
+}
+
+// DockerCreateOptions describe a container created by CreateContainer
+type DockerCreateOptions struct {
+	Name       string
+	Image      string
+	Cmd        []string
+	Entrypoint []string
+	Env        []string
+	Labels     map[string]string
+	User       string
+	WorkingDir string
+	Hostname   string
+	Tty        bool
+	OpenStdin  bool
+
+	// AutoRemove removes the container once it exits
+	AutoRemove bool
+
+	// Runtime is the OCI runtime of the container, the default
+	// runtime of the daemon if empty
+	Runtime     string
+	Privileged  bool
+	NetworkMode string
+}
+
+// DockerExecOptions describe a process run by ExecContainer
+type DockerExecOptions struct {
+	Cmd        []string
+	Env        []string
+	User       string
+	WorkingDir string
+	Tty        bool
+
+	// Detach starts the process without waiting for it
+	Detach bool
+}
+
+// CreateContainer creates a container and returns its ID, the image is
+// pulled if it is missing
+func (d *DockerAPIClient) CreateContainer(o DockerCreateOptions) (string, error) {
+	config := map[string]interface{}{
+		"Image":        o.Image,
+		"Cmd":          o.Cmd,
+		"Env":          o.Env,
+		"Labels":       o.Labels,
+		"User":         o.User,
+		"WorkingDir":   o.WorkingDir,
+		"Hostname":     o.Hostname,
+		"Tty":          o.Tty,
+		"OpenStdin":    o.OpenStdin,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"HostConfig": map[string]interface{}{
+			"Runtime":     o.Runtime,
+			"Privileged":  o.Privileged,
+			"NetworkMode": o.NetworkMode,
+			"AutoRemove":  o.AutoRemove,
+		},
+	}
+
+	if o.Entrypoint != nil {
+		config["Entrypoint"] = o.Entrypoint
+	}
+
+	query := url.Values{}
+	if o.Name != "" {
+		query.Set("name", o.Name)
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	err := d.doJSON("POST", "/containers/create", query, config, &created)
+	if apiErr, ok := err.(*DockerAPIError); ok && apiErr.StatusCode == http.StatusNotFound &&
+		strings.Contains(apiErr.Message, "No such image") {
+		if err := d.PullImage(o.Image); err != nil {
+			return "", err
+		}
+
+		err = d.doJSON("POST", "/containers/create", query, config, &created)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// PullImage pulls the image name, its tag is latest if it has neither
+// a tag nor a digest
+func (d *DockerAPIClient) PullImage(name string) error {
+	query := url.Values{}
+	if strings.Contains(name, "@") {
+		query.Set("fromImage", name)
+	} else {
+		repository := imageRepository(name)
+		tag := strings.TrimPrefix(name[len(repository):], ":")
+		if tag == "" {
+			tag = "latest"
+		}
+
+		query.Set("fromImage", repository)
+		query.Set("tag", tag)
+	}
+
+	ctx := context.Background()
+	if PullTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(PullTimeout)*time.Second)
+		defer cancel()
+	}
+
+	resp, err := d.request(ctx, "POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the progress of the pull is streamed, a failure is reported as
+	// a message with an error
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull image %s: %s", name, msg.Error)
+		}
+	}
+}
+
+// StartContainer starts a container, a running container is left as is
+func (d *DockerAPIClient) StartContainer(name string) error {
+	_, err := d.do("POST", fmt.Sprintf("/containers/%s/start", url.PathEscape(name)), nil)
+	if apiErr, ok := err.(*DockerAPIError); ok && apiErr.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	return err
+}
+
+// WaitContainer waits until a container exits and returns its exit code
+func (d *DockerAPIClient) WaitContainer(name string) (int, error) {
+	var result struct {
+		StatusCode int
+	}
+
+	if err := d.doJSON("POST", fmt.Sprintf("/containers/%s/wait", url.PathEscape(name)), nil, nil, &result); err != nil {
+		return -1, err
+	}
+
+	return result.StatusCode, nil
+}
+
+// PauseContainer pauses the processes of a container
+func (d *DockerAPIClient) PauseContainer(name string) error {
+	_, err := d.do("POST", fmt.Sprintf("/containers/%s/pause", url.PathEscape(name)), nil)
+	return err
+}
+
+// UnpauseContainer resumes the processes of a paused container
+func (d *DockerAPIClient) UnpauseContainer(name string) error {
+	_, err := d.do("POST", fmt.Sprintf("/containers/%s/unpause", url.PathEscape(name)), nil)
+	return err
+}
+
+// ExecContainer runs a process in a running container and returns its
+// stdout, stderr and exit code, a detached process returns at once
+func (d *DockerAPIClient) ExecContainer(name string, o DockerExecOptions) (string, string, int, error) {
+	config := map[string]interface{}{
+		"Cmd":          o.Cmd,
+		"Env":          o.Env,
+		"User":         o.User,
+		"WorkingDir":   o.WorkingDir,
+		"Tty":          o.Tty,
+		"AttachStdout": !o.Detach,
+		"AttachStderr": !o.Detach,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+
+	if err := d.doJSON("POST", fmt.Sprintf("/containers/%s/exec", url.PathEscape(name)), nil, config, &created); err != nil {
+		return "", "", -1, err
+	}
+
+	// the output is streamed until the process exits
+	body, err := d.doBody("POST", fmt.Sprintf("/exec/%s/start", created.ID), nil,
+		map[string]interface{}{"Detach": o.Detach, "Tty": o.Tty})
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	if o.Detach {
+		return "", "", 0, nil
+	}
+
+	stdout, stderr := string(body), ""
+	if !o.Tty {
+		if stdout, stderr, err = demuxDockerStream(body); err != nil {
+			return "", "", -1, err
+		}
+	}
+
+	var state struct {
+		ExitCode int
+	}
+
+	if err := d.getJSON(fmt.Sprintf("/exec/%s/json", created.ID), nil, &state); err != nil {
+		return stdout, stderr, -1, err
+	}
+
+	return stdout, stderr, state.ExitCode, nil
+}
+
+func (d *DockerAPIClient) getJSON(path string, query url.Values, v interface{}) error {
+	body, err := d.do("GET", path, query)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// doJSON sends in, if not nil, as the JSON body of a request and decodes
+// the JSON body of the response in out, if not nil
+func (d *DockerAPIClient) doJSON(method, path string, query url.Values, in, out interface{}) error {
+	body, err := d.doBody(method, path, query, in)
+	if err != nil || out == nil {
+		return err
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// do sends a request to the daemon and returns the body of the response,
+// the request is cancelled once Timeout is reached
+func (d *DockerAPIClient) do(method, path string, query url.Values) ([]byte, error) {
+	return d.doBody(method, path, query, nil)
+}
+
+// doBody is do with in, if not nil, sent as the JSON body of the request
+func (d *DockerAPIClient) doBody(method, path string, query url.Values, in interface{}) ([]byte, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+	}
+
+	ctx := context.Background()
+	if Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(Timeout)*time.Second)
+		defer cancel()
+	}
+
+	resp, err := d.request(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// request sends a request to the daemon, the caller must close the body
+// of the response. An error is returned if the daemon replies with an
+// error status code.
+func (d *DockerAPIClient) request(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	if d.Version != "" {
+		path = "/v" + d.Version + path
+	}
+
+	u := dockerAPIHost + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	LogIfFail("Docker API request '%s %s'\n", method, u)
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		apiErr := &DockerAPIError{StatusCode: resp.StatusCode}
+
+		content, _ := ioutil.ReadAll(resp.Body)
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(content, &msg) == nil && msg.Message != "" {
+			apiErr.Message = msg.Message
+		} else {
+			apiErr.Message = string(bytes.TrimSpace(content))
+		}
+
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// demuxDockerStream splits a multiplexed stdout and stderr stream, each
+// frame has an 8 bytes header: the stream type, 3 bytes of padding and
+// the big endian size of the payload
+func demuxDockerStream(data []byte) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return "", "", fmt.Errorf("short stream header")
+		}
+
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		if len(data) < 8+size {
+			return "", "", fmt.Errorf("short stream frame")
+		}
+
+		payload := data[8 : 8+size]
+
+		switch data[0] {
+		case 0, 1:
+			stdout.Write(payload)
+		case 2:
+			stderr.Write(payload)
+		default:
+			return "", "", fmt.Errorf("unknown stream type %d", data[0])
+		}
+
+		data = data[8+size:]
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newFakeDockerDaemon starts an HTTP server listening on a unix socket
+// and returns a DockerAPIClient connected to it
+func newFakeDockerDaemon(t *testing.T, handler http.Handler) (*DockerAPIClient, func()) {
+	dir, err := ioutil.TempDir("", "docker-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = l
+	server.Start()
+
+	return NewDockerAPIClient(socket), func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func muxFrame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDockerAPIInspect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/foo/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{
+			"Id":   "1234",
+			"Name": "/foo",
+			"State": map[string]interface{}{
+				"Status":   "exited",
+				"ExitCode": 3,
+			},
+			"HostConfig": map[string]interface{}{
+				"Runtime": "cc-runtime",
+			},
+		})
+	})
+	mux.HandleFunc("/containers/bar/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, map[string]string{"message": "No such container: bar"})
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	c, err := client.Inspect("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ID != "1234" || c.State.Status != "exited" || c.State.ExitCode != 3 || c.HostConfig.Runtime != "cc-runtime" {
+		t.Errorf("unexpected container %+v", c)
+	}
+
+	_, err = client.Inspect("bar")
+	apiErr, ok := err.(*DockerAPIError)
+	if !ok {
+		t.Fatalf("expected a DockerAPIError, got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: bar" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestDockerAPIList(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "1" {
+			t.Errorf("expected all=1, got %s", r.URL.RawQuery)
+		}
+
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			t.Error(err)
+		}
+
+		if len(filters["name"]) != 1 || filters["name"][0] != "foo" {
+			t.Errorf("unexpected filters %v", filters)
+		}
+
+		writeJSON(t, w, []map[string]interface{}{
+			{"Id": "1234", "Names": []string{"/foo"}, "State": "running", "Status": "Up 2 seconds"},
+		})
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	containers, err := client.List("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(containers) != 1 || containers[0].Status != "Up 2 seconds" || containers[0].Names[0] != "foo" {
+		t.Errorf("unexpected containers %+v", containers)
+	}
+}
+
+func TestDockerAPILogs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/foo/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{"Id": "1234", "Config": map[string]interface{}{"Tty": false}})
+	})
+	mux.HandleFunc("/containers/foo/logs", func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		b.Write(muxFrame(1, "hello "))
+		b.Write(muxFrame(2, "oops"))
+		b.Write(muxFrame(1, "world"))
+		_, _ = w.Write(b.Bytes())
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	stdout, stderr, err := client.Logs("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout != "hello world" || stderr != "oops" {
+		t.Errorf("unexpected logs stdout=%q stderr=%q", stdout, stderr)
+	}
+}
+
+func TestDockerAPIRemove(t *testing.T) {
+	removed := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/foo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Query().Get("force") != "1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		removed = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	if err := client.Remove("foo", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !removed {
+		t.Error("container was not removed")
+	}
+}
+
+func TestDockerHelpersWithAPIBackend(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/foo/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{
+			"Id":    "1234",
+			"State": map[string]interface{}{"Status": "exited", "ExitCode": 42},
+		})
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	SetDockerBackend(client)
+	defer SetDockerBackend(nil)
+
+	exitCode, err := ExitCodeDockerContainer("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 42 {
+		t.Errorf("expected exit code 42, got %d", exitCode)
+	}
+
+	if IsRunningDockerContainer("foo") {
+		t.Error("container should not be running")
+	}
+}
+
+func TestDockerBackendsList(t *testing.T) {
+	c, err := NewCassette("", CassetteReplay, Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Add(CassetteInteraction{
+		Args:   []string{Docker, "ps", "--no-trunc", "--format", "{{json .}}", "-a", "-f", "name=foo"},
+		Stdout: `{"ID":"1234","Names":"foo","Image":"busybox","State":"running","Status":"Up 2 seconds"}` + "\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	UseCassette(c)
+	defer UseCassette(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []map[string]interface{}{
+			{"Id": "1234", "Names": []string{"/foo"}, "Image": "busybox", "State": "running", "Status": "Up 2 seconds"},
+		})
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	cli, err := (&dockerCLI{}).List("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := client.List("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cli, api) {
+		t.Errorf("the backends list different containers, cli %+v, api %+v", cli, api)
+	}
+}
+
+func TestDockerAPIRun(t *testing.T) {
+	var created map[string]interface{}
+	removed := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "foo" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Error(err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, map[string]string{"Id": "1234"})
+	})
+	mux.HandleFunc("/containers/1234/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/containers/1234/wait", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]int{"StatusCode": 3})
+	})
+	mux.HandleFunc("/containers/1234/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{"Id": "1234", "Config": map[string]interface{}{"Tty": false}})
+	})
+	mux.HandleFunc("/containers/1234/logs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(muxFrame(1, "hello\n"))
+	})
+	mux.HandleFunc("/containers/1234", func(w http.ResponseWriter, r *http.Request) {
+		removed = r.Method == "DELETE"
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	stdout, stderr, exitCode := client.Command("run", "--rm", "--runtime", "cc-runtime", "--name=foo",
+		"-e", "FOO=bar", "busybox", "sh", "-c", "echo hello; exit 3")
+	if stdout != "hello\n" || stderr != "" || exitCode != 3 {
+		t.Errorf("unexpected result stdout=%q stderr=%q exit code=%d", stdout, stderr, exitCode)
+	}
+
+	if !removed {
+		t.Error("container was not removed")
+	}
+
+	hostConfig, _ := created["HostConfig"].(map[string]interface{})
+	if created["Image"] != "busybox" || !reflect.DeepEqual(created["Cmd"], []interface{}{"sh", "-c", "echo hello; exit 3"}) ||
+		!reflect.DeepEqual(created["Env"], []interface{}{"FOO=bar"}) || hostConfig["Runtime"] != "cc-runtime" {
+		t.Errorf("unexpected container %v", created)
+	}
+
+	// a detached container is only started
+	stdout, _, exitCode = client.Command("run", "-dt", "--name", "foo", "busybox")
+	if stdout != "1234\n" || exitCode != 0 {
+		t.Errorf("unexpected result stdout=%q exit code=%d", stdout, exitCode)
+	}
+
+	if created["Tty"] != true {
+		t.Errorf("expected a tty, got %v", created)
+	}
+}
+
+func TestDockerAPIExec(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/foo/exec", func(w http.ResponseWriter, r *http.Request) {
+		var config map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(config["Cmd"], []interface{}{"ls", "/nope"}) || config["User"] != "nobody" {
+			t.Errorf("unexpected exec %v", config)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(t, w, map[string]string{"Id": "5678"})
+	})
+	mux.HandleFunc("/exec/5678/start", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(muxFrame(2, "ls: /nope: No such file or directory\n"))
+	})
+	mux.HandleFunc("/exec/5678/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]int{"ExitCode": 1})
+	})
+
+	client, cleanup := newFakeDockerDaemon(t, mux)
+	defer cleanup()
+
+	stdout, stderr, exitCode := client.Command("exec", "-u", "nobody", "foo", "ls", "/nope")
+	if stdout != "" || stderr != "ls: /nope: No such file or directory\n" || exitCode != 1 {
+		t.Errorf("unexpected result stdout=%q stderr=%q exit code=%d", stdout, stderr, exitCode)
+	}
+
+	// the errors of the daemon are reported as the CLI does
+	_, stderr, exitCode = client.Command("stop", "bar")
+	if stderr == "" || exitCode != 1 {
+		t.Errorf("unexpected result stderr=%q exit code=%d", stderr, exitCode)
+	}
+}
+
+func TestDockerAPICommandFallback(t *testing.T) {
+	c, err := NewCassette("", CassetteReplay, Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// publishing ports is not supported by the API backend
+	args := []string{"-d", "-p", "8080:80", "nginx"}
+	if err := c.Add(CassetteInteraction{
+		Args:   append([]string{Docker, "run"}, args...),
+		Stdout: "1234\n",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	UseCassette(c)
+	defer UseCassette(nil)
+
+	client, cleanup := newFakeDockerDaemon(t, http.NotFoundHandler())
+	defer cleanup()
+
+	stdout, _, exitCode := client.Command("run", args...)
+	if stdout != "1234\n" || exitCode != 0 {
+		t.Errorf("unexpected result stdout=%q exit code=%d", stdout, exitCode)
+	}
+
+	if unplayed := c.Unplayed(); len(unplayed) != 0 {
+		t.Errorf("unexpected unplayed interactions %v", unplayed)
+	}
+}
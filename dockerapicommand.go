@@ -0,0 +1,432 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// dockerOption is an option of a docker CLI command
+type dockerOption struct {
+	// name is the long name of the option, without the dashes
+	name string
+
+	// value is true if the option takes a value
+	value bool
+}
+
+// dockerOptions maps the short and long forms of the options of a
+// docker CLI command to the option
+type dockerOptions map[string]dockerOption
+
+// newDockerOptions returns the dockerOptions of opts, each given as its
+// long name, its short name if any, and whether it takes a value
+func newDockerOptions(opts ...dockerOption) dockerOptions {
+	options := dockerOptions{}
+
+	for _, o := range opts {
+		names := strings.Split(o.name, ",")
+		o.name = names[0]
+
+		options["--"+names[0]] = o
+		for _, short := range names[1:] {
+			options["-"+short] = o
+		}
+	}
+
+	return options
+}
+
+// dockerContainerOptions are the options of 'docker run' and
+// 'docker create' that the API backend supports
+var dockerContainerOptions = newDockerOptions(
+	dockerOption{name: "detach,d"},
+	dockerOption{name: "tty,t"},
+	dockerOption{name: "interactive,i"},
+	dockerOption{name: "rm"},
+	dockerOption{name: "privileged"},
+	dockerOption{name: "name", value: true},
+	dockerOption{name: "env,e", value: true},
+	dockerOption{name: "runtime", value: true},
+	dockerOption{name: "workdir,w", value: true},
+	dockerOption{name: "user,u", value: true},
+	dockerOption{name: "hostname,h", value: true},
+	dockerOption{name: "entrypoint", value: true},
+	dockerOption{name: "label,l", value: true},
+	dockerOption{name: "network", value: true},
+	dockerOption{name: "net", value: true},
+)
+
+// dockerCommandOptions are the options of the other docker CLI commands
+// that the API backend supports
+var dockerCommandOptions = map[string]dockerOptions{
+	"start":   newDockerOptions(),
+	"pause":   newDockerOptions(),
+	"unpause": newDockerOptions(),
+	"rm": newDockerOptions(
+		dockerOption{name: "force,f"},
+		dockerOption{name: "volumes,v"},
+	),
+	"stop": newDockerOptions(
+		dockerOption{name: "time,t", value: true},
+	),
+	"kill": newDockerOptions(
+		dockerOption{name: "signal,s", value: true},
+	),
+	"exec": newDockerOptions(
+		dockerOption{name: "detach,d"},
+		dockerOption{name: "tty,t"},
+		dockerOption{name: "interactive,i"},
+		dockerOption{name: "env,e", value: true},
+		dockerOption{name: "user,u", value: true},
+		dockerOption{name: "workdir,w", value: true},
+	),
+	"run":    dockerContainerOptions,
+	"create": dockerContainerOptions,
+}
+
+// dockerArgs are the parsed arguments of a docker CLI command
+type dockerArgs struct {
+	// flags are the boolean options set
+	flags map[string]bool
+
+	// values are the values of the options taking one, by option
+	values map[string][]string
+
+	// operands are the arguments following the options
+	operands []string
+}
+
+// value returns the last value of the option name, "" if not given
+func (a *dockerArgs) value(name string) string {
+	values := a.values[name]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[len(values)-1]
+}
+
+// env returns the environment variables set by the env options, a
+// variable given without a value takes the one of the host
+func (a *dockerArgs) env() []string {
+	var env []string
+
+	for _, e := range a.values["env"] {
+		if !strings.Contains(e, "=") {
+			v, ok := os.LookupEnv(e)
+			if !ok {
+				continue
+			}
+			e += "=" + v
+		}
+
+		env = append(env, e)
+	}
+
+	return env
+}
+
+// parseDockerArgs parses args with options, as the docker CLI does the
+// options end at the first operand. An error is returned for an option
+// not in options.
+func parseDockerArgs(args []string, options dockerOptions) (*dockerArgs, error) {
+	a := &dockerArgs{
+		flags:  map[string]bool{},
+		values: map[string][]string{},
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			a.operands = args[i+1:]
+			return a, nil
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			a.operands = args[i:]
+			return a, nil
+		}
+
+		name, value, hasValue := arg, "", false
+		if j := strings.Index(arg, "="); j > 0 {
+			name, value, hasValue = arg[:j], arg[j+1:], true
+		}
+
+		o, ok := options[name]
+		switch {
+		case !ok && !strings.HasPrefix(name, "--") && !hasValue && len(name) > 2:
+			// combined short boolean options, such as -dt
+			for _, c := range name[1:] {
+				o, ok := options["-"+string(c)]
+				if !ok || o.value {
+					return nil, fmt.Errorf("unsupported option %s", arg)
+				}
+				a.flags[o.name] = true
+			}
+		case !ok:
+			return nil, fmt.Errorf("unsupported option %s", arg)
+		case o.value:
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("option %s needs a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			a.values[o.name] = append(a.values[o.name], value)
+		case hasValue:
+			switch value {
+			case "true":
+				a.flags[o.name] = true
+			case "false":
+				a.flags[o.name] = false
+			default:
+				return nil, fmt.Errorf("invalid value %s", arg)
+			}
+		default:
+			a.flags[o.name] = true
+		}
+	}
+
+	return a, nil
+}
+
+// dockerCLIError formats err as the docker CLI reports the errors of
+// the daemon
+func dockerCLIError(err error) string {
+	if apiErr, ok := err.(*DockerAPIError); ok {
+		return fmt.Sprintf("Error response from daemon: %s\n", apiErr.Message)
+	}
+
+	return fmt.Sprintf("Error: %v\n", err)
+}
+
+// Command runs the docker CLI command with args through the API and
+// returns the output and exit code the CLI would. The commands and
+// options the API backend does not support are run by the docker CLI.
+func (d *DockerAPIClient) Command(command string, args ...string) (string, string, int) {
+	options, ok := dockerCommandOptions[command]
+	if !ok {
+		return runDockerCommand(command, args...)
+	}
+
+	a, err := parseDockerArgs(args, options)
+	if err != nil {
+		LogIfFail("docker %s %v: %v, running the docker CLI\n", command, args, err)
+		return runDockerCommand(command, args...)
+	}
+
+	LogIfFail("Docker API command: %s %v\n", command, args)
+
+	switch command {
+	case "run", "create":
+		return d.runContainer(command, a)
+	case "exec":
+		return d.execContainer(a)
+	}
+
+	return d.manageContainers(command, a)
+}
+
+// runContainer creates a container, it is also started for 'run'
+func (d *DockerAPIClient) runContainer(command string, a *dockerArgs) (string, string, int) {
+	if len(a.operands) == 0 {
+		return "", fmt.Sprintf("\"docker %s\" requires at least 1 argument.\n", command), 1
+	}
+
+	// 'docker run' attached to the container waits for it to exit and
+	// removes it itself, after reading its logs
+	attached := command == "run" && !a.flags["detach"]
+
+	o := DockerCreateOptions{
+		Name:        a.value("name"),
+		Image:       a.operands[0],
+		Cmd:         a.operands[1:],
+		Env:         a.env(),
+		User:        a.value("user"),
+		WorkingDir:  a.value("workdir"),
+		Hostname:    a.value("hostname"),
+		Tty:         a.flags["tty"],
+		OpenStdin:   a.flags["interactive"] && !attached,
+		AutoRemove:  a.flags["rm"] && !attached,
+		Runtime:     a.value("runtime"),
+		Privileged:  a.flags["privileged"],
+		NetworkMode: a.value("network"),
+	}
+
+	if network := a.value("net"); network != "" {
+		o.NetworkMode = network
+	}
+
+	if len(o.Cmd) == 0 {
+		o.Cmd = nil
+	}
+
+	if entrypoint, ok := a.values["entrypoint"]; ok {
+		o.Entrypoint = []string{entrypoint[len(entrypoint)-1]}
+		if o.Entrypoint[0] == "" {
+			o.Entrypoint = []string{}
+		}
+	}
+
+	for _, l := range a.values["label"] {
+		if o.Labels == nil {
+			o.Labels = map[string]string{}
+		}
+
+		kv := strings.SplitN(l, "=", 2)
+		o.Labels[kv[0]] = ""
+		if len(kv) == 2 {
+			o.Labels[kv[0]] = kv[1]
+		}
+	}
+
+	id, err := d.CreateContainer(o)
+	if err != nil {
+		return "", dockerCLIError(err), 125
+	}
+
+	if command == "create" {
+		return id + "\n", "", 0
+	}
+
+	if err := d.StartContainer(id); err != nil {
+		if attached && a.flags["rm"] {
+			d.Remove(id, true)
+		}
+
+		return "", dockerCLIError(err), dockerStartExitCode(err)
+	}
+
+	if !attached {
+		return id + "\n", "", 0
+	}
+
+	exitCode, err := d.WaitContainer(id)
+	if err != nil {
+		return "", dockerCLIError(err), 125
+	}
+
+	stdout, stderr, err := d.Logs(id)
+	if err != nil {
+		return stdout, stderr + dockerCLIError(err), 125
+	}
+
+	if a.flags["rm"] {
+		if err := d.Remove(id, true); err != nil {
+			stderr += dockerCLIError(err)
+		}
+	}
+
+	return stdout, stderr, exitCode
+}
+
+// dockerStartExitCode returns the exit code of 'docker run' when the
+// container fails to start with err
+func dockerStartExitCode(err error) int {
+	msg := err.Error()
+
+	switch {
+	case strings.Contains(msg, "executable file not found"),
+		strings.Contains(msg, "no such file or directory"):
+		return 127
+	case strings.Contains(msg, "permission denied"):
+		return 126
+	}
+
+	return 125
+}
+
+// execContainer runs a process in a running container
+func (d *DockerAPIClient) execContainer(a *dockerArgs) (string, string, int) {
+	if len(a.operands) < 2 {
+		return "", "\"docker exec\" requires at least 2 arguments.\n", 1
+	}
+
+	stdout, stderr, exitCode, err := d.ExecContainer(a.operands[0], DockerExecOptions{
+		Cmd:        a.operands[1:],
+		Env:        a.env(),
+		User:       a.value("user"),
+		WorkingDir: a.value("workdir"),
+		Tty:        a.flags["tty"],
+		Detach:     a.flags["detach"],
+	})
+	if err != nil {
+		return stdout, stderr + dockerCLIError(err), 126
+	}
+
+	return stdout, stderr, exitCode
+}
+
+// manageContainers runs command, such as 'docker stop', on each of the
+// containers of a, the names of the containers managed are printed
+func (d *DockerAPIClient) manageContainers(command string, a *dockerArgs) (string, string, int) {
+	if len(a.operands) == 0 {
+		return "", fmt.Sprintf("\"docker %s\" requires at least 1 argument.\n", command), 1
+	}
+
+	var stdout, stderr string
+	exitCode := 0
+
+	for _, name := range a.operands {
+		path := "/containers/" + url.PathEscape(name)
+		query := url.Values{}
+		method := "POST"
+
+		switch command {
+		case "rm":
+			method = "DELETE"
+			if a.flags["force"] {
+				query.Set("force", "1")
+			}
+			if a.flags["volumes"] {
+				query.Set("v", "1")
+			}
+		case "stop":
+			path += "/stop"
+			if t := a.value("time"); t != "" {
+				query.Set("t", t)
+			}
+		case "kill":
+			path += "/kill"
+			if s := a.value("signal"); s != "" {
+				query.Set("signal", s)
+			}
+		default:
+			path += "/" + command
+		}
+
+		_, err := d.do(method, path, query)
+		if apiErr, ok := err.(*DockerAPIError); ok && command == "start" && apiErr.StatusCode == http.StatusNotModified {
+			err = nil
+		}
+
+		if err != nil {
+			stderr += dockerCLIError(err)
+			exitCode = 1
+			continue
+		}
+
+		stdout += name + "\n"
+	}
+
+	return stdout, stderr, exitCode
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerCLIBackend is the name of the backend that runs the docker CLI
+	DockerCLIBackend = "cli"
+
+	// DockerAPIBackend is the name of the backend that talks to the
+	// Docker Engine API
+	DockerAPIBackend = "api"
+)
+
+// DockerBackendName is the backend used by the docker helpers,
+// DockerCLIBackend or DockerAPIBackend
+var DockerBackendName string
+
+// DockerSocket is the path of the Docker Engine API unix socket
+var DockerSocket string
+
+// dockerBackend is the backend in use, see CurrentDockerBackend
+var dockerBackend DockerBackend
+
+// DockerBackend manages docker containers returning typed results. It is
+// used by the helpers working on an existing container by name, such as
+// InspectDockerContainer, StatusDockerContainer, ExitCodeDockerContainer,
+// LogsDockerContainer and RemoveDockerContainer, and through Command by the
+// container helpers taking docker CLI arguments, such as DockerRun,
+// DockerCreate and DockerExec.
+type DockerBackend interface {
+	// Command runs the docker container command, such as run or exec,
+	// with the docker CLI arguments args and returns the stdout, stderr
+	// and exit code the docker CLI would
+	Command(command string, args ...string) (string, string, int)
+
+	// Inspect returns the low-level information of a container
+	Inspect(name string) (*DockerContainer, error)
+
+	// List returns the containers whose name matches name,
+	// all the containers if name is empty
+	List(name string, all bool) ([]DockerContainerSummary, error)
+
+	// Logs returns the stdout and stderr logs of a container
+	Logs(name string) (string, string, error)
+
+	// Remove removes a container
+	Remove(name string, force bool) error
+
+	// Stop stops a container
+	Stop(name string) error
+
+	// Kill kills a container
+	Kill(name string) error
+}
+
+// DockerContainerState is the state of a docker container
+type DockerContainerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  string
+	FinishedAt string
+}
+
+// DockerContainerConfig is the configuration of a docker container
+type DockerContainerConfig struct {
+	Hostname string
+	User     string
+	Tty      bool
+	Env      []string
+	Cmd      []string
+	Image    string
+	Labels   map[string]string
+}
+
+// DockerHostConfig is the host configuration of a docker container
+type DockerHostConfig struct {
+	Runtime     string
+	NetworkMode string
+	Privileged  bool
+}
+
+// DockerContainer is the low-level information of a docker container,
+// as returned by 'docker inspect'
+type DockerContainer struct {
+	ID         string `json:"Id"`
+	Name       string
+	Image      string
+	State      DockerContainerState
+	Config     DockerContainerConfig
+	HostConfig DockerHostConfig
+}
+
+// DockerContainerSummary is a container as listed by 'docker ps'
+type DockerContainerSummary struct {
+	ID     string `json:"Id"`
+	Names  []string
+	Image  string
+	State  string
+	Status string
+}
+
+// CurrentDockerBackend returns the backend used by the docker helpers,
+// the first call creates it from DockerBackendName
+func CurrentDockerBackend() DockerBackend {
+	if dockerBackend != nil {
+		return dockerBackend
+	}
+
+	b, err := NewDockerBackend(DockerBackendName)
+	if err != nil {
+		LogIfFail("%v, using the %s backend\n", err, DockerCLIBackend)
+		b = &dockerCLI{}
+	}
+
+	dockerBackend = b
+
+	return dockerBackend
+}
+
+// SetDockerBackend sets the backend used by the docker helpers
+func SetDockerBackend(b DockerBackend) {
+	dockerBackend = b
+}
+
+// NewDockerBackend returns the docker backend called name
+func NewDockerBackend(name string) (DockerBackend, error) {
+	switch name {
+	case "", DockerCLIBackend:
+		return &dockerCLI{}, nil
+	case DockerAPIBackend:
+		return NewDockerAPIClient(DockerSocket), nil
+	}
+
+	return nil, fmt.Errorf("unknown docker backend '%s'", name)
+}
+
+// dockerCLI is the DockerBackend that runs the docker CLI
+type dockerCLI struct{}
+
+func (d *dockerCLI) Command(command string, args ...string) (string, string, int) {
+	return runDockerCommand(command, args...)
+}
+
+func (d *dockerCLI) Inspect(name string) (*DockerContainer, error) {
+	stdout, stderr, exitCode := runDockerCommand("inspect", "--type=container", name)
+	if exitCode != 0 {
+		return nil, fmt.Errorf("failed to inspect container %s: %s", name, stderr)
+	}
+
+	var containers []DockerContainer
+	if err := json.Unmarshal([]byte(stdout), &containers); err != nil {
+		return nil, err
+	}
+
+	if len(containers) != 1 {
+		return nil, fmt.Errorf("expected 1 container named %s, got %d", name, len(containers))
+	}
+
+	return &containers[0], nil
+}
+
+func (d *dockerCLI) List(name string, all bool) ([]DockerContainerSummary, error) {
+	args := []string{"--no-trunc", "--format", "{{json .}}"}
+
+	if all {
+		args = append(args, "-a")
+	}
+
+	if name != "" {
+		args = append(args, "-f", "name="+name)
+	}
+
+	stdout, stderr, exitCode := runDockerCommand("ps", args...)
+	if exitCode != 0 {
+		return nil, fmt.Errorf("failed to list containers: %s", stderr)
+	}
+
+	var containers []DockerContainerSummary
+
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// the CLI template output differs from the API one
+		var c struct {
+			ID     string
+			Names  string
+			Image  string
+			State  string
+			Status string
+		}
+
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, err
+		}
+
+		containers = append(containers, DockerContainerSummary{
+			ID:     c.ID,
+			Names:  strings.Split(c.Names, ","),
+			Image:  c.Image,
+			State:  c.State,
+			Status: c.Status,
+		})
+	}
+
+	return containers, nil
+}
+
+func (d *dockerCLI) Logs(name string) (string, string, error) {
+	stdout, stderr, exitCode := runDockerCommand("logs", name)
+	if exitCode != 0 {
+		return "", "", fmt.Errorf("failed to run docker logs command")
+	}
+
+	return stdout, stderr, nil
+}
+
+func (d *dockerCLI) Remove(name string, force bool) error {
+	args := []string{name}
+
+	if force {
+		args = append([]string{"-f"}, args...)
+	}
+
+	return d.run("rm", args...)
+}
+
+func (d *dockerCLI) Stop(name string) error {
+	return d.run("stop", name)
+}
+
+func (d *dockerCLI) Kill(name string) error {
+	return d.run("kill", name)
+}
+
+func (d *dockerCLI) run(command string, args ...string) error {
+	_, stderr, exitCode := runDockerCommand(command, args...)
+	if exitCode != 0 {
+		return fmt.Errorf("docker %s failed: %s", command, stderr)
+	}
+
+	return nil
+}
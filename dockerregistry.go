@@ -0,0 +1,547 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	registryUploadPath   = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([^/]*)$`)
+	registryBlobPath     = regexp.MustCompile(`^/v2/(.+)/blobs/(sha256:[0-9a-f]{64})$`)
+	registryManifestPath = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+	registryTagsPath     = regexp.MustCompile(`^/v2/(.+)/tags/list$`)
+)
+
+// DockerRegistry is a minimal Docker Registry v2 served by the tests
+// process on localhost. It keeps the blobs and manifests in memory and
+// answers the v1 search requests of docker search.
+type DockerRegistry struct {
+	// Addr is the host:port of the registry
+	Addr string
+
+	listener net.Listener
+	server   *http.Server
+
+	lock      sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string]*bytes.Buffer
+	manifests map[string]map[string]registryManifest
+	faults    []*RegistryFault
+	requests  []string
+	uploadID  int
+}
+
+// registryManifest is a manifest pushed to the registry
+type registryManifest struct {
+	mediaType string
+	content   []byte
+}
+
+// RegistryFault makes the registry answer the matching requests slowly
+// or with an error
+type RegistryFault struct {
+	// Method of the requests, all the methods if empty
+	Method string
+
+	// Path is a regular expression matching the path of the requests,
+	// all the paths if empty
+	Path string
+
+	// Delay is waited before answering
+	Delay time.Duration
+
+	// Status is the HTTP status answered instead of serving the
+	// request, the request is served if 0
+	Status int
+
+	// Count is the number of requests affected, all of them if 0
+	Count int
+
+	path *regexp.Regexp
+	hits int
+}
+
+// StartDockerRegistry starts a registry listening on a random port of
+// the loopback interface, docker talks to it over plain HTTP
+func StartDockerRegistry() (*DockerRegistry, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not start the docker registry: %v", err)
+	}
+
+	r := &DockerRegistry{
+		Addr:      l.Addr().String(),
+		listener:  l,
+		blobs:     make(map[string][]byte),
+		uploads:   make(map[string]*bytes.Buffer),
+		manifests: make(map[string]map[string]registryManifest),
+	}
+
+	r.server = &http.Server{Handler: r}
+	go r.server.Serve(l)
+
+	return r, nil
+}
+
+// Close stops the registry
+func (r *DockerRegistry) Close() error {
+	return r.server.Close()
+}
+
+// Image returns the name of the repository name in the registry,
+// e.g. 127.0.0.1:5000/busybox
+func (r *DockerRegistry) Image(name string) string {
+	return r.Addr + "/" + name
+}
+
+// InjectFault adds a fault, the first fault matching a request applies
+func (r *DockerRegistry) InjectFault(f RegistryFault) error {
+	if f.Path != "" {
+		re, err := regexp.Compile(f.Path)
+		if err != nil {
+			return fmt.Errorf("invalid registry fault path %s: %v", f.Path, err)
+		}
+		f.path = re
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.faults = append(r.faults, &f)
+
+	return nil
+}
+
+// ClearFaults removes the faults
+func (r *DockerRegistry) ClearFaults() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.faults = nil
+}
+
+// Requests returns the requests served, as "METHOD path"
+func (r *DockerRegistry) Requests() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]string(nil), r.requests...)
+}
+
+// Repositories returns the names of the repositories, sorted
+func (r *DockerRegistry) Repositories() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.repositories()
+}
+
+// Tags returns the tags of the repository name, sorted
+func (r *DockerRegistry) Tags(name string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.tags(name)
+}
+
+func (r *DockerRegistry) repositories() []string {
+	repos := []string{}
+	for name := range r.manifests {
+		repos = append(repos, name)
+	}
+	sort.Strings(repos)
+
+	return repos
+}
+
+func (r *DockerRegistry) tags(name string) []string {
+	tags := []string{}
+	for ref := range r.manifests[name] {
+		if !strings.HasPrefix(ref, "sha256:") {
+			tags = append(tags, ref)
+		}
+	}
+	sort.Strings(tags)
+
+	return tags
+}
+
+// fault returns the fault applying to req, nil if none
+func (r *DockerRegistry) fault(req *http.Request) *RegistryFault {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	for i, f := range r.faults {
+		if f.Method != "" && f.Method != req.Method {
+			continue
+		}
+
+		if f.path != nil && !f.path.MatchString(req.URL.Path) {
+			continue
+		}
+
+		f.hits++
+		if f.Count > 0 && f.hits >= f.Count {
+			r.faults = append(r.faults[:i], r.faults[i+1:]...)
+		}
+
+		return f
+	}
+
+	return nil
+}
+
+// ServeHTTP implements http.Handler
+func (r *DockerRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if f := r.fault(req); f != nil {
+		select {
+		case <-time.After(f.Delay):
+		case <-req.Context().Done():
+			return
+		}
+
+		if f.Status != 0 {
+			registryError(w, f.Status, "UNKNOWN", "injected fault")
+			return
+		}
+	}
+
+	path := req.URL.Path
+
+	switch {
+	case path == "/v2/" || path == "/v2":
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		writeRegistryJSON(w, http.StatusOK, struct{}{})
+	case path == "/v2/_catalog":
+		r.serveCatalog(w, req)
+	case path == "/v1/_ping":
+		writeRegistryJSON(w, http.StatusOK, true)
+	case path == "/v1/search":
+		r.serveSearch(w, req)
+	case registryUploadPath.MatchString(path):
+		m := registryUploadPath.FindStringSubmatch(path)
+		r.serveUpload(w, req, m[1], m[2])
+	case registryBlobPath.MatchString(path):
+		m := registryBlobPath.FindStringSubmatch(path)
+		r.serveBlob(w, req, m[2])
+	case registryManifestPath.MatchString(path):
+		m := registryManifestPath.FindStringSubmatch(path)
+		r.serveManifest(w, req, m[1], m[2])
+	case registryTagsPath.MatchString(path):
+		m := registryTagsPath.FindStringSubmatch(path)
+		r.serveTags(w, m[1])
+	default:
+		registryError(w, http.StatusNotFound, "UNSUPPORTED", "unsupported path "+path)
+	}
+}
+
+func (r *DockerRegistry) serveCatalog(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	repos := r.repositories()
+	r.lock.Unlock()
+
+	writeRegistryJSON(w, http.StatusOK, map[string][]string{"repositories": repos})
+}
+
+func (r *DockerRegistry) serveTags(w http.ResponseWriter, name string) {
+	r.lock.Lock()
+	_, ok := r.manifests[name]
+	tags := r.tags(name)
+	r.lock.Unlock()
+
+	if !ok {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+
+	writeRegistryJSON(w, http.StatusOK, map[string]interface{}{"name": name, "tags": tags})
+}
+
+// registrySearchResult is a result of the v1 search
+type registrySearchResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	StarCount   int    `json:"star_count"`
+	IsOfficial  bool   `json:"is_official"`
+	IsAutomated bool   `json:"is_automated"`
+}
+
+func (r *DockerRegistry) serveSearch(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query().Get("q")
+
+	results := []registrySearchResult{}
+	for _, name := range r.Repositories() {
+		if strings.Contains(name, query) {
+			results = append(results, registrySearchResult{Name: name})
+		}
+	}
+
+	if n, err := strconv.Atoi(req.URL.Query().Get("n")); err == nil && n > 0 && n < len(results) {
+		results = results[:n]
+	}
+
+	writeRegistryJSON(w, http.StatusOK, map[string]interface{}{
+		"num_results": len(results),
+		"query":       query,
+		"results":     results,
+	})
+}
+
+func (r *DockerRegistry) serveBlob(w http.ResponseWriter, req *http.Request, digest string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method "+req.Method)
+		return
+	}
+
+	r.lock.Lock()
+	blob, ok := r.blobs[digest]
+	r.lock.Unlock()
+
+	if !ok {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	writeRegistryContent(w, req, digest, blob)
+}
+
+func (r *DockerRegistry) serveUpload(w http.ResponseWriter, req *http.Request, name, id string) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		registryError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+
+	query := req.URL.Query()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if id == "" {
+		if req.Method != http.MethodPost {
+			registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method "+req.Method)
+			return
+		}
+
+		// cross repository mount, the blobs are shared by all the repositories
+		if mount := query.Get("mount"); mount != "" {
+			if _, ok := r.blobs[mount]; ok {
+				r.blobCreated(w, name, mount)
+				return
+			}
+		}
+
+		// monolithic upload
+		if digest := query.Get("digest"); digest != "" {
+			r.storeBlob(w, name, digest, body)
+			return
+		}
+
+		r.uploadID++
+		id = strconv.Itoa(r.uploadID)
+		r.uploads[id] = bytes.NewBuffer(body)
+		r.uploadAccepted(w, name, id)
+		return
+	}
+
+	upload, ok := r.uploads[id]
+	if !ok {
+		registryError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.uploadAccepted(w, name, id)
+	case http.MethodPatch:
+		upload.Write(body)
+		r.uploadAccepted(w, name, id)
+	case http.MethodPut:
+		upload.Write(body)
+		delete(r.uploads, id)
+		r.storeBlob(w, name, query.Get("digest"), upload.Bytes())
+	case http.MethodDelete:
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method "+req.Method)
+	}
+}
+
+// uploadAccepted answers the state of the upload id, the lock is held
+func (r *DockerRegistry) uploadAccepted(w http.ResponseWriter, name, id string) {
+	size := r.uploads[id].Len()
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", size-1))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// storeBlob verifies and stores a blob, the lock is held
+func (r *DockerRegistry) storeBlob(w http.ResponseWriter, name, digest string, blob []byte) {
+	if digest != registryDigest(blob) {
+		registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+		return
+	}
+
+	r.blobs[digest] = blob
+	r.blobCreated(w, name, digest)
+}
+
+func (r *DockerRegistry) blobCreated(w http.ResponseWriter, name, digest string) {
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (r *DockerRegistry) serveManifest(w http.ResponseWriter, req *http.Request, name, ref string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		r.lock.Lock()
+		m, ok := r.manifests[name][ref]
+		r.lock.Unlock()
+
+		if !ok {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+
+		w.Header().Set("Content-Type", m.mediaType)
+		writeRegistryContent(w, req, registryDigest(m.content), m.content)
+	case http.MethodPut:
+		r.putManifest(w, req, name, ref)
+	case http.MethodDelete:
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		if _, ok := r.manifests[name][ref]; !ok {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+
+		delete(r.manifests[name], ref)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		registryError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method "+req.Method)
+	}
+}
+
+func (r *DockerRegistry) putManifest(w http.ResponseWriter, req *http.Request, name, ref string) {
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		registryError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		registryError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+
+	digest := registryDigest(content)
+	if strings.HasPrefix(ref, "sha256:") && ref != digest {
+		registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match the manifest")
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	refs := []string{manifest.Config.Digest}
+	for _, l := range manifest.Layers {
+		refs = append(refs, l.Digest)
+	}
+
+	for _, d := range refs {
+		if _, ok := r.blobs[d]; d != "" && !ok {
+			registryError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob unknown to registry: "+d)
+			return
+		}
+	}
+
+	if r.manifests[name] == nil {
+		r.manifests[name] = make(map[string]registryManifest)
+	}
+
+	m := registryManifest{
+		mediaType: req.Header.Get("Content-Type"),
+		content:   content,
+	}
+	r.manifests[name][ref] = m
+	r.manifests[name][digest] = m
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", name, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// registryDigest returns the digest of content
+func registryDigest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func writeRegistryContent(w http.ResponseWriter, req *http.Request, digest string, content []byte) {
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+
+	if req.Method != http.MethodHead {
+		w.Write(content)
+	}
+}
+
+func writeRegistryJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// registryError answers an error in the format of the Registry v2 API
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	writeRegistryJSON(w, status, map[string]interface{}{
+		"errors": []map[string]string{
+			{"code": code, "message": message},
+		},
+	})
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const registryManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+
+func startTestRegistry(t *testing.T) *DockerRegistry {
+	r, err := StartDockerRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// registryRequest sends a request to the registry r and returns the
+// response, whose body is read
+func registryRequest(t *testing.T, r *DockerRegistry, method, path, contentType string, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, "http://"+r.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, content
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: expected status %d, got %d", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode)
+	}
+}
+
+// pushTestImage uploads a layer in two chunks and a config, then the
+// manifest tagged tag of the repository name
+func pushTestImage(t *testing.T, r *DockerRegistry, name, tag string) []byte {
+	layer := []byte("layer content")
+	config := []byte(`{"architecture":"amd64"}`)
+
+	resp, _ := registryRequest(t, r, "POST", "/v2/"+name+"/blobs/uploads/", "", nil)
+	expectStatus(t, resp, http.StatusAccepted)
+
+	location := resp.Header.Get("Location")
+	resp, _ = registryRequest(t, r, "PATCH", location, "", layer[:5])
+	expectStatus(t, resp, http.StatusAccepted)
+
+	if rng := resp.Header.Get("Range"); rng != "0-4" {
+		t.Errorf("unexpected upload range %s", rng)
+	}
+
+	resp, _ = registryRequest(t, r, "PUT", location+"?digest="+registryDigest(layer), "", layer[5:])
+	expectStatus(t, resp, http.StatusCreated)
+
+	resp, _ = registryRequest(t, r, "POST", "/v2/"+name+"/blobs/uploads/?digest="+registryDigest(config), "", config)
+	expectStatus(t, resp, http.StatusCreated)
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     registryManifestType,
+		"config":        map[string]string{"digest": registryDigest(config)},
+		"layers":        []map[string]string{{"digest": registryDigest(layer)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ = registryRequest(t, r, "PUT", "/v2/"+name+"/manifests/"+tag, registryManifestType, manifest)
+	expectStatus(t, resp, http.StatusCreated)
+
+	return manifest
+}
+
+func TestDockerRegistryPushPull(t *testing.T) {
+	r := startTestRegistry(t)
+	defer r.Close()
+
+	resp, _ := registryRequest(t, r, "GET", "/v2/", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	manifest := pushTestImage(t, r, "foo/busybox", "1.0")
+
+	resp, content := registryRequest(t, r, "GET", "/v2/foo/busybox/manifests/1.0", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if !bytes.Equal(content, manifest) || resp.Header.Get("Content-Type") != registryManifestType {
+		t.Errorf("unexpected manifest %s of type %s", content, resp.Header.Get("Content-Type"))
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	resp, _ = registryRequest(t, r, "HEAD", "/v2/foo/busybox/manifests/"+digest, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	resp, content = registryRequest(t, r, "GET", "/v2/foo/busybox/blobs/"+registryDigest([]byte("layer content")), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if string(content) != "layer content" {
+		t.Errorf("unexpected layer %s", content)
+	}
+
+	resp, _ = registryRequest(t, r, "GET", "/v2/foo/busybox/manifests/2.0", "", nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	resp, _ = registryRequest(t, r, "POST", "/v2/foo/busybox/blobs/uploads/?digest="+registryDigest([]byte("foo")), "", []byte("bar"))
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp, _ = registryRequest(t, r, "PUT", "/v2/foo/busybox/manifests/3.0", registryManifestType,
+		[]byte(`{"layers":[{"digest":"`+registryDigest([]byte("unknown"))+`"}]}`))
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	if tags := r.Tags("foo/busybox"); !reflect.DeepEqual(tags, []string{"1.0"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestDockerRegistryCatalogSearch(t *testing.T) {
+	r := startTestRegistry(t)
+	defer r.Close()
+
+	pushTestImage(t, r, "busybox", "latest")
+	pushTestImage(t, r, "alpine", "latest")
+	pushTestImage(t, r, "foo/busybox", "latest")
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+
+	_, content := registryRequest(t, r, "GET", "/v2/_catalog", "", nil)
+	if err := json.Unmarshal(content, &catalog); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"alpine", "busybox", "foo/busybox"}; !reflect.DeepEqual(catalog.Repositories, expected) {
+		t.Errorf("expected repositories %v, got %v", expected, catalog.Repositories)
+	}
+
+	var search struct {
+		NumResults int `json:"num_results"`
+		Results    []struct {
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+
+	_, content = registryRequest(t, r, "GET", "/v1/search?q=busybox&n=25", "", nil)
+	if err := json.Unmarshal(content, &search); err != nil {
+		t.Fatal(err)
+	}
+
+	if search.NumResults != 2 || search.Results[0].Name != "busybox" || search.Results[1].Name != "foo/busybox" {
+		t.Errorf("unexpected search results %s", content)
+	}
+}
+
+func TestDockerRegistryFaults(t *testing.T) {
+	r := startTestRegistry(t)
+	defer r.Close()
+
+	pushTestImage(t, r, "busybox", "latest")
+
+	if err := r.InjectFault(RegistryFault{Method: "GET", Path: "/manifests/", Status: http.StatusServiceUnavailable, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	delay := 100 * time.Millisecond
+	if err := r.InjectFault(RegistryFault{Path: "^/v2/_catalog$", Delay: delay}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := registryRequest(t, r, "GET", "/v2/busybox/manifests/latest", "", nil)
+	expectStatus(t, resp, http.StatusServiceUnavailable)
+
+	resp, _ = registryRequest(t, r, "GET", "/v2/busybox/manifests/latest", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	start := time.Now()
+	resp, _ = registryRequest(t, r, "GET", "/v2/_catalog", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("the catalog should be delayed by %v, answered after %v", delay, elapsed)
+	}
+
+	r.ClearFaults()
+
+	start = time.Now()
+	registryRequest(t, r, "GET", "/v2/_catalog", "", nil)
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("the catalog should not be delayed once the faults are cleared, answered after %v", elapsed)
+	}
+
+	if err := r.InjectFault(RegistryFault{Path: "("}); err == nil {
+		t.Error("a fault with an invalid path should not be injected")
+	}
+
+	requests := r.Requests()
+	if last := requests[len(requests)-1]; last != "GET /v2/_catalog" {
+		t.Errorf("unexpected last request %s", last)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a lifecycle event of a container
+type Event struct {
+	// Type of the object, e.g. container, image or network for docker,
+	// the type of the event for the runtimes
+	Type string
+
+	// Action is what happened, e.g. create, start, die or destroy
+	Action string
+
+	// ID of the container
+	ID string
+
+	// Attributes of the event, e.g. the name and the exitCode of a
+	// docker container
+	Attributes map[string]string
+
+	// Data is the payload of the runtime events
+	Data json.RawMessage
+
+	// Time of the event, the time it was received if the source does
+	// not provide it
+	Time time.Time
+}
+
+// Is returns true if the event concerns the container whose ID or name is id
+func (e Event) Is(id string) bool {
+	return e.ID == id || e.Attributes["name"] == id
+}
+
+// EventMatcher returns true for the events a watcher waits for
+type EventMatcher func(e Event) bool
+
+// EventWatcher collects the events streamed by a command until it is
+// closed, the tests wait for them instead of polling the state
+type EventWatcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	result Result
+
+	lock    sync.Mutex
+	events  []Event
+	next    int
+	updated chan struct{}
+}
+
+// dockerEvent is an event printed by 'docker events --format {{json .}}'
+type dockerEvent struct {
+	Type   string
+	Action string
+	Actor  struct {
+		ID         string
+		Attributes map[string]string
+	}
+	TimeNano int64 `json:"timeNano"`
+}
+
+// runtimeEvent is an event printed by the runtime events command
+type runtimeEvent struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// WatchDockerEvents watches the docker events that happened since the
+// given time, or from now if since is zero, filtered by the docker
+// filters, e.g. "container=foo" or "event=die"
+func WatchDockerEvents(ctx context.Context, since time.Time, filters ...string) *EventWatcher {
+	args := []string{"events", "--format", "{{json .}}"}
+
+	if !since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+
+	for _, f := range filters {
+		args = append(args, "--filter", f)
+	}
+
+	return watchEvents(ctx, NewCommand(Docker, args...), parseDockerEvent)
+}
+
+// WatchEvents watches the events reported by the runtime for the
+// container every interval
+func (c *Container) WatchEvents(ctx context.Context, interval time.Duration) (*EventWatcher, error) {
+	if c.ID == nil {
+		return nil, fmt.Errorf("container has no ID")
+	}
+
+	cmd := c.runtimeCommand("events", fmt.Sprintf("--interval=%s", interval), *c.ID)
+
+	return watchEvents(ctx, cmd, parseRuntimeEvent), nil
+}
+
+// watchEvents runs cmd until the watcher is closed or ctx is done,
+// each line of its output is an event parsed by parse
+func watchEvents(ctx context.Context, cmd *Command, parse func(line string) (Event, error)) *EventWatcher {
+	ctx, cancel := context.WithCancel(ctx)
+
+	w := &EventWatcher{
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		updated: make(chan struct{}),
+	}
+
+	// the events are streamed until the command is killed
+	cmd.Timeout = 0
+	cmd.OnStdoutLine = func(line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+
+		e, err := parse(line)
+		if err != nil {
+			LogIfFail("ignoring event '%s': %v\n", line, err)
+			return
+		}
+
+		w.add(e)
+	}
+
+	go func() {
+		w.result = cmd.RunContext(ctx)
+		close(w.done)
+	}()
+
+	return w
+}
+
+func parseDockerEvent(line string) (Event, error) {
+	var d dockerEvent
+	if err := json.Unmarshal([]byte(line), &d); err != nil {
+		return Event{}, err
+	}
+
+	e := Event{
+		Type:       d.Type,
+		Action:     d.Action,
+		ID:         d.Actor.ID,
+		Attributes: d.Actor.Attributes,
+		Time:       time.Unix(0, d.TimeNano),
+	}
+
+	if d.TimeNano == 0 {
+		e.Time = time.Now()
+	}
+
+	return e, nil
+}
+
+func parseRuntimeEvent(line string) (Event, error) {
+	var r runtimeEvent
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Type:   r.Type,
+		Action: r.Type,
+		ID:     r.ID,
+		Data:   r.Data,
+		Time:   time.Now(),
+	}, nil
+}
+
+func (w *EventWatcher) add(e Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.events = append(w.events, e)
+
+	// wake up the waiters
+	close(w.updated)
+	w.updated = make(chan struct{})
+}
+
+// Events returns all the events received so far
+func (w *EventWatcher) Events() []Event {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]Event{}, w.events...)
+}
+
+// Sequence returns the actions received so far for the container id,
+// only the given actions are returned if any
+func (w *EventWatcher) Sequence(id string, actions ...string) []string {
+	var sequence []string
+
+	for _, e := range w.Events() {
+		if !e.Is(id) {
+			continue
+		}
+
+		if len(actions) == 0 || hasString(actions, e.Action) {
+			sequence = append(sequence, e.Action)
+		}
+	}
+
+	return sequence
+}
+
+// Wait returns the first event matched by match that was not returned
+// by a previous Wait, the events before it are skipped. It fails when
+// ctx is done or when the watcher stops.
+func (w *EventWatcher) Wait(ctx context.Context, match EventMatcher) (Event, error) {
+	for {
+		w.lock.Lock()
+		for i := w.next; i < len(w.events); i++ {
+			if match(w.events[i]) {
+				w.next = i + 1
+				e := w.events[i]
+				w.lock.Unlock()
+				return e, nil
+			}
+		}
+		w.next = len(w.events)
+		updated := w.updated
+		w.lock.Unlock()
+
+		select {
+		case <-updated:
+		case <-w.done:
+			// the last events may have been added before done
+			w.lock.Lock()
+			pending := w.next < len(w.events)
+			w.lock.Unlock()
+
+			if !pending {
+				return Event{}, fmt.Errorf("events watcher stopped: %s %v", w.result.Stderr, w.result.Err)
+			}
+		case <-ctx.Done():
+			return Event{}, fmt.Errorf("waiting for event: %v", ctx.Err())
+		}
+	}
+}
+
+// WaitForSequence waits for the actions of the container id in this
+// order, the other events are skipped
+func (w *EventWatcher) WaitForSequence(ctx context.Context, id string, actions ...string) error {
+	for _, action := range actions {
+		_, err := w.Wait(ctx, func(e Event) bool {
+			return e.Is(id) && e.Action == action
+		})
+		if err != nil {
+			return fmt.Errorf("%s of %s not received: %v", action, id, err)
+		}
+	}
+
+	return nil
+}
+
+// Close stops the watcher
+func (w *EventWatcher) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func hasString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDockerEvents returns a watcher of a command printing the actions
+// of the container foo, then waiting for the watcher to be closed
+func fakeDockerEvents(wait bool, actions ...string) *EventWatcher {
+	var script []string
+	for _, a := range actions {
+		script = append(script, fmt.Sprintf(`echo '{"Type":"container","Action":"%s","Actor":{"ID":"1234","Attributes":{"name":"foo"}}}'`, a))
+	}
+
+	// the unknown lines are ignored
+	script = append(script, "echo 'not an event'")
+
+	if wait {
+		script = append(script, "sleep 60")
+	}
+
+	return watchEvents(context.Background(), NewCommand("sh", "-c", strings.Join(script, "; ")), parseDockerEvent)
+}
+
+func TestEventWatcherSequence(t *testing.T) {
+	w := fakeDockerEvents(true, "create", "attach", "start", "die", "destroy")
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := w.WaitForSequence(ctx, "foo", "create", "start", "die", "destroy"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"create", "start", "die", "destroy"}
+	if sequence := w.Sequence("foo", expected...); !reflect.DeepEqual(sequence, expected) {
+		t.Errorf("expected sequence %v, got %v", expected, sequence)
+	}
+
+	if sequence := w.Sequence("1234"); len(sequence) != 5 {
+		t.Errorf("the events should match the container ID, got %v", sequence)
+	}
+
+	if len(w.Sequence("bar")) != 0 {
+		t.Error("unexpected events for the container bar")
+	}
+
+	// the events already returned are not waited for again
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := w.Wait(ctx, func(e Event) bool { return e.Action == "create" }); err == nil {
+		t.Error("the create event should only be returned once")
+	}
+}
+
+func TestEventWatcherStopped(t *testing.T) {
+	w := fakeDockerEvents(false, "create")
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the events received before the command exits are still returned
+	if err := w.WaitForSequence(ctx, "foo", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.WaitForSequence(ctx, "foo", "start"); err == nil {
+		t.Error("expected an error once the watcher is stopped")
+	}
+
+	if ctx.Err() != nil {
+		t.Error("a stopped watcher should not wait for the deadline")
+	}
+}
+
+func TestParseRuntimeEvent(t *testing.T) {
+	e, err := parseRuntimeEvent(`{"type":"stats","id":"foo","data":{"cpu":{}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Action != "stats" || !e.Is("foo") || string(e.Data) != `{"cpu":{}}` {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if _, err := parseRuntimeEvent("stats"); err == nil {
+		t.Error("expected an error parsing an invalid event")
+	}
+}
@@ -23,14 +23,14 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// the entries only hold the arguments, the commands are created when
+// the specs run, once the runtime under test is known
 func withoutID(command string) TableEntry {
-	cmd := NewCommand(Runtime, command)
-	return Entry(fmt.Sprintf("command '%s'", command), cmd)
+	return Entry(fmt.Sprintf("command '%s'", command), []string{command})
 }
 
 func withInexistentID(command string) TableEntry {
-	cmd := NewCommand(Runtime, command, RandID(30))
-	return Entry(fmt.Sprintf("command '%s'", command), cmd)
+	return Entry(fmt.Sprintf("command '%s'", command), []string{command, RandID(30)})
 }
 
 var _ = Describe("commands", func() {
@@ -38,8 +38,8 @@ var _ = Describe("commands", func() {
 	var stderr string
 
 	DescribeTable("without a container ID should fail",
-		func(cmd *Command) {
-			_, stderr, exitCode = cmd.Run()
+		func(args []string) {
+			_, stderr, exitCode = NewCommand(Runtime, args...).Run()
 
 			Expect(exitCode).ToNot(Equal(0))
 			Expect(stderr).NotTo(BeEmpty())
@@ -51,8 +51,8 @@ var _ = Describe("commands", func() {
 	)
 
 	DescribeTable("with a inexistent container ID should fail",
-		func(cmd *Command) {
-			_, stderr, exitCode = cmd.Run()
+		func(args []string) {
+			_, stderr, exitCode = NewCommand(Runtime, args...).Run()
 
 			Expect(exitCode).ToNot(Equal(0))
 			Expect(stderr).NotTo(BeEmpty())
@@ -13,3 +13,76 @@
 // limitations under the License.
 
 package functional
+
+import (
+	"os"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("create", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(container.Teardown()).To(Succeed())
+	})
+
+	Context("container", func() {
+		It("should be created", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			state, err := container.State()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Status).To(Equal(StatusCreated))
+		})
+
+		It("should write the pid file", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, err := os.Stat(*container.PidFile)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should fail if it already exists", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, stderr, exitCode := container.Create()
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+
+	DescribeTable("container",
+		func(option string, fail bool) {
+			Expect(container.RemoveOption(option)).To(Succeed())
+
+			_, stderr, exitCode := container.Create()
+
+			if fail {
+				Expect(exitCode).ToNot(Equal(0))
+				Expect(stderr).NotTo(BeEmpty())
+			} else {
+				Expect(exitCode).To(Equal(0))
+			}
+		},
+		withoutOption("--bundle", shouldFail),
+		withoutOption("-b", shouldFail),
+		withoutOption("--pid-file", shouldNotFail),
+		withoutOption("--console", shouldNotFail),
+	)
+})
@@ -13,3 +13,71 @@
 // limitations under the License.
 
 package functional
+
+import (
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("delete", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(container.Teardown()).To(Succeed())
+	})
+
+	Context("created container", func() {
+		It("should be deleted", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Delete(false)
+			Expect(exitCode).To(Equal(0))
+			Expect(container.Exist()).To(BeFalse())
+		})
+	})
+
+	Context("running container", func() {
+		BeforeEach(func() {
+			_, _, exitCode := container.Run()
+			Expect(exitCode).To(Equal(0))
+		})
+
+		It("should not be deleted without force", func() {
+			_, stderr, exitCode := container.Delete(false)
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+			Expect(container.Exist()).To(BeTrue())
+		})
+
+		It("should be deleted with force", func() {
+			_, _, exitCode := container.Delete(true)
+			Expect(exitCode).To(Equal(0))
+			Expect(container.Exist()).To(BeFalse())
+		})
+	})
+
+	Context("deleted container", func() {
+		It("should fail to be deleted again", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Delete(false)
+			Expect(exitCode).To(Equal(0))
+
+			_, stderr, exitCode := container.Delete(false)
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package functional
+
+import (
+	"context"
+	"time"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("events", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		SkipUnless(CapEvents)
+
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		if container != nil {
+			Expect(container.Teardown()).To(Succeed())
+		}
+	})
+
+	Context("running container", func() {
+		It("should report its stats", func() {
+			_, _, exitCode := container.Run()
+			Expect(exitCode).To(Equal(0))
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(Timeout)*time.Second)
+			defer cancel()
+
+			watcher, err := container.WatchEvents(ctx, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			defer watcher.Close()
+
+			event, err := watcher.Wait(ctx, func(e Event) bool {
+				return e.Action == "stats"
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event.Is(*container.ID)).To(BeTrue())
+		})
+	})
+})
@@ -16,12 +16,17 @@ package functional
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/clearcontainers/tests"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	spec "github.com/opencontainers/specs/specs-go"
 )
 
 var sleepingContainerWorkload = []string{"sh", "-c", "sleep 1000"}
@@ -55,6 +60,12 @@ func execDetachOutput(detach bool) TableEntry {
 	return Entry(fmt.Sprintf("check output as detach=%t", detach), process, expectedOutput)
 }
 
+// execSpec returns an entry executing args with the process spec
+// modified by update, its stdout must contain expectedOutput
+func execSpec(description string, update func(*spec.Process), expectedOutput string, args ...string) TableEntry {
+	return Entry(description, update, args, expectedOutput)
+}
+
 var _ = Describe("exec", func() {
 	var (
 		container *Container
@@ -107,4 +118,63 @@ var _ = Describe("exec", func() {
 		execDetachOutput(false),
 		execDetachOutput(true),
 	)
+
+	DescribeTable("container with a process spec",
+		func(update func(*spec.Process), args []string, expectedOutput string) {
+			SkipUnless(CapExecProcess)
+
+			process := Process{
+				ContainerID: container.ID,
+				Spec:        container.ProcessSpec(args...),
+			}
+			update(process.Spec)
+
+			stdout, _, exitCode := container.Exec(process)
+			Expect(exitCode).To(Equal(0))
+			Expect(stdout).To(ContainSubstring(expectedOutput))
+		},
+		execSpec("check env", func(p *spec.Process) {
+			p.Env = append(p.Env, "FOO=bar")
+		}, "FOO=bar", "env"),
+		execSpec("check cwd", func(p *spec.Process) {
+			p.Cwd = "/tmp"
+		}, "/tmp", "pwd"),
+		execSpec("check uid", func(p *spec.Process) {
+			p.User.UID = 1000
+		}, "1000", "id", "-u"),
+		execSpec("check gid", func(p *spec.Process) {
+			p.User.GID = 1000
+		}, "1000", "id", "-g"),
+		execSpec("check additional groups", func(p *spec.Process) {
+			p.User.AdditionalGids = []uint32{2000, 3000}
+		}, "2000 3000", "sh", "-c", "id -G | cut -d' ' -f2-"),
+		execSpec("check noNewPrivileges", func(p *spec.Process) {
+			p.NoNewPrivileges = true
+		}, "NoNewPrivs:\t1", "grep", "NoNewPrivs", "/proc/self/status"),
+		execSpec("check capabilities", func(p *spec.Process) {
+			p.Capabilities = &spec.LinuxCapabilities{}
+		}, "CapEff:\t0000000000000000", "grep", "CapEff", "/proc/self/status"),
+	)
+
+	Context("process with a pid file", func() {
+		It("should write the pid file", func() {
+			pidFile := filepath.Join(container.Bundle.Path, "exec-pid")
+			process := Process{
+				ContainerID: container.ID,
+				Workload:    []string{"sleep", "10"},
+				Detach:      true,
+				PidFile:     &pidFile,
+			}
+
+			_, _, exitCode := container.Exec(process)
+			Expect(exitCode).To(Equal(0))
+
+			content, err := ioutil.ReadFile(pidFile)
+			Expect(err).NotTo(HaveOccurred())
+
+			pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pid).To(BeNumerically(">", 0))
+		})
+	})
 })
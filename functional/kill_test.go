@@ -13,3 +13,67 @@
 // limitations under the License.
 
 package functional
+
+import (
+	"fmt"
+	"syscall"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+func withSignal(signal interface{}, all bool) TableEntry {
+	return Entry(fmt.Sprintf("with signal '%v' and all=%t", signal, all), signal, all)
+}
+
+var _ = Describe("kill", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+
+		_, _, exitCode := container.Run()
+		Expect(exitCode).To(Equal(0))
+	})
+
+	AfterEach(func() {
+		Expect(container.Teardown()).To(Succeed())
+	})
+
+	DescribeTable("running container",
+		func(signal interface{}, all bool) {
+			_, stderr, exitCode := container.Kill(all, signal)
+			Expect(exitCode).To(Equal(0))
+			Expect(stderr).To(BeEmpty())
+		},
+		withSignal(syscall.SIGKILL, false),
+		withSignal(syscall.SIGTERM, false),
+		withSignal("KILL", false),
+		withSignal("SIGTERM", false),
+		withSignal(syscall.SIGKILL, true),
+	)
+
+	Context("running container", func() {
+		It("should fail with an invalid signal", func() {
+			_, stderr, exitCode := container.Kill(false, "SIGFOO")
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+
+		It("should fail after it is deleted", func() {
+			_, _, exitCode := container.Delete(true)
+			Expect(exitCode).To(Equal(0))
+
+			_, stderr, exitCode := container.Kill(false, syscall.SIGKILL)
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+})
@@ -15,6 +15,7 @@
 package functional
 
 import (
+	. "github.com/clearcontainers/tests"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -26,7 +27,43 @@ const (
 	shouldNotFail = false
 )
 
+var hostSnapshot *HostSnapshot
+
+var _ = BeforeEach(func() {
+	StartSpecArtifacts()
+
+	hostSnapshot = nil
+
+	if !CheckHostLeaks {
+		return
+	}
+
+	var err error
+	hostSnapshot, err = TakeHostSnapshot()
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterEach(func() {
+	Expect(Resources().Cleanup()).To(Succeed())
+})
+
+var _ = AfterEach(func() {
+	if hostSnapshot == nil {
+		return
+	}
+
+	Expect(hostSnapshot.CheckLeaks()).To(Succeed())
+})
+
+var _ = AfterSuite(func() {
+	Expect(CleanupRootfsCache()).To(Succeed())
+})
+
 func TestFunctional(t *testing.T) {
-	RegisterFailHandler(Fail)
-	RunSpecs(t, "Functional Suite")
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterFailHandler(ArtifactsFailHandler(Fail))
+	RunSpecsWithDefaultAndCustomReporters(t, "Functional Suite", SuiteReporters("functional"))
 }
@@ -24,14 +24,13 @@ import (
 )
 
 func withOption(option string, fail bool) TableEntry {
-	command := NewCommand(Runtime, option)
-	return Entry(fmt.Sprintf("with option '%s'", option), command, fail)
+	return Entry(fmt.Sprintf("with option '%s'", option), option, fail)
 }
 
 var _ = Describe("global options", func() {
 	DescribeTable("option",
-		func(command *Command, fail bool) {
-			stdout, stderr, exitCode := command.Run()
+		func(option string, fail bool) {
+			stdout, stderr, exitCode := NewCommand(Runtime, option).Run()
 
 			if fail {
 				Expect(exitCode).NotTo(Equal(0))
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package functional
+
+import (
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pause", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		SkipUnless(CapPause)
+
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		if container != nil {
+			Expect(container.Teardown()).To(Succeed())
+		}
+	})
+
+	Context("running container", func() {
+		It("should pause and resume", func() {
+			_, _, exitCode := container.Run()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Pause()
+			Expect(exitCode).To(Equal(0))
+
+			state, err := container.State()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Status).To(Equal(StatusPaused))
+
+			_, _, exitCode = container.Resume()
+			Expect(exitCode).To(Equal(0))
+
+			state, err = container.State()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Status).To(Equal(StatusRunning))
+		})
+	})
+
+	Context("created container", func() {
+		It("should fail to pause", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, stderr, exitCode := container.Pause()
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+})
@@ -13,3 +13,62 @@
 // limitations under the License.
 
 package functional
+
+import (
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("start", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(container.Teardown()).To(Succeed())
+	})
+
+	Context("created container", func() {
+		It("should start", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Start()
+			Expect(exitCode).To(Equal(0))
+
+			state, err := container.State()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Status).To(Equal(StatusRunning))
+		})
+	})
+
+	Context("running container", func() {
+		It("should fail to start again", func() {
+			_, _, exitCode := container.Create()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Start()
+			Expect(exitCode).To(Equal(0))
+
+			_, stderr, exitCode := container.Start()
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+
+	Context("container not created", func() {
+		It("should fail to start", func() {
+			_, stderr, exitCode := container.Start()
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(stderr).NotTo(BeEmpty())
+		})
+	})
+})
@@ -13,3 +13,58 @@
 // limitations under the License.
 
 package functional
+
+import (
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("state", func() {
+	var (
+		container *Container
+		err       error
+	)
+
+	BeforeEach(func() {
+		container, err = NewContainer(sleepingContainerWorkload, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(container.Teardown()).To(Succeed())
+	})
+
+	Context("running container", func() {
+		It("should show its ID, bundle and status", func() {
+			_, _, exitCode := container.Run()
+			Expect(exitCode).To(Equal(0))
+
+			state, err := container.State()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.ID).To(Equal(*container.ID))
+			Expect(state.Bundle).To(Equal(container.Bundle.Path))
+			Expect(state.Status).To(Equal(StatusRunning))
+			Expect(state.Pid).To(BeNumerically(">", 0))
+		})
+	})
+
+	Context("deleted container", func() {
+		It("should fail", func() {
+			_, _, exitCode := container.Run()
+			Expect(exitCode).To(Equal(0))
+
+			_, _, exitCode = container.Delete(true)
+			Expect(exitCode).To(Equal(0))
+
+			_, err := container.State()
+			Expect(err).To(HaveOccurred())
+
+			runtimeErr, ok := err.(*RuntimeError)
+			Expect(ok).To(BeTrue())
+			Expect(runtimeErr.ExitCode).NotTo(Equal(0))
+			Expect(runtimeErr.Stderr).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package functional
+
+import (
+	"time"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const sessionTimeout = 30 * time.Second
+
+var _ = Describe("terminal", func() {
+	var (
+		container *Container
+		session   *Session
+		err       error
+	)
+
+	BeforeEach(func() {
+		SkipUnless(CapConsolePath)
+
+		container, err = NewContainer([]string{"sh"}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(container).NotTo(BeNil())
+
+		session, err = container.RunSession()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if session != nil {
+			Expect(session.Close()).To(Succeed())
+		}
+
+		if container != nil {
+			Expect(container.Teardown()).To(Succeed())
+		}
+	})
+
+	Context("interactive container", func() {
+		It("should run commands", func() {
+			Expect(session.SendLine("echo result=$((6*7))")).To(Succeed())
+			_, err = session.ExpectRegexp("result=42", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should be resized", func() {
+			Expect(session.Resize(40, 100)).To(Succeed())
+
+			Expect(session.SendLine("echo size=$(stty size)")).To(Succeed())
+			_, err = session.ExpectRegexp("size=40 100", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should interrupt the foreground process with Ctrl-C", func() {
+			Expect(session.SendLine("echo sleeping=$((2+2)); sleep 1000")).To(Succeed())
+			_, err = session.ExpectRegexp("sleeping=4", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(session.Send(CtrlC)).To(Succeed())
+
+			Expect(session.SendLine("echo interrupted=$((1+1))")).To(Succeed())
+			_, err = session.ExpectRegexp("interrupted=2", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should exit with the shell exit code", func() {
+			Expect(session.SendLine("exit 3")).To(Succeed())
+
+			exitCode, err := session.Wait(sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(3))
+		})
+
+		It("should execute an interactive process", func() {
+			session.SendLine("echo started=$((1+1))")
+			_, err = session.ExpectRegexp("started=2", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+
+			execSession, err := container.ExecSession(Process{
+				ContainerID: container.ID,
+				Workload:    []string{"sh"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer execSession.Close()
+
+			Expect(execSession.SendLine("echo exec=$((2*3))")).To(Succeed())
+			_, err = execSession.ExpectRegexp("exec=6", sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(execSession.SendLine("exit")).To(Succeed())
+			exitCode, err := execSession.Wait(sessionTimeout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exitCode).To(Equal(0))
+		})
+	})
+})
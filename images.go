@@ -0,0 +1,288 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ImageManifestFile is the TOML manifest of the images needed by the
+// tests, the configured images without digest are used if empty
+var ImageManifestFile string
+
+// ImageCacheDir is the directory where the tarballs of the images,
+// created by docker save, are loaded from
+var ImageCacheDir string
+
+// AllowImagePull allows to pull the images missing from the cache
+var AllowImagePull bool
+
+var imageDigestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// imageRoles are the images used by the tests, by their key in the
+// images section of the configuration
+var imageRoles = map[string]*string{
+	"busybox":  &Image,
+	"alpine":   &AlpineImage,
+	"postgres": &PostgresImage,
+	"debian":   &DebianImage,
+	"fedora":   &FedoraImage,
+}
+
+// ImageManifest lists the images needed by the tests
+type ImageManifest struct {
+	Images []ManifestImage `toml:"image"`
+}
+
+// ManifestImage is an image of the manifest
+type ManifestImage struct {
+	// Name of the image, e.g. busybox:latest
+	Name string `toml:"name"`
+
+	// Digest is the image ID or one of its repository digests, the
+	// image ID is kept by docker save and docker load, not verified
+	// if empty. The image is pulled by digest, only a repository
+	// digest can be pulled.
+	Digest string `toml:"digest"`
+
+	// Tarball of the image, relative to the cache directory,
+	// <name>.tar with '/' and ':' replaced by '_' if empty
+	Tarball string `toml:"tarball"`
+
+	// Role is the image of the tests replaced by this one, busybox,
+	// alpine, postgres, debian or fedora. It is the last component of
+	// the repository if empty, e.g. busybox for docker.io/busybox:1.28,
+	// the image replaces none if it is not a known role.
+	Role string `toml:"role"`
+}
+
+// LoadImageManifest reads the image manifest path
+func LoadImageManifest(path string) (*ImageManifest, error) {
+	m := &ImageManifest{}
+
+	if _, err := toml.DecodeFile(path, m); err != nil {
+		return nil, fmt.Errorf("could not load image manifest %s: %v", path, err)
+	}
+
+	for _, i := range m.Images {
+		if i.Name == "" {
+			return nil, fmt.Errorf("image manifest %s: image without name", path)
+		}
+
+		if i.Digest != "" && !imageDigestRegexp.MatchString(i.Digest) {
+			return nil, fmt.Errorf("image manifest %s: invalid digest of %s: %s", path, i.Name, i.Digest)
+		}
+
+		if _, ok := imageRoles[i.Role]; i.Role != "" && !ok {
+			return nil, fmt.Errorf("image manifest %s: unknown role of %s: %s", path, i.Name, i.Role)
+		}
+	}
+
+	return m, nil
+}
+
+// DefaultImageManifest returns the manifest of the configured images
+func DefaultImageManifest() *ImageManifest {
+	m := &ImageManifest{}
+
+	for _, role := range []string{"busybox", "alpine", "postgres", "debian", "fedora"} {
+		m.Images = append(m.Images, ManifestImage{Name: *imageRoles[role], Role: role})
+	}
+
+	return m
+}
+
+// CurrentImageManifest returns the manifest given by ImageManifestFile,
+// the default one if it is empty
+func CurrentImageManifest() (*ImageManifest, error) {
+	if ImageManifestFile == "" {
+		return DefaultImageManifest(), nil
+	}
+
+	return LoadImageManifest(ImageManifestFile)
+}
+
+// role returns the role of the image, empty if it has none
+func (i ManifestImage) role() string {
+	if i.Role != "" {
+		return i.Role
+	}
+
+	if role := path.Base(imageRepository(i.Name)); imageRoles[role] != nil {
+		return role
+	}
+
+	return ""
+}
+
+// imageRepository returns the image name without its tag or digest
+func imageRepository(name string) string {
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// tarballPath returns the path of the image tarball in the cache
+// directory dir
+func (i ManifestImage) tarballPath(dir string) string {
+	tarball := i.Tarball
+	if tarball == "" {
+		tarball = strings.NewReplacer("/", "_", ":", "_").Replace(i.Name) + ".tar"
+	}
+
+	if filepath.IsAbs(tarball) {
+		return tarball
+	}
+
+	return filepath.Join(dir, tarball)
+}
+
+// ProvisionImages makes the images of the manifest available to docker:
+// the images already present are kept, the missing ones are loaded from
+// ImageCacheDir, then pulled if AllowImagePull is set. The digest of
+// each image is verified. The images replace the images of the tests
+// with the same role, Image for busybox, AlpineImage for alpine...
+func ProvisionImages(m *ImageManifest) error {
+	for _, i := range m.Images {
+		if err := provisionImage(i); err != nil {
+			return err
+		}
+
+		if role := i.role(); role != "" {
+			*imageRoles[role] = i.Name
+		}
+	}
+
+	return nil
+}
+
+func provisionImage(i ManifestImage) error {
+	// an image present with another digest is replaced
+	present, verifyErr := verifyImage(i)
+	if present && verifyErr == nil {
+		return nil
+	}
+
+	if ImageCacheDir != "" {
+		tarball := i.tarballPath(ImageCacheDir)
+
+		if _, err := os.Stat(tarball); err == nil {
+			if _, stderr, exitCode := DockerLoad("-i", tarball); exitCode != 0 {
+				return fmt.Errorf("failed to load image %s from %s: %s", i.Name, tarball, stderr)
+			}
+
+			return checkImage(i, "loaded from "+tarball)
+		}
+	}
+
+	if !AllowImagePull {
+		if verifyErr != nil {
+			return verifyErr
+		}
+
+		return fmt.Errorf("image %s is missing: not found in the cache directory '%s' and pulling is disabled",
+			i.Name, ImageCacheDir)
+	}
+
+	ref := i.Name
+	if i.Digest != "" {
+		ref = imageRepository(i.Name) + "@" + i.Digest
+	}
+
+	if _, stderr, exitCode := DockerPull(ref); exitCode != 0 {
+		return fmt.Errorf("failed to pull image %s: %s", ref, stderr)
+	}
+
+	// an image pulled by digest has no tag, unlike DockerTag the tag
+	// is not registered as a resource of the spec, the image is kept
+	if ref != i.Name {
+		if _, stderr, exitCode := runDockerCommand("tag", ref, i.Name); exitCode != 0 {
+			return fmt.Errorf("failed to tag image %s as %s: %s", ref, i.Name, stderr)
+		}
+	}
+
+	return checkImage(i, "pulled")
+}
+
+// checkImage verifies the image i once loaded or pulled
+func checkImage(i ManifestImage, how string) error {
+	present, err := verifyImage(i)
+	if err != nil {
+		return err
+	}
+
+	if !present {
+		return fmt.Errorf("image %s is missing once %s", i.Name, how)
+	}
+
+	return nil
+}
+
+// verifyImage returns whether the image i is present, and an error
+// if its digest differs from the manifest one
+func verifyImage(i ManifestImage) (bool, error) {
+	stdout, _, exitCode := DockerImageInspect("--format", "{{.Id}} {{join .RepoDigests \" \"}}", i.Name)
+	if exitCode != 0 {
+		return false, nil
+	}
+
+	fields := strings.Fields(stdout)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	if i.Digest == "" {
+		return true, nil
+	}
+
+	if fields[0] == i.Digest {
+		return true, nil
+	}
+
+	for _, d := range fields[1:] {
+		if strings.HasSuffix(d, "@"+i.Digest) {
+			return true, nil
+		}
+	}
+
+	return true, fmt.Errorf("image %s has ID %s, expected digest %s", i.Name, fields[0], i.Digest)
+}
+
+// DockerLoad loads an image from a tarball
+func DockerLoad(args ...string) (string, string, int) {
+	// loading an image can take as long as pulling it
+	return runDockerCommandWithTimeout(time.Duration(PullTimeout), "load", args...)
+}
+
+// DockerImageInspect displays detailed information on one or more images
+func DockerImageInspect(args ...string) (string, string, int) {
+	a := append([]string{"inspect"}, args...)
+
+	return runDockerCommand("image", a...)
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testImageID     = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	testImageDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func inspectImageInteraction(name, stdout string) CassetteInteraction {
+	i := CassetteInteraction{
+		Args:   []string{Docker, "image", "inspect", "--format", "{{.Id}} {{join .RepoDigests \" \"}}", name},
+		Stdout: stdout,
+	}
+
+	if stdout == "" {
+		i.ExitCode = 1
+		i.Stderr = "Error: No such image: " + name
+	}
+
+	return i
+}
+
+func useImageCassette(t *testing.T, interactions ...CassetteInteraction) (*Cassette, func()) {
+	c, err := NewCassette("", CassetteReplay, Docker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range interactions {
+		if err := c.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	UseCassette(c)
+
+	cacheDir, pull := ImageCacheDir, AllowImagePull
+	images := []string{Image, AlpineImage, PostgresImage, DebianImage, FedoraImage}
+
+	return c, func() {
+		UseCassette(nil)
+		ImageCacheDir, AllowImagePull = cacheDir, pull
+		Image, AlpineImage, PostgresImage, DebianImage, FedoraImage = images[0], images[1], images[2], images[3], images[4]
+	}
+}
+
+func TestLoadImageManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.toml")
+
+	content := `[[image]]
+name = "busybox:1.28"
+digest = "` + testImageID + `"
+tarball = "busybox.tar"
+
+[[image]]
+name = "quay.io/foo/alpine:3.7"
+
+[[image]]
+name = "localhost:5000/tiny"
+role = "busybox"
+
+[[image]]
+name = "mysql@` + testImageDigest + `"
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadImageManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Images) != 4 || m.Images[0].Digest != testImageID {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	if p := m.Images[0].tarballPath("/cache"); p != "/cache/busybox.tar" {
+		t.Errorf("unexpected tarball %s", p)
+	}
+
+	if p := m.Images[1].tarballPath("/cache"); p != "/cache/quay.io_foo_alpine_3.7.tar" {
+		t.Errorf("unexpected default tarball %s", p)
+	}
+
+	for n, role := range []string{"busybox", "alpine", "busybox", ""} {
+		if r := m.Images[n].role(); r != role {
+			t.Errorf("expected role '%s' for %s, got '%s'", role, m.Images[n].Name, r)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[[image]]\nname = \"busybox\"\nrole = \"ubuntu\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadImageManifest(path); err == nil {
+		t.Error("a manifest with an unknown role should not be loaded")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[[image]]\nname = \"busybox\"\ndigest = \"latest\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadImageManifest(path); err == nil {
+		t.Error("a manifest with an invalid digest should not be loaded")
+	}
+}
+
+func TestProvisionImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarball := filepath.Join(dir, "alpine.tar")
+	if err := ioutil.WriteFile(tarball, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, restore := useImageCassette(t,
+		// present, verified by its repository digest
+		inspectImageInteraction("busybox", testImageID+" busybox@"+testImageDigest+"\n"),
+		// loaded from the cache
+		inspectImageInteraction("alpine", ""),
+		CassetteInteraction{Args: []string{Docker, "load", "-i", tarball}},
+		inspectImageInteraction("alpine", testImageID+"\n"),
+		// pulled
+		inspectImageInteraction("debian", ""),
+		CassetteInteraction{Args: []string{Docker, "pull", "debian"}},
+		inspectImageInteraction("debian", testImageID+"\n"),
+		// pulled by digest and tagged
+		inspectImageInteraction("fedora:27", ""),
+		CassetteInteraction{Args: []string{Docker, "pull", "fedora@" + testImageDigest}},
+		CassetteInteraction{Args: []string{Docker, "tag", "fedora@" + testImageDigest, "fedora:27"}},
+		inspectImageInteraction("fedora:27", testImageID+" fedora@"+testImageDigest+"\n"),
+	)
+	defer restore()
+
+	ImageCacheDir = dir
+	AllowImagePull = true
+
+	m := &ImageManifest{
+		Images: []ManifestImage{
+			{Name: "busybox", Digest: testImageDigest},
+			{Name: "alpine", Digest: testImageID},
+			{Name: "debian"},
+			{Name: "fedora:27", Digest: testImageDigest},
+		},
+	}
+
+	if err := ProvisionImages(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if Image != "busybox" || DebianImage != "debian" || FedoraImage != "fedora:27" {
+		t.Errorf("the manifest should set the images, got %s %s %s", Image, DebianImage, FedoraImage)
+	}
+
+	if unplayed := c.Unplayed(); len(unplayed) != 0 {
+		t.Errorf("unexpected unplayed interactions %v", unplayed)
+	}
+}
+
+func TestProvisionImagesOffline(t *testing.T) {
+	_, restore := useImageCassette(t,
+		inspectImageInteraction("fedora", ""),
+		inspectImageInteraction("busybox", testImageDigest+"\n"),
+	)
+	defer restore()
+
+	ImageCacheDir = ""
+	AllowImagePull = false
+
+	err := ProvisionImages(&ImageManifest{Images: []ManifestImage{{Name: "fedora"}}})
+	if err == nil || !strings.Contains(err.Error(), "pulling is disabled") {
+		t.Errorf("a missing image should not be provisioned offline, got %v", err)
+	}
+
+	err = ProvisionImages(&ImageManifest{Images: []ManifestImage{{Name: "busybox", Digest: testImageID}}})
+	if err == nil || !strings.Contains(err.Error(), "expected digest") {
+		t.Errorf("an image with another digest should not be accepted, got %v", err)
+	}
+}
@@ -28,13 +28,14 @@ var _ = Describe("build", func() {
 	var (
 		args      []string
 		id        string
-		imageName string = "test"
+		imageName string
 		stdout    string
 		exitCode  int
 	)
 
 	BeforeEach(func() {
 		id = randomDockerName()
+		imageName = randomDockerName()
 	})
 
 	AfterEach(func() {
@@ -44,7 +44,7 @@ var _ = Describe("docker cp", func() {
 
 	Context("check files after a docker cp", func() {
 		It("should have the corresponding files", func() {
-			file, err := ioutil.TempFile(os.TempDir(), "file")
+			file, err := ioutil.TempFile(TempRoot(), "file")
 			Expect(err).ToNot(HaveOccurred())
 			err = file.Close()
 			Expect(err).ToNot(HaveOccurred())
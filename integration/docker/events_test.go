@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"time"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("docker events", func() {
+	var (
+		id      string
+		watcher *EventWatcher
+		ctx     context.Context
+		cancel  context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		id = randomDockerName()
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(Timeout)*time.Second)
+		watcher = WatchDockerEvents(ctx, time.Now(), "container="+id)
+	})
+
+	AfterEach(func() {
+		watcher.Close()
+		cancel()
+	})
+
+	Context("container lifecycle", func() {
+		It("should report create, start, die and destroy in order", func() {
+			_, _, exitCode := DockerRun("--rm", "--name", id, Image, "true")
+			Expect(exitCode).To(Equal(0))
+
+			lifecycle := []string{"create", "start", "die", "destroy"}
+			Expect(watcher.WaitForSequence(ctx, id, lifecycle...)).To(Succeed())
+			Expect(watcher.Sequence(id, lifecycle...)).To(Equal(lifecycle))
+		})
+
+		It("should report the exit code of the container", func() {
+			_, _, exitCode := DockerRun("-d", "--name", id, Image, "sh", "-c", "exit 7")
+			Expect(exitCode).To(Equal(0))
+
+			event, err := watcher.Wait(ctx, func(e Event) bool {
+				return e.Is(id) && e.Action == "die"
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(event.Attributes["exitCode"]).To(Equal("7"))
+
+			Expect(RemoveDockerContainer(id)).To(BeTrue())
+		})
+	})
+})
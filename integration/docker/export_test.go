@@ -42,7 +42,7 @@ var _ = Describe("export", func() {
 	Describe("export with docker", func() {
 		Context("export a container", func() {
 			It("should export filesystem as a tar archive", func() {
-				file, err := ioutil.TempFile(os.TempDir(), "latest.tar")
+				file, err := ioutil.TempFile(TempRoot(), "latest.tar")
 				Expect(err).ToNot(HaveOccurred())
 				defer os.Remove(file.Name())
 				_, _, exitCode := DockerExport("--output", file.Name(), id)
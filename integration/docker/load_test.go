@@ -46,13 +46,13 @@ var _ = Describe("load", func() {
 	Describe("load with docker", func() {
 		Context("load a container", func() {
 			It("should load image", func() {
-				file, err := ioutil.TempFile(os.TempDir(), "mynewimage.tar")
+				file, err := ioutil.TempFile(TempRoot(), "mynewimage.tar")
 				Expect(err).ToNot(HaveOccurred())
 				err = file.Close()
 				Expect(err).ToNot(HaveOccurred())
 				defer os.Remove(file.Name())
 				Expect(file.Name()).To(BeAnExistingFile())
-				imageName = "test/container-test"
+				imageName = randomDockerName()
 				_, _, exitCode := DockerCommit(id, imageName)
 				Expect(exitCode).To(Equal(0))
 				args = []string{"save", imageName, "--output", file.Name()}
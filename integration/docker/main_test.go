@@ -27,8 +27,36 @@ const (
 	shouldNotFail = false
 )
 
+var hostSnapshot *HostSnapshot
+
+var _ = BeforeEach(func() {
+	StartSpecArtifacts()
+
+	hostSnapshot = nil
+
+	if !CheckHostLeaks {
+		return
+	}
+
+	var err error
+	hostSnapshot, err = TakeHostSnapshot()
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterEach(func() {
+	Expect(Resources().Cleanup()).To(Succeed())
+})
+
+var _ = AfterEach(func() {
+	if hostSnapshot == nil {
+		return
+	}
+
+	Expect(hostSnapshot.CheckLeaks()).To(Succeed())
+})
+
 func randomDockerName() string {
-	return RandID(30)
+	return UniqueID(30)
 }
 
 func runDockerCommand(expectedExitCode int, args ...string) string {
@@ -40,22 +68,20 @@ func runDockerCommand(expectedExitCode int, args ...string) string {
 }
 
 func TestIntegration(t *testing.T) {
-	// before start we have to download the docker images
-	images := []string{
-		Image,
-		AlpineImage,
-		PostgresImage,
-		DebianImage,
-		FedoraImage,
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// before start we have to provision the docker images
+	manifest, err := CurrentImageManifest()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	for _, i := range images {
-		_, _, exitCode := DockerPull(i)
-		if exitCode != 0 {
-			t.Fatalf("failed to pull docker image: %s\n", i)
-		}
+	if err := ProvisionImages(manifest); err != nil {
+		t.Fatal(err)
 	}
 
-	RegisterFailHandler(Fail)
-	RunSpecs(t, "Integration Suite")
+	RegisterFailHandler(ArtifactsFailHandler(Fail))
+	RunSpecsWithDefaultAndCustomReporters(t, "Integration Suite", SuiteReporters("integration"))
 }
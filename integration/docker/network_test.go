@@ -23,9 +23,13 @@ import (
 var _ = Describe("network", func() {
 	var (
 		args        []string
-		networkName string = "my-bridge-network"
+		networkName string
 	)
 
+	BeforeEach(func() {
+		networkName = randomDockerName()
+	})
+
 	AfterEach(func() {
 		_, _, exitCode := DockerNetwork("rm", networkName)
 		Expect(exitCode).To(Equal(0))
@@ -52,7 +52,7 @@ var _ = Describe("docker privileges", func() {
 			_, _, exitCode = DockerRun(args...)
 			Expect(exitCode).To(Equal(0))
 
-			file, err := ioutil.TempFile(os.TempDir(), "latest.tar")
+			file, err := ioutil.TempFile(TempRoot(), "latest.tar")
 			Expect(err).ToNot(HaveOccurred())
 			_, _, exitCode := DockerExport("--output", file.Name(), id)
 			Expect(exitCode).To(Equal(0))
@@ -0,0 +1,139 @@
+// Copyright (c) 2017 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// removeImageByID removes every tag of the image name, so that it has
+// to be pulled again with its blobs
+func removeImageByID(name string) {
+	stdout, _, exitCode := DockerImageInspect("--format", "{{.Id}}", name)
+	Expect(exitCode).To(Equal(0))
+
+	_, _, exitCode = DockerRmi("-f", strings.TrimSpace(stdout))
+	Expect(exitCode).To(Equal(0))
+
+	_, _, exitCode = DockerImageInspect(name)
+	Expect(exitCode).NotTo(Equal(0))
+}
+
+// blobGets returns the blobs downloaded by the requests
+func blobGets(requests []string) []string {
+	var gets []string
+
+	for _, r := range requests {
+		if strings.HasPrefix(r, "GET ") && strings.Contains(r, "/blobs/") {
+			gets = append(gets, r)
+		}
+	}
+
+	return gets
+}
+
+var _ = Describe("docker registry", func() {
+	var (
+		registry *DockerRegistry
+		image    string
+		id       string
+	)
+
+	BeforeEach(func() {
+		var err error
+		registry, err = StartDockerRegistry()
+		Expect(err).NotTo(HaveOccurred())
+
+		image = registry.Image(randomDockerName() + ":1.0")
+		id = randomDockerName()
+
+		// the config and the last layer of the image are unique, they
+		// are only found in the registry once the image is removed
+		_, _, exitCode := DockerRun("--name", id, Image, "sh", "-c", "echo "+id+" > /unique")
+		Expect(exitCode).To(Equal(0))
+
+		_, _, exitCode = DockerCommit(id, image)
+		Expect(exitCode).To(Equal(0))
+		Resources().AddImage(image)
+
+		Expect(RemoveDockerContainer(id)).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		Expect(registry.Close()).To(Succeed())
+	})
+
+	Context("push and pull an image", func() {
+		It("should run the pulled image", func() {
+			_, _, exitCode := DockerPush(image)
+			Expect(exitCode).To(Equal(0))
+			Expect(registry.Repositories()).To(HaveLen(1))
+
+			removeImageByID(image)
+
+			pushed := len(registry.Requests())
+			_, _, exitCode = DockerPull(image)
+			Expect(exitCode).To(Equal(0))
+			Expect(blobGets(registry.Requests()[pushed:])).NotTo(BeEmpty())
+
+			stdout, _, exitCode := DockerRun("--rm", "--name", randomDockerName(), image, "cat", "/unique")
+			Expect(exitCode).To(Equal(0))
+			Expect(stdout).To(ContainSubstring(id))
+		})
+	})
+
+	Context("push to a failing registry", func() {
+		It("should fail", func() {
+			Expect(registry.InjectFault(RegistryFault{
+				Method: "PUT",
+				Path:   "/manifests/",
+				Status: http.StatusInternalServerError,
+			})).To(Succeed())
+
+			_, _, exitCode := DockerPush(image)
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(registry.Repositories()).To(BeEmpty())
+		})
+	})
+
+	Context("pull from a slow registry", func() {
+		It("should wait for the blobs", func() {
+			_, _, exitCode := DockerPush(image)
+			Expect(exitCode).To(Equal(0))
+
+			removeImageByID(image)
+
+			delay := 2 * time.Second
+			Expect(registry.InjectFault(RegistryFault{
+				Method: "GET",
+				Path:   "/blobs/",
+				Delay:  delay,
+			})).To(Succeed())
+
+			pushed := len(registry.Requests())
+			start := time.Now()
+			_, _, exitCode = DockerPull(image)
+			Expect(exitCode).To(Equal(0))
+			Expect(time.Since(start)).To(BeNumerically(">=", delay))
+			Expect(blobGets(registry.Requests()[pushed:])).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	. "github.com/clearcontainers/tests"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("resource limits", func() {
+	var id string
+
+	BeforeEach(func() {
+		id = randomDockerName()
+	})
+
+	AfterEach(func() {
+		Expect(RemoveDockerContainer(id)).To(BeTrue())
+		Expect(ExistDockerContainer(id)).NotTo(BeTrue())
+	})
+
+	DescribeTable("container with resource limits",
+		func(limits ResourceLimits) {
+			args := append([]string{"-td", "--name", id}, limits.DockerArgs()...)
+			args = append(args, Image, "sh")
+			_, _, exitCode := DockerRun(args...)
+			Expect(exitCode).To(BeZero())
+
+			report, err := VerifyResourceLimits(id, limits)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.OK()).To(BeTrue(), report.String())
+		},
+		Entry("should honour the memory limit", ResourceLimits{Memory: 256 << 20}),
+		Entry("should honour the CPUs limit", ResourceLimits{CPUs: 1.5}),
+		Entry("should honour the CPU shares", ResourceLimits{CPUShares: 512}),
+		Entry("should honour the pids limit", ResourceLimits{PidsLimit: 100}),
+		Entry("should honour all the limits", ResourceLimits{Memory: 512 << 20, CPUs: 2, CPUShares: 1024, PidsLimit: 50}),
+	)
+})
@@ -22,15 +22,47 @@ import (
 
 var _ = Describe("docker search", func() {
 	var (
-		args []string
+		args     []string
+		registry *DockerRegistry
+		name     string
 	)
 
+	BeforeEach(func() {
+		var err error
+		registry, err = StartDockerRegistry()
+		Expect(err).NotTo(HaveOccurred())
+
+		name = randomDockerName()
+		image := registry.Image(name)
+		_, _, exitCode := DockerTag(Image, image)
+		Expect(exitCode).To(Equal(0))
+		_, _, exitCode = DockerPush(image)
+		Expect(exitCode).To(Equal(0))
+	})
+
+	AfterEach(func() {
+		Expect(registry.Close()).To(Succeed())
+	})
+
 	Context("search an image", func() {
+		It("should find the image", func() {
+			stdout, _, exitCode := DockerSearch(registry.Image(name))
+			Expect(exitCode).To(Equal(0))
+			Expect(stdout).To(ContainSubstring(name))
+		})
+
 		It("should filter the requests", func() {
-			args = []string{"--filter", "is-official=true", "--filter=stars=3", Image}
+			args = []string{"--filter", "is-official=true", "--filter=stars=3", registry.Image(name)}
 			stdout, _, exitCode := DockerSearch(args...)
 			Expect(exitCode).To(Equal(0))
-			Expect(stdout).To(ContainSubstring(Image))
+			Expect(stdout).NotTo(ContainSubstring(name))
+		})
+
+		It("should fail when the registry fails", func() {
+			Expect(registry.InjectFault(RegistryFault{Path: "^/v1/search$", Status: 500})).To(Succeed())
+			_, _, exitCode := DockerSearch(registry.Image(name))
+			Expect(exitCode).NotTo(Equal(0))
+			Expect(registry.Requests()).To(ContainElement("GET /v1/search"))
 		})
 	})
 })
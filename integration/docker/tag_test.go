@@ -29,6 +29,7 @@ var _ = Describe("tag", func() {
 
 	BeforeEach(func() {
 		id = randomDockerName()
+		tagName = randomDockerName()
 		_, _, exitCode := DockerRun("-td", "--name", id, Image, "sh")
 		Expect(exitCode).To(Equal(0))
 	})
@@ -43,7 +44,6 @@ var _ = Describe("tag", func() {
 	Describe("tag with docker", func() {
 		Context("tag a container", func() {
 			It("has the tag", func() {
-				tagName = "container"
 				args = []string{"tag", Image, tagName}
 				runDockerCommand(0, args...)
 				stdout := runDockerCommand(0, "images")
@@ -15,11 +15,15 @@
 package docker
 
 import (
+	"time"
+
 	. "github.com/clearcontainers/tests"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+const dockerSessionTimeout = 30 * time.Second
+
 var _ = Describe("terminal", func() {
 	var (
 		id string
@@ -45,7 +49,7 @@ var _ = Describe("terminal", func() {
 
 		Context("TERM env variable is not set when not allocating a tty", func() {
 			It("should not display the terminal's name", func() {
-				stdout, _, exitCode := DockerRun( "--name", id, Image, "env")
+				stdout, _, exitCode := DockerRun("--name", id, Image, "env")
 				Expect(exitCode).To(Equal(0))
 				Expect(stdout).NotTo(ContainSubstring("TERM"))
 			})
@@ -59,4 +63,60 @@ var _ = Describe("terminal", func() {
 			})
 		})
 	})
+
+	Describe("interactive terminal with docker", func() {
+		var session *Session
+
+		BeforeEach(func() {
+			var err error
+
+			TrackDockerContainer(id)
+			session, err = StartSession(Docker, "run", "--runtime", Runtime, "--name", id, "-it", Image, "sh")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		Context("docker run -it", func() {
+			It("should run commands", func() {
+				Expect(session.SendLine("echo result=$((6*7))")).To(Succeed())
+				_, err := session.ExpectRegexp("result=42", dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("should resize the container terminal", func() {
+				Expect(session.SendLine("echo started=$((1+1))")).To(Succeed())
+				_, err := session.ExpectRegexp("started=2", dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(session.Resize(40, 100)).To(Succeed())
+
+				Expect(session.SendLine("echo size=$(stty size)")).To(Succeed())
+				_, err = session.ExpectRegexp("size=40 100", dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("should interrupt the foreground process with Ctrl-C", func() {
+				Expect(session.SendLine("echo sleeping=$((2+2)); sleep 1000")).To(Succeed())
+				_, err := session.ExpectRegexp("sleeping=4", dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(session.Send(CtrlC)).To(Succeed())
+
+				Expect(session.SendLine("echo interrupted=$((1+1))")).To(Succeed())
+				_, err = session.ExpectRegexp("interrupted=2", dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("should exit with the shell exit code", func() {
+				Expect(session.SendLine("exit 3")).To(Succeed())
+
+				exitCode, err := session.Wait(dockerSessionTimeout)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(exitCode).To(Equal(3))
+			})
+		})
+	})
 })
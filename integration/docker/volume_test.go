@@ -27,15 +27,21 @@ import (
 var _ = Describe("docker volume", func() {
 	var (
 		args          []string
-		id            string = randomDockerName()
-		id2           string = randomDockerName()
-		volumeName    string = "cc3volume"
+		id            string
+		id2           string
+		volumeName    string
 		containerPath string = "/attached_vol/"
 		fileTest      string = "hello"
 		exitCode      int
 		stdout        string
 	)
 
+	BeforeEach(func() {
+		id = randomDockerName()
+		id2 = randomDockerName()
+		volumeName = randomDockerName()
+	})
+
 	Context("create volume", func() {
 		It("should display the volume's name", func() {
 			_, _, exitCode = DockerVolume("create", "--name", volumeName)
@@ -77,7 +83,7 @@ var _ = Describe("docker volume", func() {
 
 	Context("volume bind-mount a directory", func() {
 		It("should display directory's name", func() {
-			file, err := ioutil.TempFile(os.TempDir(), fileTest)
+			file, err := ioutil.TempFile(TempRoot(), fileTest)
 			Expect(err).ToNot(HaveOccurred())
 			err = file.Close()
 			Expect(err).ToNot(HaveOccurred())
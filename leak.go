@@ -0,0 +1,364 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CheckHostLeaks enables the host resource leak detector of the suites
+var CheckHostLeaks bool
+
+// LeakGracePeriod is the time given to the resources of a spec to be
+// released before they are reported as leaked
+var LeakGracePeriod = 10 * time.Second
+
+// leakPollInterval is the interval between two snapshots while waiting
+// for the resources to be released
+const leakPollInterval = 500 * time.Millisecond
+
+// netnsDirs are the directories where the network namespaces are bound
+var netnsDirs = []string{"/run/netns", "/var/run/netns"}
+
+// hostResource is a kind of host resource that can be leaked
+type hostResource struct {
+	kind string
+	list func() ([]string, error)
+
+	// shared is true if the resources of all the parallel nodes are
+	// listed, when the specs run in parallel only the resources naming
+	// a container of this node are then reported as leaked
+	shared bool
+}
+
+// hostResources are the resources recorded by TakeHostSnapshot
+var hostResources = []hostResource{
+	{"hypervisor", listHypervisors, true},
+	{"mount", func() ([]string, error) {
+		return listMounts("/proc/self/mountinfo", "/run")
+	}, true},
+	{"mount", func() ([]string, error) {
+		return listMounts("/proc/self/mountinfo", TempRoot())
+	}, false},
+	{"netns", listNetns, true},
+	{"tap", listTapDevices, true},
+	{"loop", listLoopDevices, true},
+	{"bundle", func() ([]string, error) {
+		return filepath.Glob(filepath.Join(TempRoot(), "bundle*"))
+	}, false},
+}
+
+// HostSnapshot records the host resources that a container can leave
+// behind: hypervisor processes, mounts under /run and TempRoot, network
+// namespaces, tap devices, loop devices and bundle directories. When the
+// specs run in parallel, the resources that are not under TempRoot are
+// attributed to the node whose container they name.
+type HostSnapshot struct {
+	resources map[string]map[string]bool
+
+	// shared are the resources listed for all the parallel nodes
+	shared map[string]map[string]bool
+
+	// taken is the time the snapshot was taken
+	taken time.Time
+
+	// dockerIDs are the IDs of the docker containers created by this
+	// node since the snapshot was taken, nil until they are listed
+	dockerIDs []string
+}
+
+// TakeHostSnapshot records the current host resources
+func TakeHostSnapshot() (*HostSnapshot, error) {
+	s := &HostSnapshot{
+		resources: make(map[string]map[string]bool),
+		shared:    make(map[string]map[string]bool),
+		taken:     time.Now(),
+	}
+
+	for _, r := range hostResources {
+		items, err := r.list()
+		if err != nil {
+			return nil, fmt.Errorf("could not list %s resources: %v", r.kind, err)
+		}
+
+		if s.resources[r.kind] == nil {
+			s.resources[r.kind] = make(map[string]bool)
+			s.shared[r.kind] = make(map[string]bool)
+		}
+
+		for _, item := range items {
+			s.resources[r.kind][item] = true
+			s.shared[r.kind][item] = r.shared
+		}
+	}
+
+	return s, nil
+}
+
+// Leaks returns the resources of after that are not in s, sorted
+// and prefixed by their kind. When the specs run in parallel, the
+// resources listed for all the nodes are only returned if they name a
+// container of this node.
+func (s *HostSnapshot) Leaks(after *HostSnapshot) []string {
+	var leaks []string
+
+	parallel := IsParallel()
+
+	for kind, items := range after.resources {
+		for item := range items {
+			if s.resources[kind][item] {
+				continue
+			}
+
+			if parallel && after.shared[kind][item] && !s.ownedByNode(item) {
+				continue
+			}
+
+			leaks = append(leaks, fmt.Sprintf("%s: %s", kind, item))
+		}
+	}
+
+	sort.Strings(leaks)
+
+	return leaks
+}
+
+// ownedByNode returns true if item names a container of this node: a
+// container whose ID starts with NodePrefix, as the runtime containers,
+// or a docker container created since s was taken with such a name
+func (s *HostSnapshot) ownedByNode(item string) bool {
+	prefix := NodePrefix()
+
+	for i := 0; ; i++ {
+		j := strings.Index(item[i:], prefix)
+		if j < 0 {
+			break
+		}
+		i += j
+
+		// n1- must not match the end of an1-
+		if i == 0 || !isAlphanumeric(item[i-1]) {
+			return true
+		}
+	}
+
+	if s.dockerIDs == nil {
+		s.dockerIDs = nodeDockerContainers(s.taken)
+	}
+
+	for _, id := range s.dockerIDs {
+		if strings.Contains(item, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// nodeDockerContainers returns the IDs of the docker containers created
+// since the given time whose name starts with NodePrefix
+func nodeDockerContainers(since time.Time) []string {
+	ids := []string{}
+	until := time.Now()
+
+	// the events of the containers removed since are also listed
+	cmd := NewCommand(Docker, "events", "--format", "{{json .}}",
+		fmt.Sprintf("--since=%d.%09d", since.Unix(), since.Nanosecond()),
+		fmt.Sprintf("--until=%d.%09d", until.Unix(), until.Nanosecond()),
+		"--filter", "type=container", "--filter", "event=create")
+
+	stdout, stderr, exitCode := cmd.Run()
+	if exitCode != 0 {
+		LogIfFail("could not list the docker containers of the node: %s\n", stderr)
+		return ids
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		e, err := parseDockerEvent(line)
+		if err != nil {
+			LogIfFail("ignoring event '%s': %v\n", line, err)
+			continue
+		}
+
+		if strings.HasPrefix(e.Attributes["name"], NodePrefix()) {
+			ids = append(ids, e.ID)
+		}
+	}
+
+	return ids
+}
+
+// CheckLeaks returns an error listing the resources created since s was
+// taken that are still present once LeakGracePeriod expires
+func (s *HostSnapshot) CheckLeaks() error {
+	deadline := time.Now().Add(LeakGracePeriod)
+
+	for {
+		after, err := TakeHostSnapshot()
+		if err != nil {
+			return err
+		}
+
+		leaks := s.Leaks(after)
+		if len(leaks) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("leaked host resources:\n\t%s", strings.Join(leaks, "\n\t"))
+		}
+
+		time.Sleep(leakPollInterval)
+	}
+}
+
+// listHypervisors returns the PID and command line of the hypervisor processes
+func listHypervisors() ([]string, error) {
+	var vms []string
+
+	matchers := HypervisorMatchers()
+
+	for _, p := range readProcesses(procPath) {
+		for _, m := range matchers {
+			if m.Match(p.cmdline, "") {
+				vms = append(vms, fmt.Sprintf("%d %s", p.pid, strings.Join(p.cmdline, " ")))
+				break
+			}
+		}
+	}
+
+	return vms, nil
+}
+
+// listMounts returns the mount points listed in mountinfo that are
+// under one of the directories dirs
+func listMounts(mountinfo string, dirs ...string) ([]string, error) {
+	f, err := os.Open(mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the mount point is the fifth field
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		for _, dir := range dirs {
+			if strings.HasPrefix(fields[4], dir+"/") {
+				mounts = append(mounts, fields[4])
+				break
+			}
+		}
+	}
+
+	return mounts, scanner.Err()
+}
+
+// listNetns returns the bound network namespaces
+func listNetns() ([]string, error) {
+	seen := make(map[string]bool)
+	var namespaces []string
+
+	for _, dir := range netnsDirs {
+		// /var/run is usually a link to /run
+		real, err := filepath.EvalSymlinks(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if seen[real] {
+			continue
+		}
+		seen[real] = true
+
+		entries, err := ioutil.ReadDir(real)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			namespaces = append(namespaces, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return namespaces, nil
+}
+
+// listTapDevices returns the tap network devices
+func listTapDevices() ([]string, error) {
+	entries, err := ioutil.ReadDir("/sys/class/net")
+	if err != nil {
+		return nil, err
+	}
+
+	var taps []string
+
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "tap") {
+			taps = append(taps, e.Name())
+		}
+	}
+
+	return taps, nil
+}
+
+// listLoopDevices returns the attached loop devices and their backing files
+func listLoopDevices() ([]string, error) {
+	files, err := filepath.Glob("/sys/block/loop*/loop/backing_file")
+	if err != nil {
+		return nil, err
+	}
+
+	var loops []string
+
+	for _, f := range files {
+		backing, err := ioutil.ReadFile(f)
+		if err != nil {
+			// the device was detached while it was read
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		device := filepath.Base(filepath.Dir(filepath.Dir(f)))
+		loops = append(loops, fmt.Sprintf("%s %s", device, strings.TrimSpace(string(backing))))
+	}
+
+	return loops, nil
+}
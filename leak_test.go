@@ -0,0 +1,125 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/onsi/ginkgo/config"
+)
+
+func TestHostSnapshotLeaks(t *testing.T) {
+	before := &HostSnapshot{resources: map[string]map[string]bool{
+		"mount":  {"/run/foo": true},
+		"bundle": {"/tmp/bundle1": true},
+	}}
+
+	after := &HostSnapshot{resources: map[string]map[string]bool{
+		"mount":  {"/run/foo": true, "/run/bar": true},
+		"bundle": {"/tmp/bundle2": true},
+		"tap":    {"tap0": true},
+	}}
+
+	expected := []string{"bundle: /tmp/bundle2", "mount: /run/bar", "tap: tap0"}
+	if leaks := before.Leaks(after); !reflect.DeepEqual(leaks, expected) {
+		t.Errorf("expected leaks %v, got %v", expected, leaks)
+	}
+
+	if leaks := after.Leaks(after); len(leaks) != 0 {
+		t.Errorf("unchanged resources reported as leaks: %v", leaks)
+	}
+}
+
+func TestHostSnapshotLeaksParallel(t *testing.T) {
+	defer func(c config.GinkgoConfigType) { config.GinkgoConfig = c }(config.GinkgoConfig)
+	config.GinkgoConfig.ParallelNode = 1
+	config.GinkgoConfig.ParallelTotal = 2
+
+	dockerID := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	before := &HostSnapshot{
+		resources: map[string]map[string]bool{},
+		dockerIDs: []string{dockerID},
+	}
+
+	after := &HostSnapshot{
+		resources: map[string]map[string]bool{
+			"hypervisor": {
+				"10 qemu-lite -name pod-n1-abcdef":  true,
+				"11 qemu-lite -name pod-n2-abcdef":  true,
+				"12 qemu-lite -name pod-xn1-abcdef": true,
+			},
+			"mount": {
+				"/run/vc/" + dockerID + "/rootfs": true,
+				"/run/vc/fedcba/rootfs":           true,
+				"/tmp/cc-tests-node1/bundle1":     true,
+			},
+		},
+		shared: map[string]map[string]bool{
+			"hypervisor": {
+				"10 qemu-lite -name pod-n1-abcdef":  true,
+				"11 qemu-lite -name pod-n2-abcdef":  true,
+				"12 qemu-lite -name pod-xn1-abcdef": true,
+			},
+			"mount": {
+				"/run/vc/" + dockerID + "/rootfs": true,
+				"/run/vc/fedcba/rootfs":           true,
+			},
+		},
+	}
+
+	// the resources of the other nodes are not leaks of this node
+	expected := []string{
+		"hypervisor: 10 qemu-lite -name pod-n1-abcdef",
+		"mount: /run/vc/" + dockerID + "/rootfs",
+		"mount: /tmp/cc-tests-node1/bundle1",
+	}
+
+	if leaks := before.Leaks(after); !reflect.DeepEqual(leaks, expected) {
+		t.Errorf("expected leaks %v, got %v", expected, leaks)
+	}
+}
+
+func TestListMounts(t *testing.T) {
+	f, err := ioutil.TempFile("", "mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	mountinfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /run rw,nosuid shared:5 - tmpfs tmpfs rw
+24 23 0:45 / /run/vc/sbs/abc rw shared:6 - tmpfs tmpfs rw
+25 22 0:46 / /tmp/bundle123/rootfs rw - overlay overlay rw
+26 22 0:47 / /tmpfoo rw - tmpfs tmpfs rw
+`
+	if _, err := f.WriteString(mountinfo); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mounts, err := listMounts(f.Name(), "/run", "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/run/vc/sbs/abc", "/tmp/bundle123/rootfs"}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("expected mounts %v, got %v", expected, mounts)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var (
+	mockRuntimeOnce sync.Once
+	mockRuntimePath string
+	mockRuntimeErr  error
+)
+
+// useMockRuntime builds cmd/mockruntime and makes it the runtime under
+// test, the returned function restores the previous runtime
+func useMockRuntime(t *testing.T) func() {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to build the mock runtime")
+	}
+
+	mockRuntimeOnce.Do(func() {
+		var dir string
+		if dir, mockRuntimeErr = ioutil.TempDir("", "mockruntime"); mockRuntimeErr != nil {
+			return
+		}
+
+		mockRuntimePath = filepath.Join(dir, "mockruntime")
+		out, err := exec.Command("go", "build", "-o", mockRuntimePath, "./cmd/mockruntime").CombinedOutput()
+		if err != nil {
+			mockRuntimeErr = fmt.Errorf("could not build the mock runtime: %v %s", err, out)
+		}
+	})
+
+	if mockRuntimeErr != nil {
+		t.Fatal(mockRuntimeErr)
+	}
+
+	root, err := ioutil.TempDir("", "mockruntime-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime, driver := Runtime, RuntimeDriverName
+	Runtime, RuntimeDriverName = mockRuntimePath, "mockruntime"
+	os.Setenv("MOCK_RUNTIME_ROOT", root)
+
+	return func() {
+		Runtime, RuntimeDriverName = runtime, driver
+		os.Unsetenv("MOCK_RUNTIME_ROOT")
+		os.Unsetenv("MOCK_RUNTIME_FAULTS")
+		os.RemoveAll(root)
+	}
+}
+
+// newMockContainer returns a container running workload on the host
+func newMockContainer(t *testing.T, detach bool, workload ...string) *Container {
+	b := newTestBundle(t)
+	b.Config.Process.Args = workload
+	b.Config.Process.Env = []string{"PATH=/usr/sbin:/usr/bin:/sbin:/bin"}
+
+	if err := os.Mkdir(filepath.Join(b.Path, "rootfs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := UniqueID(20)
+	console := ""
+	pidFile := filepath.Join(b.Path, "pid")
+	logFile := filepath.Join(b.Path, "log")
+
+	return &Container{
+		Bundle:  b,
+		ID:      &id,
+		Console: &console,
+		PidFile: &pidFile,
+		LogFile: &logFile,
+		Detach:  detach,
+	}
+}
+
+func TestMockRuntimeLifecycle(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, true, "sleep", "60")
+	defer c.Teardown()
+
+	if _, stderr, code := c.Create(); code != 0 {
+		t.Fatalf("create failed: %s", stderr)
+	}
+
+	state, err := c.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Status != StatusCreated || state.ID != *c.ID {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	if !c.Exist() {
+		t.Error("a created container should exist")
+	}
+
+	if _, stderr, code := c.Start(); code != 0 {
+		t.Fatalf("start failed: %s", stderr)
+	}
+
+	if err := c.WaitForStatus(context.Background(), StatusRunning); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := c.Exec(Process{ContainerID: c.ID, Workload: []string{"sh", "-c", "exit 3"}}); code != 3 {
+		t.Errorf("expected exec exit code 3, got %d", code)
+	}
+
+	processes, err := c.Ps()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processes) != 1 || processes[0].PID != state.Pid {
+		t.Errorf("expected the process %d, got %+v", state.Pid, processes)
+	}
+
+	if _, stderr, code := c.Kill(false, syscall.SIGKILL); code != 0 {
+		t.Fatalf("kill failed: %s", stderr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.WaitForStatus(ctx, StatusStopped); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Teardown(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Exist() {
+		t.Error("the container should not exist after the teardown")
+	}
+}
+
+func TestMockRuntimeTeardown(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, true, "sleep", "60")
+
+	if _, stderr, code := c.Run(); code != 0 {
+		t.Fatalf("run failed: %s", stderr)
+	}
+
+	if _, _, code := c.Delete(false); code == 0 {
+		t.Error("a running container should not be deleted without force")
+	}
+
+	if err := c.Teardown(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Exist() {
+		t.Error("the container should not exist after the teardown")
+	}
+
+	if _, err := os.Stat(c.Bundle.Path); !os.IsNotExist(err) {
+		t.Error("the bundle should be removed by the teardown")
+	}
+}
+
+func TestMockRuntimeRunAttached(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, false, "sh", "-c", "echo hello; exit 7")
+	defer c.Teardown()
+
+	stdout, _, code := c.Run()
+	if code != 7 || stdout != "hello\n" {
+		t.Errorf("expected hello and exit code 7, got '%s' and %d", stdout, code)
+	}
+
+	if c.Exist() {
+		t.Error("an attached container should be deleted when its process exits")
+	}
+}
+
+func TestMockRuntimeFaults(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, true, "sleep", "60")
+	defer c.Teardown()
+
+	defer func(timeouts map[string]int) {
+		operationTimeouts = timeouts
+	}(operationTimeouts)
+	operationTimeouts = map[string]int{"create": 1}
+
+	os.Setenv("MOCK_RUNTIME_FAULTS", "create=hang")
+	result := c.runtimeCommand(append([]string{"create"}, c.createArgs()...)...).RunContext(context.Background())
+	if !result.TimedOut {
+		t.Errorf("a hanging create should time out, got %+v", result)
+	}
+
+	os.Unsetenv("MOCK_RUNTIME_FAULTS")
+	if _, stderr, code := c.Create(); code != 0 {
+		t.Fatalf("create failed: %s", stderr)
+	}
+
+	os.Setenv("MOCK_RUNTIME_FAULTS", "state=crash")
+	if _, err := c.State(); err == nil {
+		t.Error("a crashing state should fail")
+	}
+
+	os.Setenv("MOCK_RUNTIME_FAULTS", "delete=exit:4")
+	if _, _, code := c.Delete(true); code != 4 {
+		t.Errorf("expected delete exit code 4, got %d", code)
+	}
+
+	os.Unsetenv("MOCK_RUNTIME_FAULTS")
+	if c.Exist() {
+		t.Error("the faulty delete should have deleted the container")
+	}
+}
+
+func TestMockRuntimeKillDeleteOptions(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, true, "sleep", "60")
+	defer c.Teardown()
+
+	if _, stderr, code := c.Create(); code != 0 {
+		t.Fatalf("create failed: %s", stderr)
+	}
+
+	defer func(timeouts map[string]int) {
+		operationTimeouts = timeouts
+	}(operationTimeouts)
+	operationTimeouts = map[string]int{"kill": 1}
+
+	os.Setenv("MOCK_RUNTIME_FAULTS", "kill=hang")
+	start := time.Now()
+	if _, _, code := c.Kill(false, syscall.SIGKILL); code == 0 {
+		t.Error("a hanging kill should fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the kill timeout was not applied, kill took %s", elapsed)
+	}
+
+	os.Unsetenv("MOCK_RUNTIME_FAULTS")
+	if _, stderr, code := c.Delete(true); code != 0 {
+		t.Fatalf("delete failed: %s", stderr)
+	}
+
+	log, err := ioutil.ReadFile(*c.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range []string{"kill", "delete"} {
+		if !strings.Contains(string(log), fmt.Sprintf("--log=%s %s ", *c.LogFile, command)) {
+			t.Errorf("%s was not run with the log option of the container:\n%s", command, log)
+		}
+	}
+}
+
+func TestMockRuntimeRunSession(t *testing.T) {
+	defer useMockRuntime(t)()
+
+	c := newMockContainer(t, false, "sh")
+	defer c.Teardown()
+
+	console := *c.Console
+
+	s, err := c.RunSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if *c.Console != console {
+		t.Errorf("the console of the container should be kept, got %s", *c.Console)
+	}
+
+	s.SendLine("echo result=$((6*7))")
+	if _, err := s.ExpectRegexp("result=42", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SendLine("exit 3")
+	if code, err := s.Wait(5 * time.Second); err != nil || code != 3 {
+		t.Errorf("expected exit code 3, got %d: %v", code, err)
+	}
+}
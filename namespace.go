@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/onsi/ginkgo/config"
+)
+
+var (
+	tempRoot     string
+	tempRootLock sync.Mutex
+)
+
+// ParallelNode returns the index, starting at 1, of the ginkgo node
+// running the specs
+func ParallelNode() int {
+	if config.GinkgoConfig.ParallelNode < 1 {
+		return 1
+	}
+
+	return config.GinkgoConfig.ParallelNode
+}
+
+// IsParallel returns true if the specs are run by several ginkgo nodes
+func IsParallel() bool {
+	return config.GinkgoConfig.ParallelTotal > 1
+}
+
+// NodePrefix returns the prefix of the resources created by this node
+func NodePrefix() string {
+	return fmt.Sprintf("n%d-", ParallelNode())
+}
+
+// UniqueID returns a random lowercase ID of n characters prefixed by
+// NodePrefix, so that parallel nodes never create the same resource.
+// It can be used as container, volume, network or image name.
+func UniqueID(n int) string {
+	prefix := NodePrefix()
+	if n <= len(prefix) {
+		return prefix
+	}
+
+	return prefix + randString(n-len(prefix), lowerLetters)
+}
+
+// SeedNode seeds the ID generators from the ginkgo random seed and the
+// node index, rerunning the specs with the same -ginkgo.seed generates
+// the same IDs
+func SeedNode() {
+	SeedRandom(config.GinkgoConfig.RandomSeed + int64(ParallelNode()))
+}
+
+// TempRoot returns the directory where the temporary files of the tests
+// are created: the system temporary directory, or a directory of this
+// node when the specs run in parallel
+func TempRoot() string {
+	tempRootLock.Lock()
+	defer tempRootLock.Unlock()
+
+	if tempRoot != "" {
+		return tempRoot
+	}
+
+	root := os.TempDir()
+
+	if IsParallel() {
+		root = filepath.Join(root, fmt.Sprintf("cc-tests-node%d", ParallelNode()))
+		if err := os.MkdirAll(root, 0755); err != nil {
+			LogIfFail("could not create %s, using %s: %v\n", root, os.TempDir(), err)
+			root = os.TempDir()
+		}
+	}
+
+	tempRoot = root
+
+	return tempRoot
+}
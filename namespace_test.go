@@ -0,0 +1,81 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueID(t *testing.T) {
+	defer SeedRandom(RandomSeed())
+
+	SeedRandom(42)
+	first := []string{UniqueID(20), UniqueID(20)}
+
+	SeedRandom(42)
+	second := []string{UniqueID(20), UniqueID(20)}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("the same seed generated %v and %v", first, second)
+	}
+
+	if first[0] == first[1] {
+		t.Errorf("generated the same ID twice: %s", first[0])
+	}
+
+	for _, id := range first {
+		if len(id) != 20 {
+			t.Errorf("expected 20 characters, got %q", id)
+		}
+
+		if !strings.HasPrefix(id, NodePrefix()) {
+			t.Errorf("%s does not start with %s", id, NodePrefix())
+		}
+
+		if strings.ToLower(id) != id {
+			t.Errorf("%s is not lowercase", id)
+		}
+	}
+}
+
+func TestRegisterDockerResource(t *testing.T) {
+	r := &ResourceRegistry{}
+	defer func(old *ResourceRegistry) { resources = old }(resources)
+	resources = r
+
+	registerDockerResource("volume", []string{"create", "--label", "foo=bar", "vol1"})
+	registerDockerResource("volume", []string{"ls"})
+	registerDockerResource("network", []string{"create", "net1"})
+	registerDockerResource("build", []string{"-t", "img1", "."})
+	trackDockerArgs([]string{"--runtime", "cc-runtime", "--name=ctr1", "busybox"})
+
+	if !reflect.DeepEqual(r.volumes, []string{"vol1"}) {
+		t.Errorf("unexpected volumes %v", r.volumes)
+	}
+
+	if !reflect.DeepEqual(r.networks, []string{"net1"}) {
+		t.Errorf("unexpected networks %v", r.networks)
+	}
+
+	if !reflect.DeepEqual(r.images, []string{"img1"}) {
+		t.Errorf("unexpected images %v", r.images)
+	}
+
+	if !reflect.DeepEqual(r.dockerContainers, []string{"ctr1"}) {
+		t.Errorf("unexpected docker containers %v", r.dockerContainers)
+	}
+}
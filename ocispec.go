@@ -0,0 +1,210 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	spec "github.com/opencontainers/specs/specs-go"
+)
+
+// ociConfigEnv is the environment variable that can specify the
+// OCI config file used by the bundles
+const ociConfigEnv = "OCI_CONFIG"
+
+// DefaultOCIVersion is the OCI spec version of the default config, the
+// version of the config.json the bundles used to be created from
+const DefaultOCIVersion = "1.0.0-rc2-dev"
+
+// OCIVersion is the OCI spec version of the default config
+var OCIVersion string
+
+// OCIConfigFile is the OCI config file used by the bundles,
+// if empty DefaultSpec is used
+var OCIConfigFile string
+
+// ociVersions are the OCI spec versions DefaultSpec can generate, with
+// the changes each of them needs from the config of spec.Version
+var ociVersions = map[string]func(config *spec.Spec){
+	spec.Version: func(config *spec.Spec) {},
+
+	// hooks only became optional in 1.0.0-rc3, the config always
+	// had an empty hooks object
+	DefaultOCIVersion: func(config *spec.Spec) {
+		config.Hooks = &spec.Hooks{}
+	},
+}
+
+// DefaultSpec returns the default config of the bundles for the OCI spec
+// version, DefaultOCIVersion is used if version is empty
+func DefaultSpec(version string) (*spec.Spec, error) {
+	if version == "" {
+		version = DefaultOCIVersion
+	}
+
+	adjust, ok := ociVersions[version]
+	if !ok {
+		var supported []string
+		for v := range ociVersions {
+			supported = append(supported, v)
+		}
+		sort.Strings(supported)
+
+		return nil, fmt.Errorf("unsupported OCI spec version %s, supported versions: %s",
+			version, strings.Join(supported, ", "))
+	}
+
+	config := &spec.Spec{
+		Version: version,
+		Platform: spec.Platform{
+			OS:   runtime.GOOS,
+			Arch: runtime.GOARCH,
+		},
+		Process: spec.Process{
+			Terminal: true,
+			Args:     []string{"sh"},
+			Env: []string{
+				"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+				"TERM=xterm",
+			},
+			Cwd: "/",
+			Rlimits: []spec.LinuxRlimit{
+				{
+					Type: "RLIMIT_NOFILE",
+					Hard: 1024,
+					Soft: 1024,
+				},
+			},
+			NoNewPrivileges: true,
+		},
+		Root: spec.Root{
+			Path:     "rootfs",
+			Readonly: true,
+		},
+		Hostname: "runc",
+		Mounts: []spec.Mount{
+			{
+				Destination: "/proc",
+				Type:        "proc",
+				Source:      "proc",
+			},
+			{
+				Destination: "/dev",
+				Type:        "tmpfs",
+				Source:      "tmpfs",
+				Options:     []string{"nosuid", "strictatime", "mode=755", "size=65536k"},
+			},
+			{
+				Destination: "/dev/pts",
+				Type:        "devpts",
+				Source:      "devpts",
+				Options:     []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", "gid=5"},
+			},
+			{
+				Destination: "/dev/shm",
+				Type:        "tmpfs",
+				Source:      "shm",
+				Options:     []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"},
+			},
+			{
+				Destination: "/dev/mqueue",
+				Type:        "mqueue",
+				Source:      "mqueue",
+				Options:     []string{"nosuid", "noexec", "nodev"},
+			},
+			{
+				Destination: "/sys",
+				Type:        "sysfs",
+				Source:      "sysfs",
+				Options:     []string{"nosuid", "noexec", "nodev", "ro"},
+			},
+			{
+				Destination: "/sys/fs/cgroup",
+				Type:        "cgroup",
+				Source:      "cgroup",
+				Options:     []string{"nosuid", "noexec", "nodev", "relatime", "ro"},
+			},
+		},
+		Linux: &spec.Linux{
+			Resources: &spec.LinuxResources{
+				Devices: []spec.LinuxDeviceCgroup{
+					{
+						Allow:  false,
+						Access: "rwm",
+					},
+				},
+			},
+			Namespaces: []spec.LinuxNamespace{
+				{Type: spec.PIDNamespace},
+				{Type: spec.NetworkNamespace},
+				{Type: spec.IPCNamespace},
+				{Type: spec.UTSNamespace},
+				{Type: spec.MountNamespace},
+			},
+			MaskedPaths: []string{
+				"/proc/kcore",
+				"/proc/latency_stats",
+				"/proc/timer_list",
+				"/proc/timer_stats",
+				"/proc/sched_debug",
+				"/sys/firmware",
+			},
+			ReadonlyPaths: []string{
+				"/proc/asound",
+				"/proc/bus",
+				"/proc/fs",
+				"/proc/irq",
+				"/proc/sys",
+				"/proc/sysrq-trigger",
+			},
+		},
+	}
+
+	adjust(config)
+
+	return config, nil
+}
+
+// LoadSpec returns the config used by the bundles: the content of
+// OCIConfigFile, or of the file specified by the OCI_CONFIG environment
+// variable, if any of them is set, otherwise DefaultSpec(OCIVersion)
+func LoadSpec() (*spec.Spec, error) {
+	path := OCIConfigFile
+	if path == "" {
+		path = os.Getenv(ociConfigEnv)
+	}
+
+	if path == "" {
+		return DefaultSpec(OCIVersion)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config spec.Spec
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("could not parse OCI config %s: %v", path, err)
+	}
+
+	return &config, nil
+}
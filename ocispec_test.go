@@ -0,0 +1,95 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDefaultSpec(t *testing.T) {
+	for version := range ociVersions {
+		config, err := DefaultSpec(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.Version != version {
+			t.Errorf("expected ociVersion %s, got %s", version, config.Version)
+		}
+
+		b := &Bundle{Config: config}
+		if err := b.Validate(); err != nil {
+			t.Errorf("default spec %s is not valid: %v", version, err)
+		}
+
+		content, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// hooks was required before 1.0.0-rc3
+		hasHooks := strings.Contains(string(content), `"hooks":{}`)
+		if hasHooks != (version == DefaultOCIVersion) {
+			t.Errorf("unexpected hooks in the %s config: %s", version, content)
+		}
+	}
+
+	if config, err := DefaultSpec(""); err != nil || config.Version != DefaultOCIVersion {
+		t.Errorf("expected the %s config, got %v", DefaultOCIVersion, err)
+	}
+
+	if _, err := DefaultSpec("0.0.1"); err == nil {
+		t.Error("expected an error with an unsupported version")
+	}
+}
+
+func TestLoadSpecOverride(t *testing.T) {
+	f, err := ioutil.TempFile("", "config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(`{"ociVersion": "1.0.0", "hostname": "override"}`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	os.Setenv(ociConfigEnv, f.Name())
+	defer os.Unsetenv(ociConfigEnv)
+
+	config, err := LoadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Hostname != "override" {
+		t.Errorf("expected the override config, got %+v", config)
+	}
+
+	os.Unsetenv(ociConfigEnv)
+
+	if config, err = LoadSpec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Version != OCIVersion {
+		t.Errorf("expected the default config, got ociVersion %s", config.Version)
+	}
+}
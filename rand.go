@@ -1,4 +1,4 @@
-/// Copyright (c) 2017 Intel Corporation
+// Copyright (c) 2018 Intel Corporation
 //
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -16,21 +16,55 @@ package tests
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
 const letters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
+const lowerLetters = "0123456789abcdefghijklmnopqrstuvwxyz"
+
 const lettersMask = 63
 
-var randSrc = rand.NewSource(time.Now().UnixNano())
+var (
+	randSrc  = rand.NewSource(time.Now().UnixNano())
+	randLock sync.Mutex
+
+	// randSeed is the seed of randSrc, see SeedRandom
+	randSeed int64
+)
 
 // RandID returns a random string
 func RandID(n int) string {
+	return randString(n, letters)
+}
+
+// SeedRandom seeds the generator of RandID and UniqueID, the same seed
+// generates the same IDs
+func SeedRandom(seed int64) {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	randSeed = seed
+	randSrc = rand.NewSource(seed)
+}
+
+// RandomSeed returns the seed given to SeedRandom
+func RandomSeed() int64 {
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	return randSeed
+}
+
+func randString(n int, alphabet string) string {
+	randLock.Lock()
+	defer randLock.Unlock()
+
 	b := make([]byte, n)
 	for i := 0; i < n; {
-		if j := int(randSrc.Int63() & lettersMask); j < len(letters) {
-			b[i] = letters[j]
+		if j := int(randSrc.Int63() & lettersMask); j < len(alphabet) {
+			b[i] = alphabet[j]
 			i++
 		}
 	}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ResourceRegistry owns the resources created by the specs of a node,
+// they are removed by Cleanup
+type ResourceRegistry struct {
+	lock sync.Mutex
+
+	containers       []*Container
+	dockerContainers []string
+	volumes          []string
+	networks         []string
+	images           []string
+}
+
+var resources = &ResourceRegistry{}
+
+// Resources returns the registry of this node
+func Resources() *ResourceRegistry {
+	return resources
+}
+
+// AddContainer registers a runtime container
+func (r *ResourceRegistry) AddContainer(c *Container) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.containers = append(r.containers, c)
+}
+
+// AddDockerContainer registers a docker container
+func (r *ResourceRegistry) AddDockerContainer(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dockerContainers = append(r.dockerContainers, name)
+}
+
+// AddVolume registers a docker volume
+func (r *ResourceRegistry) AddVolume(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.volumes = append(r.volumes, name)
+}
+
+// AddNetwork registers a docker network
+func (r *ResourceRegistry) AddNetwork(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.networks = append(r.networks, name)
+}
+
+// AddImage registers a docker image
+func (r *ResourceRegistry) AddImage(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.images = append(r.images, name)
+}
+
+// Cleanup removes the registered resources that still exist and forgets
+// all of them. The containers are removed first, then the volumes, the
+// networks and the images they used.
+func (r *ResourceRegistry) Cleanup() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var errs []string
+
+	for _, c := range r.containers {
+		if err := c.Teardown(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	for _, name := range r.dockerContainers {
+		if ExistDockerContainer(name) && !RemoveDockerContainer(name) {
+			errs = append(errs, fmt.Sprintf("could not remove docker container %s", name))
+		}
+	}
+
+	removals := []struct {
+		names   []string
+		command []string
+	}{
+		{r.volumes, []string{"volume", "rm", "-f"}},
+		{r.networks, []string{"network", "rm"}},
+		{r.images, []string{"rmi", "-f"}},
+	}
+
+	for _, removal := range removals {
+		for _, name := range removal.names {
+			args := append([]string{}, removal.command[1:]...)
+			args = append(args, name)
+			_, stderr, exitCode := runDockerCommand(removal.command[0], args...)
+			if exitCode != 0 && !isNotFound(stderr) {
+				errs = append(errs, fmt.Sprintf("docker %s %s: %s", strings.Join(removal.command, " "), name, stderr))
+			}
+		}
+	}
+
+	r.containers = nil
+	r.dockerContainers = nil
+	r.volumes = nil
+	r.networks = nil
+	r.images = nil
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to cleanup resources: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// isNotFound returns true if stderr reports a missing docker resource
+func isNotFound(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+
+	return strings.Contains(stderr, "no such") || strings.Contains(stderr, "not found")
+}
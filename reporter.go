@@ -0,0 +1,228 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/reporters"
+	"github.com/onsi/ginkgo/types"
+)
+
+// ReportsDir is the directory where the suites write their JUnit and
+// JSON reports, no report is written if it is empty
+var ReportsDir string
+
+// commandRecords are the commands run by the running spec, they are
+// only recorded while a CommandReporter runs a suite
+var commandRecords struct {
+	sync.Mutex
+	enabled bool
+	records []CommandRecord
+}
+
+// CommandRecord describes a command run by a spec
+type CommandRecord struct {
+	Args     []string  `json:"args"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	ExitCode int       `json:"exit_code"`
+	TimedOut bool      `json:"timed_out"`
+}
+
+// SpecRecord describes a spec and the commands it ran
+type SpecRecord struct {
+	Name     string          `json:"name"`
+	State    string          `json:"state"`
+	Duration float64         `json:"duration"`
+	Failure  string          `json:"failure,omitempty"`
+	Commands []CommandRecord `json:"commands"`
+}
+
+// SuiteRecord is the JSON report of a suite
+type SuiteRecord struct {
+	Suite    string       `json:"suite"`
+	Node     int          `json:"node"`
+	Start    time.Time    `json:"start"`
+	Duration float64      `json:"duration"`
+	Specs    []SpecRecord `json:"specs"`
+}
+
+// recordCommand adds a command run by the running spec
+func recordCommand(args []string, start time.Time, result Result) {
+	commandRecords.Lock()
+	defer commandRecords.Unlock()
+
+	if !commandRecords.enabled {
+		return
+	}
+
+	commandRecords.records = append(commandRecords.records, CommandRecord{
+		Args:     args,
+		Start:    start,
+		Duration: result.Duration.Seconds(),
+		ExitCode: result.ExitCode,
+		TimedOut: result.TimedOut,
+	})
+}
+
+// takeCommandRecords returns the commands recorded so far and forgets them
+func takeCommandRecords() []CommandRecord {
+	commandRecords.Lock()
+	defer commandRecords.Unlock()
+
+	records := commandRecords.records
+	commandRecords.records = nil
+
+	return records
+}
+
+// enableCommandRecords starts or stops the recording of the commands,
+// the commands recorded so far are forgotten
+func enableCommandRecords(enabled bool) {
+	commandRecords.Lock()
+	defer commandRecords.Unlock()
+
+	commandRecords.enabled = enabled
+	commandRecords.records = nil
+}
+
+// SuiteReporters returns the reporters writing the JUnit and JSON reports
+// of the suite in ReportsDir, none if ReportsDir is empty or cannot be
+// created. name is used in the report file names.
+func SuiteReporters(name string) []ginkgo.Reporter {
+	if ReportsDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(ReportsDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "could not create the reports directory: %v\n", err)
+		return nil
+	}
+
+	node := config.GinkgoConfig.ParallelNode
+
+	return []ginkgo.Reporter{
+		reporters.NewJUnitReporter(filepath.Join(ReportsDir, fmt.Sprintf("junit_%s_%d.xml", name, node))),
+		NewCommandReporter(filepath.Join(ReportsDir, fmt.Sprintf("commands_%s_%d.json", name, node))),
+	}
+}
+
+// CommandReporter is a ginkgo reporter that writes a JSON report with the
+// commands run by each spec, their arguments, duration and exit code
+type CommandReporter struct {
+	filename string
+	suite    SuiteRecord
+}
+
+// NewCommandReporter returns a CommandReporter writing its report in filename
+func NewCommandReporter(filename string) *CommandReporter {
+	return &CommandReporter{filename: filename}
+}
+
+// SpecSuiteWillBegin implements ginkgo.Reporter
+func (r *CommandReporter) SpecSuiteWillBegin(config config.GinkgoConfigType, summary *types.SuiteSummary) {
+	r.suite = SuiteRecord{
+		Suite: summary.SuiteDescription,
+		Node:  config.ParallelNode,
+		Start: time.Now(),
+	}
+
+	enableCommandRecords(true)
+}
+
+// BeforeSuiteDidRun implements ginkgo.Reporter, the commands run
+// before the suite are not reported
+func (r *CommandReporter) BeforeSuiteDidRun(setupSummary *types.SetupSummary) {
+	takeCommandRecords()
+}
+
+// SpecWillRun implements ginkgo.Reporter, the commands run between
+// the specs are not reported
+func (r *CommandReporter) SpecWillRun(specSummary *types.SpecSummary) {
+	takeCommandRecords()
+}
+
+// SpecDidComplete implements ginkgo.Reporter
+func (r *CommandReporter) SpecDidComplete(specSummary *types.SpecSummary) {
+	spec := SpecRecord{
+		Name:     strings.Join(specSummary.ComponentTexts[1:], " "),
+		State:    specState(specSummary.State),
+		Duration: specSummary.RunTime.Seconds(),
+		Commands: takeCommandRecords(),
+	}
+
+	if specSummary.HasFailureState() {
+		spec.Failure = specSummary.Failure.Message
+	}
+
+	r.suite.Specs = append(r.suite.Specs, spec)
+}
+
+// AfterSuiteDidRun implements ginkgo.Reporter
+func (r *CommandReporter) AfterSuiteDidRun(setupSummary *types.SetupSummary) {
+}
+
+// SpecSuiteDidEnd implements ginkgo.Reporter
+func (r *CommandReporter) SpecSuiteDidEnd(summary *types.SuiteSummary) {
+	enableCommandRecords(false)
+
+	r.suite.Duration = summary.RunTime.Seconds()
+
+	if err := r.write(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the commands report: %v\n", err)
+	}
+}
+
+func (r *CommandReporter) write() error {
+	content, err := json.MarshalIndent(r.suite, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.filename), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.filename, content, 0644)
+}
+
+func specState(state types.SpecState) string {
+	switch state {
+	case types.SpecStatePassed:
+		return "passed"
+	case types.SpecStateSkipped:
+		return "skipped"
+	case types.SpecStatePending:
+		return "pending"
+	case types.SpecStateFailed:
+		return "failed"
+	case types.SpecStatePanicked:
+		return "panicked"
+	case types.SpecStateTimedOut:
+		return "timed out"
+	}
+
+	return "invalid"
+}
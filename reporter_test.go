@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/config"
+	"github.com/onsi/ginkgo/types"
+)
+
+func TestCommandReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "commands.json")
+	r := NewCommandReporter(filename)
+
+	r.SpecSuiteWillBegin(config.GinkgoConfigType{ParallelNode: 1}, &types.SuiteSummary{SuiteDescription: "Test Suite"})
+
+	spec := &types.SpecSummary{
+		ComponentTexts: []string{"[Top Level]", "container", "should run"},
+		State:          types.SpecStateFailed,
+		RunTime:        2 * time.Second,
+		Failure:        types.SpecFailure{Message: "exit code 1"},
+	}
+
+	NewCommand("true").Run()
+
+	r.SpecWillRun(spec)
+	NewCommand("sh", "-c", "exit 3").Run()
+	r.SpecDidComplete(spec)
+
+	skipped := &types.SpecSummary{
+		ComponentTexts: []string{"[Top Level]", "container", "should be skipped"},
+		State:          types.SpecStateSkipped,
+	}
+
+	r.SpecWillRun(skipped)
+	r.SpecDidComplete(skipped)
+
+	r.SpecSuiteDidEnd(&types.SuiteSummary{RunTime: 3 * time.Second})
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var suite SuiteRecord
+	if err := json.Unmarshal(content, &suite); err != nil {
+		t.Fatal(err)
+	}
+
+	if suite.Suite != "Test Suite" || suite.Node != 1 || suite.Duration != 3 {
+		t.Errorf("unexpected suite %+v", suite)
+	}
+
+	if len(suite.Specs) != 2 {
+		t.Fatalf("expected 2 specs, got %d", len(suite.Specs))
+	}
+
+	if s := suite.Specs[1]; s.State != "skipped" || len(s.Commands) != 0 {
+		t.Errorf("the commands of a spec should not be reported by the next one, got %+v", s)
+	}
+
+	s := suite.Specs[0]
+	if s.Name != "container should run" || s.State != "failed" || s.Failure != "exit code 1" {
+		t.Errorf("unexpected spec %+v", s)
+	}
+
+	if len(s.Commands) != 1 {
+		t.Fatalf("expected 1 command, got %d", len(s.Commands))
+	}
+
+	if c := s.Commands[0]; c.ExitCode != 3 || len(c.Args) != 3 || c.Args[0] != "sh" {
+		t.Errorf("unexpected command %+v", c)
+	}
+}
+
+func TestCommandRecordsWithoutReporter(t *testing.T) {
+	NewCommand("true").Run()
+	if records := takeCommandRecords(); len(records) != 0 {
+		t.Errorf("no command should be recorded without a reporter, got %+v", records)
+	}
+
+	r := NewCommandReporter(filepath.Join(os.TempDir(), "unused.json"))
+	r.SpecSuiteWillBegin(config.GinkgoConfigType{}, &types.SuiteSummary{})
+	enableCommandRecords(false)
+
+	NewCommand("true").Run()
+	if records := takeCommandRecords(); len(records) != 0 {
+		t.Errorf("no command should be recorded after the suite, got %+v", records)
+	}
+}
+
+func TestSuiteReporters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string) {
+		ReportsDir = dir
+	}(ReportsDir)
+
+	ReportsDir = ""
+	if reporters := SuiteReporters("unit"); len(reporters) != 0 {
+		t.Errorf("expected no reporter without a reports directory, got %d", len(reporters))
+	}
+
+	ReportsDir = filepath.Join(dir, "nested", "reports")
+	if reporters := SuiteReporters("unit"); len(reporters) != 2 {
+		t.Errorf("expected the JUnit and command reporters, got %d", len(reporters))
+	}
+
+	if info, err := os.Stat(ReportsDir); err != nil || !info.IsDir() {
+		t.Errorf("the reports directory should be created: %v", err)
+	}
+}
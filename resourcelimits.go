@@ -0,0 +1,436 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupPath = "/sys/fs/cgroup"
+
+// cgroupUnlimited is the lowest value of a cgroup v1 limit meaning
+// no limit, e.g. memory.limit_in_bytes is 9223372036854771712
+const cgroupUnlimited = 1 << 62
+
+// cgroupFile is a cgroup file holding a resource limit
+type cgroupFile struct {
+	controller string
+	name       string
+
+	// v2 is true for the files of the cgroup v2 unified hierarchy
+	v2 bool
+}
+
+// cgroupFiles are the cgroup v1 and v2 files holding the resource limits
+var cgroupFiles = []cgroupFile{
+	{"memory", "memory.limit_in_bytes", false},
+	{"cpu", "cpu.cfs_quota_us", false},
+	{"cpu", "cpu.cfs_period_us", false},
+	{"cpu", "cpu.shares", false},
+	{"pids", "pids.max", false},
+	{"memory", "memory.max", true},
+	{"cpu", "cpu.max", true},
+	{"cpu", "cpu.weight", true},
+	{"pids", "pids.max", true},
+}
+
+// ResourceLimits are the resource limits of a container, 0 means no limit
+type ResourceLimits struct {
+	// Memory is the memory limit in bytes, --memory
+	Memory int64 `json:"memory"`
+
+	// CPUs is the CPU quota divided by the CPU period, --cpus
+	CPUs float64 `json:"cpus"`
+
+	// CPUShares is the relative CPU weight, --cpu-shares
+	CPUShares int64 `json:"cpu_shares"`
+
+	// CPUWeight is the cgroup v2 CPU weight, read instead of CPUShares
+	// from a cgroup v2 hierarchy
+	CPUWeight int64 `json:"cpu_weight,omitempty"`
+
+	// PidsLimit is the maximum number of processes, --pids-limit
+	PidsLimit int64 `json:"pids_limit"`
+}
+
+// GuestResources are the resources visible inside a container
+type GuestResources struct {
+	// MemTotal is the total memory in bytes read from /proc/meminfo
+	MemTotal int64 `json:"mem_total"`
+
+	// Nproc is the number of processing units given by nproc
+	Nproc int `json:"nproc"`
+
+	// Cgroup are the limits read from the cgroup files of the container
+	Cgroup ResourceLimits `json:"cgroup"`
+}
+
+// ResourceLimitDiff is a resource whose value differs from the requested one
+type ResourceLimitDiff struct {
+	// Resource is the docker run option, e.g. --memory
+	Resource string `json:"resource"`
+
+	// Source is where the value was read, e.g. host cgroup
+	Source string `json:"source"`
+
+	// Expected is the requested value, prefixed by >= if a greater
+	// value is also expected
+	Expected string `json:"expected"`
+
+	// Actual is the value read
+	Actual string `json:"actual"`
+}
+
+// ResourceLimitsReport compares the requested resource limits of a
+// container with the ones seen by the host and by the guest
+type ResourceLimitsReport struct {
+	Container string              `json:"container"`
+	Requested ResourceLimits      `json:"requested"`
+	Host      ResourceLimits      `json:"host"`
+	Guest     GuestResources      `json:"guest"`
+	Diffs     []ResourceLimitDiff `json:"diffs"`
+}
+
+// DockerArgs returns the docker run options requesting the limits
+func (l ResourceLimits) DockerArgs() []string {
+	var args []string
+
+	if l.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(l.Memory, 10))
+	}
+
+	if l.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(l.CPUs, 'f', -1, 64))
+	}
+
+	if l.CPUShares > 0 {
+		args = append(args, "--cpu-shares", strconv.FormatInt(l.CPUShares, 10))
+	}
+
+	if l.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(l.PidsLimit, 10))
+	}
+
+	return args
+}
+
+// HostResourceLimits returns the limits of the cgroup of the docker
+// container name on the host, cgroup v1 or v2
+func HostResourceLimits(name string) (*ResourceLimits, error) {
+	c, err := InspectDockerContainer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.State.Pid == 0 {
+		return nil, fmt.Errorf("container %s is not running", name)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(procPath, strconv.Itoa(c.State.Pid), "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, path := range hostCgroupFiles(string(content), cgroupPath) {
+		if value, err := ioutil.ReadFile(path); err == nil {
+			files[filepath.Base(path)] = strings.TrimSpace(string(value))
+		}
+	}
+
+	return parseCgroupLimits(files)
+}
+
+// hostCgroupFiles returns the paths of the cgroup files holding the
+// limits of a process, given its /proc/<pid>/cgroup and the root of
+// the cgroup hierarchies
+func hostCgroupFiles(procCgroup, root string) []string {
+	var v1, v2 []string
+
+	for _, line := range strings.Split(procCgroup, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		controllers, path := parts[1], parts[2]
+
+		if parts[0] == "0" && controllers == "" {
+			for _, f := range cgroupFiles {
+				if f.v2 {
+					v2 = append(v2, filepath.Join(root, path, f.name))
+				}
+			}
+			continue
+		}
+
+		for _, controller := range strings.Split(controllers, ",") {
+			for _, f := range cgroupFiles {
+				if !f.v2 && f.controller == controller {
+					v1 = append(v1, filepath.Join(root, controllers, path, f.name))
+				}
+			}
+		}
+	}
+
+	// on hybrid hosts the controllers are on the v1 hierarchies
+	if len(v1) > 0 {
+		return v1
+	}
+
+	return v2
+}
+
+// parseCgroupLimits returns the limits found in the cgroup files,
+// indexed by file name
+func parseCgroupLimits(files map[string]string) (*ResourceLimits, error) {
+	l := &ResourceLimits{}
+
+	var err error
+	parse := func(name, v string, value *int64) {
+		if v == "" || v == "max" || err != nil {
+			return
+		}
+
+		var i int64
+		if i, err = strconv.ParseInt(v, 10, 64); err != nil {
+			err = fmt.Errorf("invalid %s: %v", name, err)
+			return
+		}
+
+		if i > 0 && i < cgroupUnlimited {
+			*value = i
+		}
+	}
+
+	var quota, period int64
+
+	// cgroup v1
+	parse("memory.limit_in_bytes", files["memory.limit_in_bytes"], &l.Memory)
+	parse("cpu.cfs_quota_us", files["cpu.cfs_quota_us"], &quota)
+	parse("cpu.cfs_period_us", files["cpu.cfs_period_us"], &period)
+	parse("cpu.shares", files["cpu.shares"], &l.CPUShares)
+
+	// cgroup v2, cpu.max is "<quota> <period>"
+	parse("memory.max", files["memory.max"], &l.Memory)
+	parse("cpu.weight", files["cpu.weight"], &l.CPUWeight)
+
+	if fields := strings.Fields(files["cpu.max"]); len(fields) == 2 {
+		parse("cpu.max", fields[0], &quota)
+		parse("cpu.max", fields[1], &period)
+	}
+
+	parse("pids.max", files["pids.max"], &l.PidsLimit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if quota > 0 && period > 0 {
+		l.CPUs = float64(quota) / float64(period)
+	}
+
+	return l, nil
+}
+
+// guestResourcesScript prints the resources visible in a container,
+// one "name value" per line
+var guestResourcesScript = func() string {
+	script := `echo "nproc $(nproc)"; grep MemTotal /proc/meminfo;`
+
+	for _, f := range cgroupFiles {
+		path := filepath.Join(cgroupPath, f.name)
+		if !f.v2 {
+			path = filepath.Join(cgroupPath, f.controller, f.name)
+		}
+
+		script += fmt.Sprintf(` [ -f %s ] && echo "%s $(cat %s)";`, path, f.name, path)
+	}
+
+	return script + " true"
+}()
+
+// ReadGuestResources returns the resources visible inside the running
+// docker container name
+func ReadGuestResources(name string) (*GuestResources, error) {
+	stdout, stderr, exitCode := DockerExec(name, "sh", "-c", guestResourcesScript)
+	if exitCode != 0 {
+		return nil, fmt.Errorf("could not read the resources of container %s: %s", name, stderr)
+	}
+
+	return parseGuestResources(stdout)
+}
+
+// parseGuestResources parses the output of guestResourcesScript
+func parseGuestResources(output string) (*GuestResources, error) {
+	g := &GuestResources{}
+	files := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		name, value := fields[0], strings.TrimSpace(fields[1])
+
+		switch name {
+		case "nproc":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nproc: %v", err)
+			}
+			g.Nproc = n
+		case "MemTotal:":
+			kb, err := strconv.ParseInt(strings.TrimSuffix(value, " kB"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MemTotal: %v", err)
+			}
+			g.MemTotal = kb * 1024
+		default:
+			files[name] = value
+		}
+	}
+
+	l, err := parseCgroupLimits(files)
+	if err != nil {
+		return nil, err
+	}
+	g.Cgroup = *l
+
+	return g, nil
+}
+
+// VerifyResourceLimits compares the requested limits of the running
+// docker container name with the ones seen by the host and the guest
+func VerifyResourceLimits(name string, requested ResourceLimits) (*ResourceLimitsReport, error) {
+	host, err := HostResourceLimits(name)
+	if err != nil {
+		return nil, err
+	}
+
+	guest, err := ReadGuestResources(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ResourceLimitsReport{
+		Container: name,
+		Requested: requested,
+		Host:      *host,
+		Guest:     *guest,
+	}
+	r.compare()
+
+	return r, nil
+}
+
+// compare fills the differences between the requested limits and the
+// host and guest ones. /proc/meminfo and nproc show the resources of the
+// whole VM, or host, so they must only be at least the requested ones.
+func (r *ResourceLimitsReport) compare() {
+	req := r.Requested
+	r.Diffs = nil
+
+	diff := func(resource, source, expected, actual string) {
+		if expected != actual {
+			r.Diffs = append(r.Diffs, ResourceLimitDiff{resource, source, expected, actual})
+		}
+	}
+
+	for _, c := range []struct {
+		source string
+		limits ResourceLimits
+	}{
+		{"host cgroup", r.Host},
+		{"guest cgroup", r.Guest.Cgroup},
+	} {
+		if req.Memory > 0 {
+			diff("--memory", c.source, formatLimit(req.Memory), formatLimit(c.limits.Memory))
+		}
+
+		if req.CPUs > 0 {
+			diff("--cpus", c.source, formatCPUs(req.CPUs), formatCPUs(c.limits.CPUs))
+		}
+
+		if req.CPUShares > 0 {
+			if c.limits.CPUWeight > 0 {
+				diff("--cpu-shares", c.source+" weight", formatLimit(cpuSharesToWeight(req.CPUShares)), formatLimit(c.limits.CPUWeight))
+			} else {
+				diff("--cpu-shares", c.source, formatLimit(req.CPUShares), formatLimit(c.limits.CPUShares))
+			}
+		}
+
+		if req.PidsLimit > 0 {
+			diff("--pids-limit", c.source, formatLimit(req.PidsLimit), formatLimit(c.limits.PidsLimit))
+		}
+	}
+
+	if req.Memory > 0 && r.Guest.MemTotal < req.Memory {
+		diff("--memory", "guest /proc/meminfo", ">= "+formatLimit(req.Memory), formatLimit(r.Guest.MemTotal))
+	}
+
+	if cpus := int(math.Ceil(req.CPUs)); cpus > 0 && r.Guest.Nproc < cpus {
+		diff("--cpus", "guest nproc", ">= "+strconv.Itoa(cpus), strconv.Itoa(r.Guest.Nproc))
+	}
+}
+
+// OK returns true if the host and the guest honour the requested limits
+func (r *ResourceLimitsReport) OK() bool {
+	return len(r.Diffs) == 0
+}
+
+// String returns the differences of the report, one per line
+func (r *ResourceLimitsReport) String() string {
+	if r.OK() {
+		return fmt.Sprintf("container %s honours the requested resource limits", r.Container)
+	}
+
+	lines := []string{fmt.Sprintf("container %s does not honour the requested resource limits:", r.Container)}
+	for _, d := range r.Diffs {
+		lines = append(lines, fmt.Sprintf("  %s: %s expected %s, got %s", d.Resource, d.Source, d.Expected, d.Actual))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// cpuSharesToWeight converts cgroup v1 CPU shares to the cgroup v2 CPU
+// weight, the same way runc does
+func cpuSharesToWeight(shares int64) int64 {
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func formatLimit(v int64) string {
+	if v == 0 {
+		return "max"
+	}
+
+	return strconv.FormatInt(v, 10)
+}
+
+func formatCPUs(cpus float64) string {
+	if cpus == 0 {
+		return "max"
+	}
+
+	return strconv.FormatFloat(cpus, 'f', 3, 64)
+}
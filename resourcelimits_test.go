@@ -0,0 +1,159 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostCgroupLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, c := range []struct {
+		procCgroup string
+		files      map[string]string
+		expected   ResourceLimits
+	}{
+		{
+			procCgroup: "12:pids:/docker/foo\n4:cpu,cpuacct:/docker/foo\n3:memory:/docker/foo\n1:name=systemd:/docker/foo\n0::/system.slice/docker.service\n",
+			files: map[string]string{
+				"memory/docker/foo/memory.limit_in_bytes":  "268435456\n",
+				"cpu,cpuacct/docker/foo/cpu.cfs_quota_us":  "150000\n",
+				"cpu,cpuacct/docker/foo/cpu.cfs_period_us": "100000\n",
+				"cpu,cpuacct/docker/foo/cpu.shares":        "512\n",
+				"pids/docker/foo/pids.max":                 "max\n",
+			},
+			expected: ResourceLimits{Memory: 268435456, CPUs: 1.5, CPUShares: 512},
+		},
+		{
+			procCgroup: "0::/system.slice/docker-bar.scope\n",
+			files: map[string]string{
+				"system.slice/docker-bar.scope/memory.max": "max\n",
+				"system.slice/docker-bar.scope/cpu.max":    "max 100000\n",
+				"system.slice/docker-bar.scope/cpu.weight": "20\n",
+				"system.slice/docker-bar.scope/pids.max":   "100\n",
+			},
+			expected: ResourceLimits{CPUWeight: 20, PidsLimit: 100},
+		},
+	} {
+		for path, content := range c.files {
+			path = filepath.Join(root, path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		files := make(map[string]string)
+		for _, path := range hostCgroupFiles(c.procCgroup, root) {
+			if content, err := ioutil.ReadFile(path); err == nil {
+				files[filepath.Base(path)] = strings.TrimSpace(string(content))
+			}
+		}
+
+		l, err := parseCgroupLimits(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(*l, c.expected) {
+			t.Errorf("expected limits %+v, got %+v", c.expected, *l)
+		}
+	}
+}
+
+func TestParseGuestResources(t *testing.T) {
+	output := `nproc 2
+MemTotal:        2045448 kB
+memory.limit_in_bytes 9223372036854771712
+cpu.cfs_quota_us -1
+cpu.cfs_period_us 100000
+cpu.shares 1024
+pids.max 50
+`
+	g, err := parseGuestResources(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := GuestResources{
+		MemTotal: 2045448 * 1024,
+		Nproc:    2,
+		Cgroup:   ResourceLimits{CPUShares: 1024, PidsLimit: 50},
+	}
+
+	if !reflect.DeepEqual(*g, expected) {
+		t.Errorf("expected guest resources %+v, got %+v", expected, *g)
+	}
+
+	if _, err := parseGuestResources("nproc two\n"); err == nil {
+		t.Error("an invalid nproc should not be parsed")
+	}
+}
+
+func TestResourceLimitsReport(t *testing.T) {
+	requested := ResourceLimits{Memory: 512 << 20, CPUs: 1.5, CPUShares: 512, PidsLimit: 100}
+
+	if args := requested.DockerArgs(); !reflect.DeepEqual(args, []string{
+		"--memory", "536870912", "--cpus", "1.5", "--cpu-shares", "512", "--pids-limit", "100",
+	}) {
+		t.Errorf("unexpected docker args %v", args)
+	}
+
+	r := &ResourceLimitsReport{
+		Container: "foo",
+		Requested: requested,
+		Host:      ResourceLimits{Memory: 512 << 20, CPUs: 1.5, CPUWeight: cpuSharesToWeight(512), PidsLimit: 100},
+		Guest: GuestResources{
+			MemTotal: 2 << 30,
+			Nproc:    2,
+			Cgroup:   requested,
+		},
+	}
+
+	r.compare()
+	if !r.OK() {
+		t.Fatalf("unexpected differences: %s", r)
+	}
+
+	r.Host.PidsLimit = 0
+	r.Guest.Nproc = 1
+	r.compare()
+
+	expected := []ResourceLimitDiff{
+		{"--pids-limit", "host cgroup", "100", "max"},
+		{"--cpus", "guest nproc", ">= 2", "1"},
+	}
+
+	if !reflect.DeepEqual(r.Diffs, expected) {
+		t.Errorf("expected differences %+v, got %+v", expected, r.Diffs)
+	}
+
+	if s := r.String(); !strings.Contains(s, "--pids-limit: host cgroup expected 100, got max") {
+		t.Errorf("unexpected report %s", s)
+	}
+}
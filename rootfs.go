@@ -0,0 +1,798 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// whiteoutPrefix marks a file removed by a layer
+	whiteoutPrefix = ".wh."
+
+	// whiteoutOpaque marks a directory whose lower layers content is hidden
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// ociRefNameAnnotation is the annotation holding the reference of an
+	// image in an OCI image layout index
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+	// ociImageIndexMediaType is the media type of a nested OCI image index
+	ociImageIndexMediaType = "application/vnd.oci.image.index.v1+json"
+)
+
+// RootfsPath is the path of the rootfs used by the bundles, it can be a
+// tarball, an OCI image layout or a directory. If empty the rootfs is
+// exported from a docker container.
+var RootfsPath string
+
+// RootfsSource provides the root filesystem of a bundle
+type RootfsSource interface {
+	// Extract writes the root filesystem into the existing directory dir
+	Extract(dir string) error
+}
+
+// TarballRootfs is a rootfs read from a local tarball, optionally gzipped
+type TarballRootfs struct {
+	// Path of the tarball
+	Path string
+}
+
+// OCILayoutRootfs is a rootfs unpacked from the layers of an image
+// stored in an OCI image layout directory
+type OCILayoutRootfs struct {
+	// Path of the OCI image layout directory
+	Path string
+
+	// Ref is the reference name of the image in the layout index,
+	// if empty the first image is used
+	Ref string
+}
+
+// DirRootfs is a rootfs copied from an existing directory
+type DirRootfs struct {
+	// Path of the directory
+	Path string
+}
+
+// DockerRootfs is a rootfs exported from a docker container
+type DockerRootfs struct {
+	// Image used to create the container
+	Image string
+}
+
+// DefaultRootfs returns the rootfs source specified by RootfsPath,
+// a container of the busybox Image if RootfsPath is empty
+func DefaultRootfs() (RootfsSource, error) {
+	if RootfsPath == "" {
+		return DockerRootfs{Image: Image}, nil
+	}
+
+	return RootfsFromPath(RootfsPath)
+}
+
+// RootfsFromPath returns a rootfs source for path: an OCI image layout
+// if path is a directory that contains an 'oci-layout' file, a directory
+// if it is any other directory or a tarball if it is a file
+func RootfsFromPath(path string) (RootfsSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return TarballRootfs{Path: path}, nil
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "oci-layout")); err == nil {
+		return OCILayoutRootfs{Path: path}, nil
+	}
+
+	return DirRootfs{Path: path}, nil
+}
+
+// Extract extracts the tarball into dir
+func (t TarballRootfs) Extract(dir string) error {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return extractLayer(f, dir)
+}
+
+// Extract unpacks the image layers into dir, in order, applying
+// the whiteouts of each layer
+func (o OCILayoutRootfs) Extract(dir string) error {
+	manifest, err := o.manifest()
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range manifest.Layers {
+		if err := o.extractLayer(layer, dir); err != nil {
+			return fmt.Errorf("could not extract layer %s: %v", layer.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+// ociDescriptor describes a blob of an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex is an OCI image index
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// manifestDescriptor returns the descriptor of the manifest of the image
+func (o OCILayoutRootfs) manifestDescriptor() (ociDescriptor, error) {
+	content, err := ioutil.ReadFile(filepath.Join(o.Path, "index.json"))
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	for {
+		var index ociIndex
+		if err := json.Unmarshal(content, &index); err != nil {
+			return ociDescriptor{}, err
+		}
+
+		desc, err := o.selectManifest(index)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+
+		if desc.MediaType != ociImageIndexMediaType {
+			return desc, nil
+		}
+
+		// nested index
+		if content, err = o.readBlob(desc); err != nil {
+			return ociDescriptor{}, err
+		}
+	}
+}
+
+func (o OCILayoutRootfs) selectManifest(index ociIndex) (ociDescriptor, error) {
+	if len(index.Manifests) == 0 {
+		return ociDescriptor{}, fmt.Errorf("no manifests in OCI image layout %s", o.Path)
+	}
+
+	if o.Ref == "" {
+		return index.Manifests[0], nil
+	}
+
+	for _, m := range index.Manifests {
+		if m.Annotations[ociRefNameAnnotation] == o.Ref {
+			return m, nil
+		}
+	}
+
+	return ociDescriptor{}, fmt.Errorf("image %s not found in OCI image layout %s", o.Ref, o.Path)
+}
+
+func (o OCILayoutRootfs) manifest() (*ociManifest, error) {
+	desc, err := o.manifestDescriptor()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := o.readBlob(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+func (o OCILayoutRootfs) blobPath(digest string) (string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(digest, "/\\") {
+		return "", fmt.Errorf("invalid digest '%s'", digest)
+	}
+
+	return filepath.Join(o.Path, "blobs", parts[0], parts[1]), nil
+}
+
+// openBlob opens a blob, the digest of its content is verified
+// when the whole blob has been read
+func (o OCILayoutRootfs) openBlob(desc ociDescriptor) (io.ReadCloser, error) {
+	path, err := o.blobPath(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(desc.Digest, "sha256:") {
+		return f, nil
+	}
+
+	return &digestReader{
+		f:      f,
+		h:      sha256.New(),
+		digest: desc.Digest,
+	}, nil
+}
+
+func (o OCILayoutRootfs) readBlob(desc ociDescriptor) ([]byte, error) {
+	r, err := o.openBlob(desc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (o OCILayoutRootfs) extractLayer(desc ociDescriptor, dir string) error {
+	r, err := o.openBlob(desc)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := extractLayer(r, dir); err != nil {
+		return err
+	}
+
+	// consume any trailing data so the digest can be verified
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// digestReader verifies the sha256 digest of a file once it reaches EOF
+type digestReader struct {
+	f      *os.File
+	h      hash.Hash
+	digest string
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.f.Read(p)
+	d.h.Write(p[:n])
+
+	if err == io.EOF {
+		if got := "sha256:" + hex.EncodeToString(d.h.Sum(nil)); got != d.digest {
+			return n, fmt.Errorf("digest mismatch, expected %s got %s", d.digest, got)
+		}
+	}
+
+	return n, err
+}
+
+func (d *digestReader) Close() error {
+	return d.f.Close()
+}
+
+// Extract copies the directory into dir
+func (d DirRootfs) Extract(dir string) error {
+	return copyTree(d.Path, dir)
+}
+
+// Extract creates a docker container, exports and extracts its
+// filesystem into dir and removes the container
+func (d DockerRootfs) Extract(dir string) error {
+	// create container
+	stdout, stderr, exitCode := NewCommand(Docker, "create", d.Image).Run()
+	if exitCode != 0 {
+		return fmt.Errorf("could not create a container of image %s: %s", d.Image, stderr)
+	}
+	containerName := strings.TrimSpace(stdout)
+
+	// remove container
+	defer func() {
+		if _, stderr, exitCode := NewCommand(Docker, "rm", "-f", containerName).Run(); exitCode != 0 {
+			LogIfFail("could not remove container %s: %s\n", containerName, stderr)
+		}
+	}()
+
+	// export the container to a file, the output of a command is kept
+	// in memory, and extract it
+	f, err := ioutil.TempFile("", "rootfs-export")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if _, stderr, exitCode := NewCommand(Docker, "export", "-o", f.Name(), containerName).Run(); exitCode != 0 {
+		return fmt.Errorf("could not export container %s: %s", containerName, stderr)
+	}
+
+	return TarballRootfs{Path: f.Name()}.Extract(dir)
+}
+
+// extractLayer extracts a tar stream, optionally gzipped, into dir
+// applying the OCI whiteouts it contains
+func extractLayer(r io.Reader, dir string) error {
+	br := bufio.NewReader(r)
+
+	// gzip magic number
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		return extractTar(gz, dir)
+	}
+
+	return extractTar(br, dir)
+}
+
+// maxSymlinks is the maximum number of symlinks followed resolving a path
+const maxSymlinks = 255
+
+// resolveInRoot returns the path of name in root, following the symlinks
+// of its parent directories as if root was the root directory, so that
+// the path never leaves root. The last component of name is not followed.
+func resolveInRoot(root, name string) (string, error) {
+	name = filepath.Clean("/" + name)
+	if name == "/" {
+		return root, nil
+	}
+
+	parents := strings.Split(strings.TrimPrefix(filepath.Dir(name), "/"), "/")
+	resolved := "/"
+	links := 0
+
+	for len(parents) > 0 {
+		p := parents[0]
+		parents = parents[1:]
+
+		if p == "" || p == "." {
+			continue
+		}
+
+		next := filepath.Join(resolved, p)
+
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+
+			// created later by MkdirAll
+			resolved = next
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", name)
+		}
+
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+
+		parents = append(strings.Split(target, "/"), parents...)
+	}
+
+	path := filepath.Join(root, resolved, filepath.Base(name))
+	if path != root && !strings.HasPrefix(path, filepath.Clean(root)+"/") {
+		return "", fmt.Errorf("%s resolves outside of %s", name, root)
+	}
+
+	return path, nil
+}
+
+// extractTar extracts a tar stream into dir. Whiteout files remove the
+// content of previous layers, opaque whiteouts only remove the content
+// that was not added by this layer. The paths are resolved inside dir,
+// the symlinks of the archive never make an entry escape it. The modes
+// and times of the directories are set once their content is extracted.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+
+	// paths added by this layer
+	added := make(map[string]bool)
+
+	// directories with an opaque whiteout
+	var opaque []string
+
+	// directories extracted, whose attributes are set last
+	var dirs []*tar.Header
+	var dirPaths []string
+
+	isRoot := os.Geteuid() == 0
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		base := filepath.Base(name)
+
+		if base == whiteoutOpaque {
+			parent, err := resolveInRoot(dir, filepath.Dir(name))
+			if err != nil {
+				return err
+			}
+
+			opaque = append(opaque, parent)
+			continue
+		}
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			target, err := resolveInRoot(dir, filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)))
+			if err != nil {
+				return err
+			}
+
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path, err := resolveInRoot(dir, name)
+		if err != nil {
+			return err
+		}
+		parent := filepath.Dir(path)
+
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+
+		if err := extractEntry(tr, hdr, dir, path, isRoot); err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+
+		added[path] = true
+
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+			dirPaths = append(dirPaths, path)
+		}
+	}
+
+	for _, d := range opaque {
+		if err := removeOpaque(d, added); err != nil {
+			return err
+		}
+	}
+
+	// the children are extracted, a read-only directory can be set
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Lstat(dirPaths[i])
+		if err != nil || !info.IsDir() {
+			// replaced or removed by a later entry
+			continue
+		}
+
+		if err := setAttributes(dirPaths[i], dirs[i]); err != nil {
+			return fmt.Errorf("%s: %v", dirs[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// extractEntry creates path from the tar entry hdr
+func extractEntry(tr *tar.Reader, hdr *tar.Header, root, path string, isRoot bool) error {
+	mode := hdr.FileInfo().Mode()
+
+	// replace any existing entry but directories, whose content
+	// is merged
+	if info, err := os.Lstat(path); err == nil {
+		if !(info.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, path); err != nil {
+			return err
+		}
+
+	case tar.TypeLink:
+		target, err := resolveInRoot(root, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Link(target, path); err != nil {
+			return err
+		}
+
+		// a hard link shares the attributes of its target
+		return nil
+
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		devMode := uint32(unix.S_IFIFO)
+		switch hdr.Typeflag {
+		case tar.TypeChar:
+			devMode = unix.S_IFCHR
+		case tar.TypeBlock:
+			devMode = unix.S_IFBLK
+		}
+
+		dev := int(mkdev(hdr.Devmajor, hdr.Devminor))
+		if err := unix.Mknod(path, devMode|uint32(mode.Perm()), dev); err != nil {
+			if !isRoot {
+				// only root can create device nodes
+				LogIfFail("skipping device %s: %v\n", path, err)
+				return nil
+			}
+			return err
+		}
+
+	default:
+		LogIfFail("skipping %s, unsupported tar entry type %c\n", path, hdr.Typeflag)
+		return nil
+	}
+
+	if isRoot {
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+
+	// the attributes of the directories are set by extractTar
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeDir {
+		return nil
+	}
+
+	return setAttributes(path, hdr)
+}
+
+// setAttributes sets the mode and the times of path from hdr
+func setAttributes(path string, hdr *tar.Header) error {
+	mode := hdr.FileInfo().Mode()
+
+	if err := os.Chmod(path, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
+
+// mkdev returns the Linux device number of major and minor
+func mkdev(major, minor int64) uint64 {
+	ma := uint64(major)
+	mi := uint64(minor)
+
+	return (mi & 0xff) | ((ma & 0xfff) << 8) | ((mi &^ 0xff) << 12) | ((ma &^ 0xfff) << 32)
+}
+
+// removeOpaque removes the content of dir that was not added by the
+// current layer
+func removeOpaque(dir string, added map[string]bool) error {
+	// never follow a symlink out of the rootfs
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+
+		if !added[path] {
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if e.IsDir() {
+			if err := removeOpaque(path, added); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyTree copies the content of src into the existing directory dst
+// preserving permissions, symbolic links, device nodes and, when running
+// as root, ownership. The modes of the directories are set once their
+// content is copied.
+func copyTree(src, dst string) error {
+	isRoot := os.Geteuid() == 0
+
+	// directories copied, whose modes are set last
+	var dirs []string
+	var dirModes []os.FileMode
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		mode := info.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+		case mode.IsRegular():
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+
+		default:
+			stat, ok := info.Sys().(*unix.Stat_t)
+			if !ok {
+				return fmt.Errorf("unsupported file %s", path)
+			}
+			if err := unix.Mknod(target, stat.Mode, int(stat.Rdev)); err != nil {
+				if !isRoot {
+					LogIfFail("skipping device %s: %v\n", path, err)
+					return nil
+				}
+				return err
+			}
+		}
+
+		if isRoot {
+			if stat, ok := info.Sys().(*unix.Stat_t); ok {
+				if err := os.Lchown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if mode&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		if mode.IsDir() {
+			dirs = append(dirs, target)
+			dirModes = append(dirModes, mode)
+			return nil
+		}
+
+		return os.Chmod(target, mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	})
+	if err != nil {
+		return err
+	}
+
+	// the children are copied, a read-only directory can be set
+	for i := len(dirs) - 1; i >= 0; i-- {
+		mode := dirModes[i]
+		if err := os.Chmod(dirs[i], mode.Perm()|mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,488 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is a file, directory (Name ends with "/"), symlink (Link is
+// not empty) or hard link (Hardlink is not empty) of a test tarball
+type tarEntry struct {
+	Name     string
+	Body     string
+	Link     string
+	Hardlink string
+
+	// Mode is 0644 for files and 0755 for directories if 0
+	Mode int64
+}
+
+func newTar(t *testing.T, gzipped bool, entries ...tarEntry) []byte {
+	var b bytes.Buffer
+	var gz *gzip.Writer
+
+	w := tar.NewWriter(&b)
+	if gzipped {
+		gz = gzip.NewWriter(&b)
+		w = tar.NewWriter(gz)
+	}
+
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.Body))}
+
+		switch {
+		case e.Link != "":
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.Link
+			hdr.Size = 0
+		case e.Hardlink != "":
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = e.Hardlink
+			hdr.Size = 0
+		case e.Name[len(e.Name)-1] == '/':
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0755
+			hdr.Size = 0
+		}
+
+		if e.Mode != 0 {
+			hdr.Mode = e.Mode
+		}
+
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := w.Write([]byte(e.Body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// writeBlob writes content in the OCI image layout dir returning its descriptor
+func writeBlob(t *testing.T, dir string, content []byte) ociDescriptor {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(blobs, digest), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return ociDescriptor{Digest: "sha256:" + digest, Size: int64(len(content))}
+}
+
+func newOCILayout(t *testing.T, ref string, layers ...[]byte) string {
+	dir, err := ioutil.TempDir("", "oci-layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := ociManifest{Config: writeBlob(t, dir, []byte("{}"))}
+	for _, l := range layers {
+		manifest.Layers = append(manifest.Layers, writeBlob(t, dir, l))
+	}
+
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := writeBlob(t, dir, content)
+	desc.Annotations = map[string]string{ociRefNameAnnotation: ref}
+
+	content, err = json.Marshal(ociIndex{Manifests: []ociDescriptor{desc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func assertContent(t *testing.T, path, expected string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("could not read %s: %v", path, err)
+		return
+	}
+
+	if string(content) != expected {
+		t.Errorf("expected %s to contain %q, got %q", path, expected, content)
+	}
+}
+
+func assertNotExist(t *testing.T, path string) {
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to not exist: %v", path, err)
+	}
+}
+
+func TestTarballRootfs(t *testing.T) {
+	for _, gzipped := range []bool{false, true} {
+		f, err := ioutil.TempFile("", "rootfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		content := newTar(t, gzipped,
+			tarEntry{Name: "bin/"},
+			tarEntry{Name: "bin/busybox", Body: "busybox"},
+			tarEntry{Name: "bin/sh", Link: "busybox"},
+			tarEntry{Name: "../escape", Body: "contained"},
+		)
+		if _, err := f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		dir, err := ioutil.TempDir("", "rootfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := (TarballRootfs{Path: f.Name()}).Extract(dir); err != nil {
+			t.Fatalf("gzipped=%t: %v", gzipped, err)
+		}
+
+		assertContent(t, filepath.Join(dir, "bin", "busybox"), "busybox")
+		assertContent(t, filepath.Join(dir, "bin", "sh"), "busybox")
+		assertContent(t, filepath.Join(dir, "escape"), "contained")
+	}
+}
+
+func TestOCILayoutRootfs(t *testing.T) {
+	lower := newTar(t, false,
+		tarEntry{Name: "etc/"},
+		tarEntry{Name: "etc/hostname", Body: "lower"},
+		tarEntry{Name: "etc/passwd", Body: "root"},
+		tarEntry{Name: "var/"},
+		tarEntry{Name: "var/cache/"},
+		tarEntry{Name: "var/cache/old", Body: "old"},
+	)
+
+	upper := newTar(t, true,
+		tarEntry{Name: "etc/hostname", Body: "upper"},
+		tarEntry{Name: "etc/.wh.passwd"},
+		tarEntry{Name: "var/cache/new", Body: "new"},
+		tarEntry{Name: "var/cache/.wh..wh..opq"},
+	)
+
+	layout := newOCILayout(t, "latest", lower, upper)
+	defer os.RemoveAll(layout)
+
+	source, err := RootfsFromPath(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := source.(OCILayoutRootfs); !ok {
+		t.Fatalf("expected an OCI image layout source, got %T", source)
+	}
+
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := (OCILayoutRootfs{Path: layout, Ref: "latest"}).Extract(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(dir, "etc", "hostname"), "upper")
+	assertNotExist(t, filepath.Join(dir, "etc", "passwd"))
+	assertContent(t, filepath.Join(dir, "var", "cache", "new"), "new")
+	assertNotExist(t, filepath.Join(dir, "var", "cache", "old"))
+
+	if err := (OCILayoutRootfs{Path: layout, Ref: "unknown"}).Extract(dir); err == nil {
+		t.Error("expected an error extracting an unknown image")
+	}
+}
+
+func TestOCILayoutRootfsDigestMismatch(t *testing.T) {
+	layer := newTar(t, false, tarEntry{Name: "file", Body: "content"})
+
+	layout := newOCILayout(t, "", layer)
+	defer os.RemoveAll(layout)
+
+	sum := sha256.Sum256(layer)
+	path := filepath.Join(layout, "blobs", "sha256", hex.EncodeToString(sum[:]))
+	corrupted := newTar(t, false, tarEntry{Name: "file", Body: "corrupted"})
+	if err := ioutil.WriteFile(path, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := (OCILayoutRootfs{Path: layout}).Extract(dir); err == nil {
+		t.Error("expected a digest mismatch error")
+	}
+}
+
+func TestDirRootfs(t *testing.T) {
+	src, err := ioutil.TempDir("", "rootfs-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "bin", "busybox"), []byte("busybox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("busybox", filepath.Join(src, "bin", "sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := (DirRootfs{Path: src}).Extract(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(dir, "bin", "sh"), "busybox")
+
+	info, err := os.Stat(filepath.Join(dir, "bin", "busybox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755, got %v", info.Mode())
+	}
+}
+
+func TestDirRootfsReadOnlyDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "rootfs-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Chmod(filepath.Join(src, "ro"), 0755)
+		os.RemoveAll(src)
+	}()
+
+	if err := os.MkdirAll(filepath.Join(src, "ro"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "ro", "file"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(filepath.Join(src, "ro"), 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Chmod(filepath.Join(dir, "ro"), 0755)
+		os.RemoveAll(dir)
+	}()
+
+	if err := (DirRootfs{Path: src}).Extract(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(dir, "ro", "file"), "foo")
+
+	info, err := os.Stat(filepath.Join(dir, "ro"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0555 {
+		t.Errorf("expected mode 0555, got %v", info.Mode().Perm())
+	}
+}
+
+func TestExtractTarSymlinkEscape(t *testing.T) {
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	if err := ioutil.WriteFile(filepath.Join(outside, "victim"), []byte("host"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layer := newTar(t, false,
+		tarEntry{Name: "abs", Link: outside},
+		tarEntry{Name: "rel", Link: "../../../../../../../.." + outside},
+		tarEntry{Name: "abs/.wh.victim"},
+		tarEntry{Name: "rel/victim", Body: "overwritten"},
+		tarEntry{Name: "abs/new", Body: "new"},
+		tarEntry{Name: "abs/sub/.wh..wh..opq"},
+		tarEntry{Name: "opq", Link: outside},
+		tarEntry{Name: "opq/.wh..wh..opq"},
+	)
+
+	if err := extractLayer(bytes.NewReader(layer), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(outside, "victim"), "host")
+	assertNotExist(t, filepath.Join(outside, "new"))
+
+	// the symlinks are followed inside the rootfs
+	assertContent(t, filepath.Join(dir, outside, "victim"), "overwritten")
+	assertContent(t, filepath.Join(dir, outside, "new"), "new")
+
+	layer = newTar(t, false,
+		tarEntry{Name: "abs", Link: outside},
+		tarEntry{Name: "link", Hardlink: "abs/victim"},
+	)
+
+	dir2, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir2)
+
+	if err := extractLayer(bytes.NewReader(layer), dir2); err == nil {
+		t.Error("a hard link to a file outside of the rootfs should not be extracted")
+	}
+}
+
+func TestExtractTarReadOnlyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Chmod(filepath.Join(dir, "ro"), 0755)
+		os.RemoveAll(dir)
+	}()
+
+	layer := newTar(t, false,
+		tarEntry{Name: "ro/", Mode: 0555},
+		tarEntry{Name: "ro/file", Body: "foo"},
+		tarEntry{Name: "ro/sub/", Mode: 0500},
+		tarEntry{Name: "ro/sub/file", Body: "bar"},
+	)
+
+	if err := extractLayer(bytes.NewReader(layer), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(dir, "ro", "file"), "foo")
+	assertContent(t, filepath.Join(dir, "ro", "sub", "file"), "bar")
+
+	for path, mode := range map[string]os.FileMode{"ro": 0555, "ro/sub": 0500} {
+		info, err := os.Stat(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != mode {
+			t.Errorf("expected %s to have mode %v, got %v", path, mode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for link, target := range map[string]string{"etc": "/real", "up": "../..", "loop": "loop"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]string{
+		"etc/passwd":       "real/passwd",
+		"up/etc/passwd":    "real/passwd",
+		"../../etc":        "etc",
+		"etc":              "etc",
+		"usr/bin/../lib/a": "usr/lib/a",
+	} {
+		path, err := resolveInRoot(root, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path != filepath.Join(root, expected) {
+			t.Errorf("expected %s to resolve to %s, got %s", name, filepath.Join(root, expected), path)
+		}
+	}
+
+	if _, err := resolveInRoot(root, "loop/foo"); err == nil {
+		t.Error("a symlink loop should not be resolved")
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// UseRootfsCache enables the rootfs cache used by NewBundle
+var UseRootfsCache bool
+
+var (
+	defaultRootfsCache     *RootfsCache
+	defaultRootfsCacheLock sync.Mutex
+)
+
+// digestedRootfs is implemented by the rootfs sources whose content is
+// identified by a digest, only these sources can be cached
+type digestedRootfs interface {
+	// Digest returns the digest of the rootfs content
+	Digest() (string, error)
+}
+
+// RootfsCache extracts each rootfs once per digest and gives every
+// bundle a copy-on-write view of it. An overlay filesystem is used for
+// the views when it can be mounted, otherwise the views are full copies
+// of the cached rootfs.
+type RootfsCache struct {
+	// Dir contains the extracted rootfs and the overlay upper directories
+	Dir string
+
+	lock    sync.Mutex
+	entries map[string]*rootfsCacheEntry
+	views   map[string]*rootfsView
+}
+
+// rootfsCacheEntry is an extracted rootfs
+type rootfsCacheEntry struct {
+	// path of the extracted rootfs
+	path string
+
+	// refs is the number of views of the rootfs
+	refs int
+}
+
+// rootfsView is the view of a cached rootfs given to a bundle
+type rootfsView struct {
+	digest string
+
+	// overlayDir contains the upper and work directories of the
+	// overlay, empty if the view is a copy
+	overlayDir string
+}
+
+// NewRootfsCache returns a new RootfsCache that keeps its content in dir
+func NewRootfsCache(dir string) (*RootfsCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &RootfsCache{
+		Dir:     dir,
+		entries: make(map[string]*rootfsCacheEntry),
+		views:   make(map[string]*rootfsView),
+	}, nil
+}
+
+// DefaultRootfsCache returns the cache used by NewBundle, it is created
+// in a temporary directory the first time it is requested
+func DefaultRootfsCache() (*RootfsCache, error) {
+	defaultRootfsCacheLock.Lock()
+	defer defaultRootfsCacheLock.Unlock()
+
+	if defaultRootfsCache != nil {
+		return defaultRootfsCache, nil
+	}
+
+	dir, err := ioutil.TempDir(TempRoot(), "rootfs-cache")
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultRootfsCache, err = NewRootfsCache(dir); err != nil {
+		return nil, err
+	}
+
+	return defaultRootfsCache, nil
+}
+
+// currentRootfsCache returns the default cache, nil if it was not
+// created or was cleaned up
+func currentRootfsCache() *RootfsCache {
+	defaultRootfsCacheLock.Lock()
+	defer defaultRootfsCacheLock.Unlock()
+
+	return defaultRootfsCache
+}
+
+// CleanupRootfsCache releases the views of the default rootfs cache and
+// removes its content. It should be called once the test suite finishes.
+func CleanupRootfsCache() error {
+	defaultRootfsCacheLock.Lock()
+	defer defaultRootfsCacheLock.Unlock()
+
+	if defaultRootfsCache == nil {
+		return nil
+	}
+
+	err := defaultRootfsCache.Cleanup()
+	defaultRootfsCache = nil
+
+	return err
+}
+
+// View creates in the existing directory dir a copy-on-write view of the
+// rootfs provided by source, which is extracted if it is not cached yet.
+// Sources without a digest are extracted directly into dir.
+func (c *RootfsCache) View(source RootfsSource, dir string) error {
+	d, ok := source.(digestedRootfs)
+	if !ok {
+		return source.Extract(dir)
+	}
+
+	digest, err := d.Digest()
+	if err != nil {
+		LogIfFail("not caching rootfs, could not get its digest: %v\n", err)
+		return source.Extract(dir)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, err := c.entry(digest, source)
+	if err != nil {
+		return err
+	}
+
+	view := &rootfsView{digest: digest}
+
+	if view.overlayDir, err = c.mountOverlay(entry.path, dir); err != nil {
+		LogIfFail("could not mount overlay, copying the rootfs: %v\n", err)
+
+		// hard links would let the container modify the cache
+		if err := copyTree(entry.path, dir); err != nil {
+			return err
+		}
+	}
+
+	entry.refs++
+	c.views[dir] = view
+
+	return nil
+}
+
+// Release releases the view in dir, it is a no-op if dir is not a view
+// of this cache. The content of dir is not removed.
+func (c *RootfsCache) Release(dir string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.release(dir)
+}
+
+// Prune removes the cached rootfs that have no views
+func (c *RootfsCache) Prune() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.prune()
+}
+
+// Cleanup releases all the views, reporting them as leaked, and removes
+// the cache content
+func (c *RootfsCache) Cleanup() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var errs []string
+
+	for dir := range c.views {
+		LogIfFail("releasing leaked rootfs view %s\n", dir)
+		if err := c.release(dir); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := c.prune(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if err := os.RemoveAll(c.Dir); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to cleanup rootfs cache: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// entry returns the cache entry of digest, extracting source if needed
+func (c *RootfsCache) entry(digest string, source RootfsSource) (*rootfsCacheEntry, error) {
+	if entry, ok := c.entries[digest]; ok {
+		return entry, nil
+	}
+
+	path := filepath.Join(c.Dir, "rootfs", strings.Replace(digest, ":", "-", -1))
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := source.Extract(path); err != nil {
+		os.RemoveAll(path)
+		return nil, err
+	}
+
+	entry := &rootfsCacheEntry{path: path}
+	c.entries[digest] = entry
+
+	return entry, nil
+}
+
+// mountOverlay mounts an overlay of lower in dir and returns the
+// directory with its upper and work directories
+func (c *RootfsCache) mountOverlay(lower, dir string) (string, error) {
+	if os.Geteuid() != 0 {
+		return "", fmt.Errorf("only root can mount an overlay")
+	}
+
+	if err := os.MkdirAll(filepath.Join(c.Dir, "views"), 0755); err != nil {
+		return "", err
+	}
+
+	overlayDir, err := ioutil.TempDir(filepath.Join(c.Dir, "views"), "view")
+	if err != nil {
+		return "", err
+	}
+
+	upper := filepath.Join(overlayDir, "upper")
+	work := filepath.Join(overlayDir, "work")
+
+	for _, d := range []string{upper, work} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			os.RemoveAll(overlayDir)
+			return "", err
+		}
+	}
+
+	data := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)
+	if err := unix.Mount("overlay", dir, "overlay", 0, data); err != nil {
+		os.RemoveAll(overlayDir)
+		return "", err
+	}
+
+	return overlayDir, nil
+}
+
+func (c *RootfsCache) release(dir string) error {
+	view, ok := c.views[dir]
+	if !ok {
+		return nil
+	}
+
+	if view.overlayDir != "" {
+		if err := unix.Unmount(dir, unix.MNT_DETACH); err != nil {
+			return fmt.Errorf("could not unmount %s: %v", dir, err)
+		}
+
+		if err := os.RemoveAll(view.overlayDir); err != nil {
+			return err
+		}
+	}
+
+	delete(c.views, dir)
+
+	if entry, ok := c.entries[view.digest]; ok {
+		entry.refs--
+	}
+
+	return nil
+}
+
+func (c *RootfsCache) prune() error {
+	for digest, entry := range c.entries {
+		if entry.refs > 0 {
+			continue
+		}
+
+		if err := os.RemoveAll(entry.path); err != nil {
+			return err
+		}
+
+		delete(c.entries, digest)
+	}
+
+	return nil
+}
+
+// Digest returns the sha256 digest of the tarball
+func (t TarballRootfs) Digest() (string, error) {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Digest returns the digest of the image manifest
+func (o OCILayoutRootfs) Digest() (string, error) {
+	desc, err := o.manifestDescriptor()
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest, nil
+}
+
+// Digest returns the ID of the docker image
+func (d DockerRootfs) Digest() (string, error) {
+	stdout, stderr, exitCode := NewCommand(Docker, "image", "inspect", "--format", "{{.Id}}", d.Image).Run()
+	if exitCode != 0 {
+		return "", fmt.Errorf("could not inspect image %s: %s", d.Image, stderr)
+	}
+
+	return strings.TrimSpace(stdout), nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countingRootfs is a rootfs source that counts its extractions
+type countingRootfs struct {
+	extractions int
+}
+
+func (c *countingRootfs) Extract(dir string) error {
+	c.extractions++
+	return ioutil.WriteFile(filepath.Join(dir, "hostname"), []byte("cached"), 0644)
+}
+
+func (c *countingRootfs) Digest() (string, error) {
+	return "sha256:1234", nil
+}
+
+func TestRootfsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewRootfsCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &countingRootfs{}
+	var views []string
+
+	for _, name := range []string{"view1", "view2"} {
+		view := filepath.Join(dir, name)
+		if err := os.Mkdir(view, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cache.View(source, view); err != nil {
+			t.Fatal(err)
+		}
+
+		assertContent(t, filepath.Join(view, "hostname"), "cached")
+		views = append(views, view)
+	}
+
+	if source.extractions != 1 {
+		t.Errorf("expected 1 extraction, got %d", source.extractions)
+	}
+
+	if refs := cache.entries["sha256:1234"].refs; refs != 2 {
+		t.Errorf("expected 2 references, got %d", refs)
+	}
+
+	if err := cache.Release(views[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rootfs is still referenced by the second view
+	if err := cache.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.entries) != 1 {
+		t.Fatalf("expected the rootfs to be cached")
+	}
+
+	// the remaining view is released as leaked
+	if err := cache.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.views) != 0 || len(cache.entries) != 0 {
+		t.Errorf("expected an empty cache, got %d views and %d entries", len(cache.views), len(cache.entries))
+	}
+
+	assertNotExist(t, cache.Dir)
+}
+
+func TestRootfsCacheWithoutDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewRootfsCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "file"), []byte("copied"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	view := filepath.Join(dir, "view")
+	if err := os.Mkdir(view, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.View(DirRootfs{Path: src}, view); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(view, "file"), "copied")
+
+	if len(cache.views) != 0 {
+		t.Errorf("directories should not be cached")
+	}
+}
+
+func TestRootfsCacheViewIsolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rootfs-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := NewRootfsCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Cleanup()
+
+	view := filepath.Join(dir, "view")
+	if err := os.Mkdir(view, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cache.View(&countingRootfs{}, view); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file modified in place in a view must not change the cache
+	f, err := os.OpenFile(filepath.Join(view, "hostname"), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.WriteString("modified"); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(cache.entries["sha256:1234"].path, "hostname"), "cached")
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/onsi/ginkgo"
+	spec "github.com/opencontainers/specs/specs-go"
+)
+
+// Capability is a feature that a runtime may not support
+type Capability string
+
+const (
+	// CapPause is the support of the pause and resume commands
+	CapPause Capability = "pause"
+
+	// CapUpdate is the support of the update command
+	CapUpdate Capability = "update"
+
+	// CapPs is the support of the ps command
+	CapPs Capability = "ps"
+
+	// CapEvents is the support of the events command
+	CapEvents Capability = "events"
+
+	// CapKillAll is the support of the --all option of the kill command
+	CapKillAll Capability = "kill-all"
+
+	// CapExecProcess is the support of the --process option of the exec command
+	CapExecProcess Capability = "exec-process"
+
+	// CapConsolePath is the support of a pty slave path given with --console
+	CapConsolePath Capability = "console-path"
+
+	// CapVM is set when the runtime runs the containers in virtual machines
+	CapVM Capability = "vm"
+)
+
+// RuntimeDriverName is the name of the driver of the runtime under test,
+// if empty it is guessed from the name of the runtime binary
+var RuntimeDriverName string
+
+var (
+	runtimeDrivers     = make(map[string]RuntimeDriver)
+	runtimeDriversLock sync.Mutex
+)
+
+// RuntimeDriver describes the features and the command line quirks of
+// an OCI runtime
+type RuntimeDriver interface {
+	// Name of the runtime
+	Name() string
+
+	// Has returns true if the runtime supports the capability
+	Has(capability Capability) bool
+
+	// LogArgs returns the global options that make the runtime
+	// write its debug information in logFile
+	LogArgs(logFile string) []string
+
+	// ConsoleArgs returns the options of the create, run and exec
+	// commands that attach the process to console
+	ConsoleArgs(console string) []string
+
+	// AdjustSpec changes the config of a bundle to work around the
+	// limitations of the runtime
+	AdjustSpec(config *spec.Spec)
+}
+
+// ociRuntime is a RuntimeDriver declared by a list of capabilities
+type ociRuntime struct {
+	name         string
+	capabilities []Capability
+
+	// consoleOption is the option used to pass the console
+	consoleOption string
+
+	// noTerminal is set when the bundles processes must be created
+	// without a terminal, the runtime needing a console for it
+	noTerminal bool
+}
+
+func init() {
+	RegisterRuntimeDriver(&ociRuntime{
+		name: "cc-runtime",
+		capabilities: []Capability{
+			CapPause, CapPs, CapKillAll, CapExecProcess, CapConsolePath, CapVM,
+		},
+		consoleOption: "--console",
+	})
+
+	RegisterRuntimeDriver(&ociRuntime{
+		name: "kata-runtime",
+		capabilities: []Capability{
+			CapPause, CapUpdate, CapPs, CapEvents, CapKillAll, CapExecProcess,
+			CapConsolePath, CapVM,
+		},
+		consoleOption: "--console",
+	})
+
+	// runc only accepts a unix socket that receives the pty master and
+	// refuses to create a process with a terminal without that socket
+	RegisterRuntimeDriver(&ociRuntime{
+		name: "runc",
+		capabilities: []Capability{
+			CapPause, CapUpdate, CapPs, CapEvents, CapKillAll, CapExecProcess,
+		},
+		consoleOption: "--console-socket",
+		noTerminal:    true,
+	})
+
+	// mockruntime runs the processes on the host, see cmd/mockruntime,
+	// it does not apply the capabilities of a process given with --process
+	RegisterRuntimeDriver(&ociRuntime{
+		name: "mockruntime",
+		capabilities: []Capability{
+			CapPause, CapPs, CapKillAll, CapConsolePath,
+		},
+		consoleOption: "--console",
+	})
+}
+
+// RegisterRuntimeDriver adds d to the known runtime drivers, replacing
+// the driver with the same name if any
+func RegisterRuntimeDriver(d RuntimeDriver) {
+	runtimeDriversLock.Lock()
+	defer runtimeDriversLock.Unlock()
+
+	runtimeDrivers[d.Name()] = d
+}
+
+// GetRuntimeDriver returns the driver called name
+func GetRuntimeDriver(name string) (RuntimeDriver, error) {
+	runtimeDriversLock.Lock()
+	defer runtimeDriversLock.Unlock()
+
+	if d, ok := runtimeDrivers[name]; ok {
+		return d, nil
+	}
+
+	var names []string
+	for n := range runtimeDrivers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("unknown runtime driver '%s', known drivers: %s", name, strings.Join(names, ", "))
+}
+
+// CurrentRuntimeDriver returns the driver of the runtime under test,
+// RuntimeDriverName or the name of the Runtime binary selects it. The
+// cc-runtime driver is used for the runtimes whose binary name is not a
+// known driver, LoadConfig rejects an unknown RuntimeDriverName.
+func CurrentRuntimeDriver() RuntimeDriver {
+	name := RuntimeDriverName
+	if name == "" {
+		name = filepath.Base(Runtime)
+	}
+
+	d, err := GetRuntimeDriver(name)
+	if err != nil {
+		d, _ = GetRuntimeDriver("cc-runtime")
+	}
+
+	return d
+}
+
+// SkipUnless skips the current spec if the runtime under test does not
+// support all the capabilities
+func SkipUnless(capabilities ...Capability) {
+	d := CurrentRuntimeDriver()
+
+	for _, c := range capabilities {
+		if !d.Has(c) {
+			ginkgo.Skip(fmt.Sprintf("%s does not support %s", d.Name(), c))
+		}
+	}
+}
+
+func (r *ociRuntime) Name() string {
+	return r.name
+}
+
+func (r *ociRuntime) Has(capability Capability) bool {
+	for _, c := range r.capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *ociRuntime) LogArgs(logFile string) []string {
+	return []string{fmt.Sprintf("--log=%s", logFile)}
+}
+
+func (r *ociRuntime) ConsoleArgs(console string) []string {
+	// an empty console path is accepted by the runtimes that take a
+	// path, a socket is required by the others
+	if console == "" && !r.Has(CapConsolePath) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s=%s", r.consoleOption, console)}
+}
+
+func (r *ociRuntime) AdjustSpec(config *spec.Spec) {
+	if r.noTerminal {
+		config.Process.Terminal = false
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCurrentRuntimeDriver(t *testing.T) {
+	defer func(runtime, name string) {
+		Runtime = runtime
+		RuntimeDriverName = name
+	}(Runtime, RuntimeDriverName)
+
+	RuntimeDriverName = ""
+
+	for path, expected := range map[string]string{
+		"/usr/bin/runc":         "runc",
+		"kata-runtime":          "kata-runtime",
+		"/usr/local/bin/my-oci": "cc-runtime",
+	} {
+		Runtime = path
+		if name := CurrentRuntimeDriver().Name(); name != expected {
+			t.Errorf("expected driver %s for %s, got %s", expected, path, name)
+		}
+	}
+
+	RuntimeDriverName = "runc"
+	Runtime = "/usr/bin/cc-runtime"
+	if name := CurrentRuntimeDriver().Name(); name != "runc" {
+		t.Errorf("expected the runc driver, got %s", name)
+	}
+}
+
+func TestRuntimeDriverQuirks(t *testing.T) {
+	cc, err := GetRuntimeDriver("cc-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runc, err := GetRuntimeDriver("runc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cc.Has(CapVM) || runc.Has(CapVM) {
+		t.Error("only cc-runtime should run VMs")
+	}
+
+	if args := cc.ConsoleArgs(""); !reflect.DeepEqual(args, []string{"--console="}) {
+		t.Errorf("unexpected cc-runtime console args %v", args)
+	}
+
+	if args := runc.ConsoleArgs(""); len(args) != 0 {
+		t.Errorf("unexpected runc console args %v", args)
+	}
+
+	if args := runc.ConsoleArgs("/tmp/console.sock"); !reflect.DeepEqual(args, []string{"--console-socket=/tmp/console.sock"}) {
+		t.Errorf("unexpected runc console args %v", args)
+	}
+
+	config, err := DefaultSpec("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc.AdjustSpec(config)
+	if !config.Process.Terminal {
+		t.Error("cc-runtime should keep the terminal of the default config")
+	}
+
+	runc.AdjustSpec(config)
+	if config.Process.Terminal {
+		t.Error("runc should create the processes without a terminal")
+	}
+
+	if _, err := GetRuntimeDriver("foo"); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// CtrlC is sent to interrupt the foreground process of a session
+	CtrlC = "\x03"
+
+	// CtrlD is sent to close the input of a session
+	CtrlD = "\x04"
+)
+
+// Session is an interactive process attached to a pseudo terminal. Its
+// output is matched with ExpectRegexp, in the order it is written. The
+// process is run by a Command and is killed once its timeout is reached.
+type Session struct {
+	console *Console
+	cmd     *Command
+
+	// cancel kills the process group of the command
+	cancel context.CancelFunc
+
+	lock sync.Mutex
+
+	// output is everything read from the terminal
+	output bytes.Buffer
+
+	// offset is the position in output after the last match
+	offset int
+
+	// updated receives a value each time output is read
+	updated chan struct{}
+
+	// readDone is closed once the terminal cannot be read anymore
+	readDone chan struct{}
+
+	// exited is closed once the process exits
+	exited chan struct{}
+	result Result
+}
+
+// StartSession starts path with args attached to a new pseudo terminal,
+// the terminal is the controlling terminal of the process
+func StartSession(path string, args ...string) (*Session, error) {
+	console, err := NewConsole()
+	if err != nil {
+		return nil, err
+	}
+
+	slave, err := console.OpenSlave()
+	if err != nil {
+		console.Close()
+		return nil, err
+	}
+	defer slave.Close()
+
+	cmd := NewCommand(path, args...)
+	cmd.terminal = slave
+
+	return startSession(console, cmd)
+}
+
+// startSession runs cmd, whose process uses console, until the session
+// is closed
+func startSession(console *Console, cmd *Command) (*Session, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Session{
+		console:  console,
+		cmd:      cmd,
+		cancel:   cancel,
+		updated:  make(chan struct{}, 1),
+		readDone: make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+
+	started := make(chan struct{})
+	cmd.started = func() { close(started) }
+
+	go func() {
+		s.result = cmd.RunContext(ctx)
+		cancel()
+		close(s.exited)
+	}()
+
+	select {
+	case <-started:
+	case <-s.exited:
+		console.Close()
+		if s.result.Err == nil {
+			return nil, fmt.Errorf("session %v was not started", cmd.cmd.Args)
+		}
+		return nil, s.result.Err
+	}
+
+	go s.read()
+
+	return s, nil
+}
+
+func (s *Session) read() {
+	defer close(s.readDone)
+
+	buf := make([]byte, 4096)
+
+	for {
+		// EIO is returned once every slave side is closed
+		n, err := s.console.Read(buf)
+		if n > 0 {
+			s.lock.Lock()
+			s.output.Write(buf[:n])
+			s.lock.Unlock()
+
+			select {
+			case s.updated <- struct{}{}:
+			default:
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send writes text to the terminal
+func (s *Session) Send(text string) error {
+	_, err := s.console.Write([]byte(text))
+	return err
+}
+
+// SendLine writes text followed by a newline to the terminal
+func (s *Session) SendLine(text string) error {
+	return s.Send(text + "\n")
+}
+
+// ExpectRegexp waits until the output written since the last match
+// matches pattern and returns the match and its submatches. The output
+// up to the end of the match is consumed. An error is returned if the
+// output does not match before timeout.
+func (s *Session) ExpectRegexp(pattern string, timeout time.Duration) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.After(timeout)
+
+	for {
+		if match := s.match(re); match != nil {
+			return match, nil
+		}
+
+		select {
+		case <-s.updated:
+		case <-s.readDone:
+			// the output may have been read since the last match
+			if match := s.match(re); match != nil {
+				return match, nil
+			}
+			return nil, fmt.Errorf("terminal closed before matching '%s', output: %q", pattern, s.pending())
+		case <-deadline:
+			return nil, fmt.Errorf("timeout reached after %s matching '%s', output: %q", timeout, pattern, s.pending())
+		}
+	}
+}
+
+func (s *Session) match(re *regexp.Regexp) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending := s.output.Bytes()[s.offset:]
+
+	loc := re.FindSubmatchIndex(pending)
+	if loc == nil {
+		return nil
+	}
+
+	match := make([]string, len(loc)/2)
+	for i := range match {
+		if loc[2*i] >= 0 {
+			match[i] = string(pending[loc[2*i]:loc[2*i+1]])
+		}
+	}
+
+	s.offset += loc[1]
+
+	return match
+}
+
+func (s *Session) pending() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return string(s.output.Bytes()[s.offset:])
+}
+
+// Output returns everything written to the terminal so far
+func (s *Session) Output() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.output.String()
+}
+
+// Resize sets the window size of the terminal
+func (s *Session) Resize(rows, cols uint16) error {
+	return s.console.Resize(rows, cols)
+}
+
+// SendSignal sends sig to the process of the session
+func (s *Session) SendSignal(sig syscall.Signal) error {
+	return s.cmd.cmd.Process.Signal(sig)
+}
+
+// Wait waits for the process to exit and returns its exit code, an
+// error is returned if it does not exit before timeout
+func (s *Session) Wait(timeout time.Duration) (int, error) {
+	select {
+	case <-s.exited:
+	case <-time.After(timeout):
+		return -1, fmt.Errorf("timeout reached after %s waiting for the session to exit", timeout)
+	}
+
+	if s.result.ExitCode == -1 && s.result.Signal == 0 {
+		return -1, s.result.Err
+	}
+
+	return s.result.ExitCode, nil
+}
+
+// Close kills the process group if it is still running and closes the
+// terminal
+func (s *Session) Close() error {
+	s.cancel()
+	<-s.exited
+
+	LogIfFail("Session output: %s\n", s.Output())
+
+	return s.console.Close()
+}
+
+// RunSession runs the container with its process attached to a new
+// pseudo terminal, the config of the bundle must request a terminal
+func (c *Container) RunSession() (*Session, error) {
+	console, err := NewConsole()
+	if err != nil {
+		return nil, err
+	}
+
+	// the console of the container is only replaced for this run
+	path := console.Path()
+	defer func(console *string) {
+		c.Console = console
+	}(c.Console)
+	c.Console = &path
+
+	args := append([]string{"run"}, c.createArgs()...)
+	args = c.withID(args...)
+
+	return c.startRuntimeSession(console, args...)
+}
+
+// ExecSession executes process in the container with it attached to a
+// new pseudo terminal
+func (c *Container) ExecSession(process Process) (*Session, error) {
+	console, err := NewConsole()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"exec", "--tty=true"}
+	args = append(args, CurrentRuntimeDriver().ConsoleArgs(console.Path())...)
+
+	if process.ContainerID != nil {
+		args = append(args, *process.ContainerID)
+	}
+
+	args = append(args, process.Workload...)
+
+	return c.startRuntimeSession(console, args...)
+}
+
+// startRuntimeSession starts the runtime with args, the runtime attaches
+// the container process to the slave side of console
+func (c *Container) startRuntimeSession(console *Console, args ...string) (*Session, error) {
+	return startSession(console, c.runtimeCommand(args...).Stream(nil))
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"testing"
+	"time"
+)
+
+const sessionTimeout = 5 * time.Second
+
+func TestSession(t *testing.T) {
+	s, err := StartSession("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the prompt is split so that the echo of this line does not match it
+	if err := s.SendLine(`PS1="rea""dy> "`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SendLine("echo result=$((6*7))"); err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := s.ExpectRegexp(`result=(\d+)`, sessionTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if match[1] != "42" {
+		t.Errorf("expected 42, got %s", match[1])
+	}
+
+	if err := s.Resize(40, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SendLine("echo size=$(stty size)")
+	if _, err := s.ExpectRegexp(`size=40 100`, sessionTimeout); err != nil {
+		t.Error(err)
+	}
+
+	// the interrupted sleep must not delay the next command, ^C is only
+	// sent once the shell runs it
+	s.SendLine("echo sleeping=$((2+2)); sleep 30; echo done")
+	if _, err := s.ExpectRegexp(`sleeping=4`, sessionTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shell ignores a ^C received before sleep is in the foreground
+	// and drops the input it reads while handling one, ^C is sent until
+	// the shell prompts again before sending the next command
+	deadline := time.Now().Add(sessionTimeout)
+	for {
+		s.Send(CtrlC)
+
+		_, err := s.ExpectRegexp(`ready> `, 500*time.Millisecond)
+		if err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+	s.SendLine("echo interrupted=$((1+1))")
+	if _, err := s.ExpectRegexp(`interrupted=2`, sessionTimeout); err != nil {
+		t.Error(err)
+	}
+
+	s.SendLine("exit 3")
+
+	exitCode, err := s.Wait(sessionTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", exitCode)
+	}
+}
+
+func TestSessionExpectTimeout(t *testing.T) {
+	s, err := StartSession("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.ExpectRegexp("never", 100*time.Millisecond); err == nil {
+		t.Error("expected a timeout")
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	defer func(timeout int) {
+		Timeout = timeout
+	}(Timeout)
+	Timeout = 1
+
+	s, err := StartSession("sh", "-c", "sleep 30 & sleep 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Wait(sessionTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.result.TimedOut {
+		t.Errorf("the session should be killed by its timeout, got %+v", s.result)
+	}
+}
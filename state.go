@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StatusCreated is the status of a created container
+	StatusCreated = "created"
+
+	// StatusRunning is the status of a running container
+	StatusRunning = "running"
+
+	// StatusPaused is the status of a paused container
+	StatusPaused = "paused"
+
+	// StatusStopped is the status of a stopped container
+	StatusStopped = "stopped"
+)
+
+// statusPollInterval is the interval between two state queries
+// while waiting for a status
+const statusPollInterval = 100 * time.Millisecond
+
+// RuntimeError is returned when a runtime command fails
+type RuntimeError struct {
+	// Args of the runtime command
+	Args []string
+
+	// Stderr of the runtime command
+	Stderr string
+
+	// ExitCode of the runtime command
+	ExitCode int
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%v failed with exit code %d: %s", e.Args, e.ExitCode, strings.TrimSpace(e.Stderr))
+}
+
+// ContainerListEntry is a container as listed by the runtime
+type ContainerListEntry struct {
+	ID          string            `json:"id"`
+	Pid         int               `json:"pid"`
+	Status      string            `json:"status"`
+	Bundle      string            `json:"bundle"`
+	Rootfs      string            `json:"rootfs,omitempty"`
+	Created     time.Time         `json:"created"`
+	Owner       string            `json:"owner,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ContainerProcess is a process running inside a container
+type ContainerProcess struct {
+	// PID of the process, -1 if ps did not report it
+	PID int
+
+	// PPID of the process, -1 if ps did not report it
+	PPID int
+
+	// CMD is the command of the process
+	CMD string
+
+	// Fields contains all the columns reported by ps
+	Fields map[string]string
+}
+
+// runRuntime runs a runtime command returning its stdout,
+// a RuntimeError is returned if the command fails
+func (c *Command) runRuntime() (string, error) {
+	stdout, stderr, exitCode := c.Run()
+	if exitCode != 0 {
+		return stdout, &RuntimeError{
+			Args:     c.cmd.Args,
+			Stderr:   stderr,
+			ExitCode: exitCode,
+		}
+	}
+
+	return stdout, nil
+}
+
+// WaitForStatus waits until the container has the given status or ctx is done
+func (c *Container) WaitForStatus(ctx context.Context, status string) error {
+	var last string
+
+	for {
+		state, err := c.State()
+		if err == nil {
+			if state.Status == status {
+				return nil
+			}
+			last = state.Status
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("container status is '%s' instead of '%s': %v", last, status, ctx.Err())
+		case <-time.After(statusPollInterval):
+		}
+	}
+}
+
+// parsePsTable parses the table output of ps, the last column,
+// usually CMD, can contain spaces
+func parsePsTable(output string) ([]ContainerProcess, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("empty ps output")
+	}
+
+	header := strings.Fields(lines[0])
+	var processes []ContainerProcess
+
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		values := splitFields(line, len(header))
+		if len(values) != len(header) {
+			return nil, fmt.Errorf("unexpected ps line '%s'", line)
+		}
+
+		p := ContainerProcess{
+			PID:    -1,
+			PPID:   -1,
+			Fields: make(map[string]string),
+		}
+
+		for i, column := range header {
+			p.Fields[column] = values[i]
+		}
+
+		if pid, ok := p.Fields["PID"]; ok {
+			var err error
+			if p.PID, err = strconv.Atoi(pid); err != nil {
+				return nil, fmt.Errorf("invalid PID in ps line '%s'", line)
+			}
+		}
+
+		if ppid, ok := p.Fields["PPID"]; ok {
+			var err error
+			if p.PPID, err = strconv.Atoi(ppid); err != nil {
+				return nil, fmt.Errorf("invalid PPID in ps line '%s'", line)
+			}
+		}
+
+		p.CMD = values[len(values)-1]
+		if cmd, ok := p.Fields["CMD"]; ok {
+			p.CMD = cmd
+		} else if cmd, ok := p.Fields["COMMAND"]; ok {
+			p.CMD = cmd
+		}
+
+		processes = append(processes, p)
+	}
+
+	return processes, nil
+}
+
+// splitFields splits s in at most n whitespace separated fields,
+// the last field contains the rest of s
+func splitFields(s string, n int) []string {
+	var fields []string
+
+	s = strings.TrimSpace(s)
+	for len(fields) < n-1 && s != "" {
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			break
+		}
+
+		fields = append(fields, s[:i])
+		s = strings.TrimLeft(s[i:], " \t")
+	}
+
+	if s != "" {
+		fields = append(fields, s)
+	}
+
+	return fields
+}
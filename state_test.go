@@ -0,0 +1,75 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import "testing"
+
+func TestParsePsTable(t *testing.T) {
+	output := `UID        PID  PPID  C STIME TTY          TIME CMD
+root         1     0  0 10:00 ?        00:00:00 sh -c sleep 30
+root         7     1  0 10:00 ?        00:00:00 sleep 30
+`
+
+	processes, err := parsePsTable(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processes) != 2 {
+		t.Fatalf("expected 2 processes, got %d", len(processes))
+	}
+
+	p := processes[0]
+	if p.PID != 1 || p.PPID != 0 {
+		t.Fatalf("unexpected PID %d and PPID %d", p.PID, p.PPID)
+	}
+
+	if p.CMD != "sh -c sleep 30" {
+		t.Fatalf("unexpected CMD '%s'", p.CMD)
+	}
+
+	if p.Fields["UID"] != "root" || p.Fields["TTY"] != "?" {
+		t.Fatalf("unexpected fields %v", p.Fields)
+	}
+
+	if processes[1].PID != 7 || processes[1].CMD != "sleep 30" {
+		t.Fatalf("unexpected process %+v", processes[1])
+	}
+}
+
+func TestParsePsTableWithoutPID(t *testing.T) {
+	processes, err := parsePsTable("USER COMMAND\nroot top -b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processes) != 1 {
+		t.Fatalf("expected 1 process, got %d", len(processes))
+	}
+
+	if processes[0].PID != -1 || processes[0].CMD != "top -b" {
+		t.Fatalf("unexpected process %+v", processes[0])
+	}
+}
+
+func TestParsePsTableInvalid(t *testing.T) {
+	if _, err := parsePsTable(""); err == nil {
+		t.Fatal("expected an error for an empty output")
+	}
+
+	if _, err := parsePsTable("PID CMD\nfoo sleep 30\n"); err == nil {
+		t.Fatal("expected an error for an invalid PID")
+	}
+}
@@ -1,4 +1,4 @@
-/// Copyright (c) 2017 Intel Corporation
+// Copyright (c) 2018 Intel Corporation
 //
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -15,50 +15,229 @@
 package tests
 
 import (
-	"errors"
+	"bytes"
 	"io/ioutil"
-	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const procPath = "/proc"
 
-var errFound = errors.New("found")
+var (
+	hypervisorMatchers     []HypervisorMatcher
+	hypervisorMatchersLock sync.Mutex
+)
 
-// IsVMRunning looks in /proc for a hypervisor process that contains
-// the containerID in its command line
-func IsVMRunning(containerID string) bool {
-	err := filepath.Walk(procPath, func(path string, _ os.FileInfo, _ error) error {
-		if path == "" {
-			return filepath.SkipDir
+// HypervisorMatcher recognizes the processes of a hypervisor
+type HypervisorMatcher interface {
+	// Name of the hypervisor
+	Name() string
+
+	// Match returns true if cmdline is the command line of a VM of this
+	// hypervisor running containerID, any VM if containerID is empty
+	Match(cmdline []string, containerID string) bool
+}
+
+// VMInfo describes a hypervisor process
+type VMInfo struct {
+	// PID of the hypervisor process
+	PID int
+
+	// Cmdline is the command line of the hypervisor process
+	Cmdline []string
+
+	// Hypervisor is the name of the matcher that recognized the process
+	Hypervisor string
+}
+
+// cmdlineMatcher is a HypervisorMatcher that looks at the name of the
+// binary and at the values of some options
+type cmdlineMatcher struct {
+	name string
+
+	// binaries are the prefixes of the hypervisor binary names
+	binaries []string
+
+	// idOptions are the options whose values contain the container ID,
+	// if empty the container ID can be in any argument
+	idOptions []string
+}
+
+func init() {
+	RegisterHypervisorMatcher(&cmdlineMatcher{
+		name:      "qemu",
+		binaries:  []string{"qemu-system-", "qemu-kvm"},
+		idOptions: []string{"-name", "-qmp"},
+	})
+
+	RegisterHypervisorMatcher(&cmdlineMatcher{
+		name:      "qemu-lite",
+		binaries:  []string{"qemu-lite-system-"},
+		idOptions: []string{"-name", "-qmp"},
+	})
+
+	RegisterHypervisorMatcher(&cmdlineMatcher{
+		name:      "firecracker",
+		binaries:  []string{"firecracker"},
+		idOptions: []string{"--id"},
+	})
+
+	RegisterHypervisorMatcher(&cmdlineMatcher{
+		name:     "cloud-hypervisor",
+		binaries: []string{"cloud-hypervisor"},
+	})
+}
+
+// RegisterHypervisorMatcher adds m to the matchers used to find the VMs
+func RegisterHypervisorMatcher(m HypervisorMatcher) {
+	hypervisorMatchersLock.Lock()
+	defer hypervisorMatchersLock.Unlock()
+
+	hypervisorMatchers = append(hypervisorMatchers, m)
+}
+
+// HypervisorMatchers returns the registered hypervisor matchers
+func HypervisorMatchers() []HypervisorMatcher {
+	hypervisorMatchersLock.Lock()
+	defer hypervisorMatchersLock.Unlock()
+
+	return append([]HypervisorMatcher{}, hypervisorMatchers...)
+}
+
+func (m *cmdlineMatcher) Name() string {
+	return m.name
+}
+
+func (m *cmdlineMatcher) Match(cmdline []string, containerID string) bool {
+	if len(cmdline) == 0 || !m.matchBinary(filepath.Base(cmdline[0])) {
+		return false
+	}
+
+	if containerID == "" {
+		return true
+	}
+
+	if len(m.idOptions) == 0 {
+		for _, arg := range cmdline[1:] {
+			if strings.Contains(arg, containerID) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, option := range m.idOptions {
+		if !strings.Contains(optionValue(cmdline, option), containerID) {
+			return false
 		}
+	}
+
+	return true
+}
 
-		info, err := os.Stat(path)
-		if err != nil {
-			return filepath.SkipDir
+func (m *cmdlineMatcher) matchBinary(binary string) bool {
+	for _, prefix := range m.binaries {
+		if strings.HasPrefix(binary, prefix) {
+			return true
 		}
+	}
+
+	return false
+}
 
-		if !info.IsDir() {
-			return filepath.SkipDir
+// optionValue returns the value of option in cmdline, given either
+// as "option value" or as "option=value"
+func optionValue(cmdline []string, option string) string {
+	for i, arg := range cmdline {
+		if arg == option && i+1 < len(cmdline) {
+			return cmdline[i+1]
 		}
 
-		content, err := ioutil.ReadFile(filepath.Join(path, "cmdline"))
-		if err != nil {
-			return filepath.SkipDir
+		if strings.HasPrefix(arg, option+"=") {
+			return strings.TrimPrefix(arg, option+"=")
 		}
+	}
+
+	return ""
+}
+
+// FindVM looks in /proc for a hypervisor process running containerID,
+// any hypervisor process if containerID is empty. nil is returned if
+// none is found.
+func FindVM(containerID string) *VMInfo {
+	return findVM(procPath, HypervisorMatchers(), containerID)
+}
 
-		hypervisorRegexs := []string{".*/qemu.*-name.*" + containerID + ".*-qmp.*unix:.*/" + containerID + "/.*"}
+// IsVMRunning looks in /proc for a hypervisor process that contains
+// the containerID in its command line
+func IsVMRunning(containerID string) bool {
+	return FindVM(containerID) != nil
+}
 
-		for _, regex := range hypervisorRegexs {
-			matcher := regexp.MustCompile(regex)
-			if matcher.MatchString(string(content)) {
-				return errFound
+func findVM(proc string, matchers []HypervisorMatcher, containerID string) *VMInfo {
+	for _, p := range readProcesses(proc) {
+		for _, m := range matchers {
+			if m.Match(p.cmdline, containerID) {
+				return &VMInfo{
+					PID:        p.pid,
+					Cmdline:    p.cmdline,
+					Hypervisor: m.Name(),
+				}
 			}
 		}
+	}
+
+	return nil
+}
+
+// procProcess is a process listed in /proc
+type procProcess struct {
+	pid     int
+	cmdline []string
+}
 
+// readProcesses returns the processes listed in the proc directory,
+// kernel threads and processes that exit while proc is read are skipped
+func readProcesses(proc string) []procProcess {
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		LogIfFail("could not read %s: %v\n", proc, err)
 		return nil
-	})
+	}
+
+	var processes []procProcess
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		cmdline, err := readCmdline(filepath.Join(proc, entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+
+		processes = append(processes, procProcess{pid: pid, cmdline: cmdline})
+	}
+
+	return processes
+}
+
+// readCmdline returns the arguments of a /proc/<pid>/cmdline file
+func readCmdline(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content = bytes.TrimRight(content, "\x00")
+	if len(content) == 0 {
+		return nil, nil
+	}
 
-	return err == errFound
+	return strings.Split(string(content), "\x00"), nil
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2018 Intel Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testVMID = "0123456789abcdef"
+
+var testHypervisorCmdlines = map[string][]string{
+	"qemu": {
+		"/usr/bin/qemu-system-x86_64", "-name", "pod-" + testVMID,
+		"-qmp", "unix:/run/vc/sbs/" + testVMID + "/mon-xyz,server,nowait",
+	},
+	"qemu-lite": {
+		"/usr/bin/qemu-lite-system-x86_64", "-name", "pod-" + testVMID,
+		"-qmp", "unix:/run/vc/sbs/" + testVMID + "/ctl-xyz,server,nowait",
+	},
+	"firecracker": {
+		"/usr/bin/firecracker", "--id=" + testVMID, "--api-sock", "/run/fc.sock",
+	},
+	"cloud-hypervisor": {
+		"/usr/bin/cloud-hypervisor", "--api-socket", "/run/vc/vm/" + testVMID + "/clh-api.sock",
+	},
+}
+
+func findMatcher(t *testing.T, name string) HypervisorMatcher {
+	for _, m := range HypervisorMatchers() {
+		if m.Name() == name {
+			return m
+		}
+	}
+
+	t.Fatalf("hypervisor matcher %s is not registered", name)
+	return nil
+}
+
+func TestHypervisorMatchers(t *testing.T) {
+	for name, cmdline := range testHypervisorCmdlines {
+		m := findMatcher(t, name)
+
+		if !m.Match(cmdline, testVMID) {
+			t.Errorf("%s should match %v", name, cmdline)
+		}
+
+		if !m.Match(cmdline, "") {
+			t.Errorf("%s should match %v without container ID", name, cmdline)
+		}
+
+		if m.Match(cmdline, "fedcba9876543210") {
+			t.Errorf("%s should not match %v with another container ID", name, cmdline)
+		}
+
+		for other, otherCmdline := range testHypervisorCmdlines {
+			if other != name && m.Match(otherCmdline, "") {
+				t.Errorf("%s should not match the %s command line", name, other)
+			}
+		}
+	}
+}
+
+func TestFindVM(t *testing.T) {
+	proc, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proc)
+
+	processes := map[string][]string{
+		"1":    {"/sbin/init"},
+		"42":   testHypervisorCmdlines["firecracker"],
+		"self": testHypervisorCmdlines["qemu"],
+	}
+
+	for pid, cmdline := range processes {
+		dir := filepath.Join(proc, pid)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		content := strings.Join(cmdline, "\x00") + "\x00"
+		if err := ioutil.WriteFile(filepath.Join(dir, "cmdline"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vm := findVM(proc, HypervisorMatchers(), testVMID)
+	if vm == nil {
+		t.Fatal("expected to find a VM")
+	}
+
+	if vm.PID != 42 || vm.Hypervisor != "firecracker" {
+		t.Errorf("unexpected VM %+v", vm)
+	}
+
+	if len(vm.Cmdline) != len(processes["42"]) {
+		t.Errorf("unexpected command line %v", vm.Cmdline)
+	}
+
+	if vm := findVM(proc, HypervisorMatchers(), "fedcba9876543210"); vm != nil {
+		t.Errorf("unexpected VM %+v", vm)
+	}
+}